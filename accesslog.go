@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 访问日志配置。PIPIGO_ACCESS_LOG 为访问日志文件的路径，设置后每个发出的请求 (包括重试) 都会写入一行 JSON，
+// 与数据库中的执行日志相互独立，便于审计和接入现有的日志采集。文件超过 PIPIGO_ACCESS_LOG_MAX_MB 或跨天时轮转，
+// 只保留最近的 PIPIGO_ACCESS_LOG_KEEP 个历史文件。
+var (
+	accessLogPath  = os.Getenv("PIPIGO_ACCESS_LOG")
+	accessLogMaxMB = envInt("PIPIGO_ACCESS_LOG_MAX_MB", 100)
+	accessLogKeep  = envInt("PIPIGO_ACCESS_LOG_KEEP", 7)
+)
+
+// accessLogger 写入访问日志，未配置访问日志时为 nil
+var accessLogger = newAccessLogger()
+
+// newAccessLogger 创建写入轮转文件的 JSON 日志
+func newAccessLogger() *slog.Logger {
+	if accessLogPath == "" {
+		return nil
+	}
+	w := &rotatingFile{path: accessLogPath, maxBytes: int64(accessLogMaxMB) << 20, keep: accessLogKeep}
+	if err := w.open(time.Now()); err != nil {
+		fmt.Printf("打开访问日志 %s 失败，不记录访问日志: %v\n", accessLogPath, err)
+		return nil
+	}
+	return slog.New(slog.NewJSONHandler(w, nil))
+}
+
+// logAccess 为一次发出的请求写入访问日志，请求失败 (没有收到响应) 时状态码为0
+func logAccess(t *Task, method string, entry *Log, statusCode int, err error) {
+	if accessLogger == nil {
+		return
+	}
+	attrs := []slog.Attr{
+		slog.Int("task_id", t.ID),
+		slog.String("task", t.Name),
+		slog.String("method", method),
+		slog.String("url", t.URL),
+		slog.Int("status", statusCode),
+		slog.Int64("duration_ms", entry.DurationMs),
+		slog.String("request_id", entry.RequestID),
+	}
+	if t.correlationID != "" {
+		attrs = append(attrs, slog.String("correlation_id", t.correlationID))
+	}
+	if err != nil {
+		attrs = append(attrs, slog.String("error", err.Error()))
+	}
+	accessLogger.LogAttrs(context.Background(), slog.LevelInfo, "request", attrs...)
+}
+
+// rotatingFile 是按大小和日期轮转的日志文件。轮转时当前文件被重命名为带时间戳的历史文件，
+// 超出保留数量的历史文件会被删除。
+type rotatingFile struct {
+	mu       sync.Mutex
+	path     string
+	maxBytes int64
+	keep     int
+
+	file   *os.File
+	size   int64
+	opened string // 当前文件开始写入的日期，跨天时轮转
+}
+
+// open 打开 (或创建) 日志文件，追加写入
+func (r *rotatingFile) open(now time.Time) error {
+	if err := os.MkdirAll(filepath.Dir(r.path), 0o755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(r.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	stat, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	r.file, r.size = f, stat.Size()
+	// 沿用已有的文件时，按文件的修改时间判断是否已跨天
+	r.opened = now.Format(time.DateOnly)
+	if r.size > 0 {
+		r.opened = stat.ModTime().Format(time.DateOnly)
+	}
+	return nil
+}
+
+// Write 写入一行日志，写入前按需轮转
+func (r *rotatingFile) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now()
+	if r.size > 0 && (r.size+int64(len(p)) > r.maxBytes || r.opened != now.Format(time.DateOnly)) {
+		if err := r.rotate(now); err != nil {
+			fmt.Printf("轮转访问日志失败: %v\n", err)
+		}
+	}
+	if r.file == nil {
+		return 0, fmt.Errorf("访问日志文件未打开")
+	}
+	n, err := r.file.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+// rotate 将当前文件改名为历史文件并重新打开，调用方需持有 mu
+func (r *rotatingFile) rotate(now time.Time) error {
+	r.file.Close()
+	r.file = nil
+	ext := filepath.Ext(r.path)
+	rotated := strings.TrimSuffix(r.path, ext) + "-" + now.Format("20060102-150405.000") + ext
+	if err := os.Rename(r.path, rotated); err != nil {
+		// 改名失败时继续写入原来的文件
+		return errors.Join(err, r.open(now))
+	}
+	r.prune()
+	return r.open(now)
+}
+
+// prune 删除超出保留数量的历史文件 (文件名中的时间戳可以直接排序)
+func (r *rotatingFile) prune() {
+	if r.keep <= 0 {
+		return
+	}
+	ext := filepath.Ext(r.path)
+	matches, _ := filepath.Glob(strings.TrimSuffix(r.path, ext) + "-*" + ext)
+	sort.Strings(matches)
+	for len(matches) > r.keep {
+		if err := os.Remove(matches[0]); err != nil {
+			fmt.Printf("删除旧的访问日志 %s 失败: %v\n", matches[0], err)
+		}
+		matches = matches[1:]
+	}
+}
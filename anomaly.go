@@ -0,0 +1,197 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// anomalyWindow 是响应时间基线的等效样本数，基线使用指数加权的均值和方差，越早的执行权重越小，
+// 每次执行只需 O(1) 的更新，不需要扫描历史日志
+var anomalyWindow = max(envInt("PIPIGO_ANOMALY_WINDOW", 50), 2)
+
+// anomalyMinSamples 是开始判定响应时间异常所需的最少成功执行次数
+const anomalyMinSamples = 20
+
+// anomalyMinDeltaMs 是判定异常时耗时至少高出均值的毫秒数，避免非常稳定的接口因为几毫秒的波动被判定为异常
+const anomalyMinDeltaMs = 50
+
+// latencyBaseline 是任务在一个地址上的响应时间基线
+type latencyBaseline struct {
+	samples     int
+	mean        float64
+	variance    float64
+	anomalous   bool // 最近一次成功执行是否异常
+	lastAnomaly time.Time
+}
+
+// latencyKey 按任务和地址区分基线，扇出到多个地址的任务每个地址的响应时间可能差别很大
+type latencyKey struct {
+	taskID int
+	url    string
+}
+
+// latencyKeyFor 返回地址对应的基线。只有一个地址的任务和使用请求模板的任务 (地址每次渲染结果可能不同) 整个任务共用一个基线
+func latencyKeyFor(t *Task, url string) latencyKey {
+	if len(t.URLs) == 0 || t.Templated {
+		url = ""
+	}
+	return latencyKey{taskID: t.ID, url: url}
+}
+
+var (
+	latencyBaselines = make(map[latencyKey]*latencyBaseline)
+	latencyMutex     sync.Mutex
+)
+
+// stddev 返回基线的标准差
+func (b *latencyBaseline) stddev() float64 {
+	return math.Sqrt(b.variance)
+}
+
+// threshold 返回 k 倍标准差对应的异常阈值 (毫秒)
+func (b *latencyBaseline) threshold(k float64) float64 {
+	return b.mean + math.Max(k*b.stddev(), anomalyMinDeltaMs)
+}
+
+// add 用一次执行的耗时更新指数加权的均值和方差
+func (b *latencyBaseline) add(ms float64) {
+	b.samples++
+	if b.samples == 1 {
+		b.mean = ms
+		return
+	}
+	alpha := 2 / float64(anomalyWindow+1)
+	// 最初的样本少于窗口时按实际样本数加权，避免基线过度依赖第一次执行
+	if n := 1 / float64(b.samples); n > alpha {
+		alpha = n
+	}
+	diff := ms - b.mean
+	b.mean += alpha * diff
+	b.variance = (1 - alpha) * (b.variance + alpha*diff*diff)
+}
+
+// loadLatencyBaseline 用最近的成功执行初始化基线 (例如在重启之后)，只读取最近一个窗口的日志
+func loadLatencyBaseline(key latencyKey) *latencyBaseline {
+	var durations []int64
+	q := readDB.Model(&Log{}).Where("task_id = ? AND success = ? AND skipped = ?", key.taskID, true, false)
+	if key.url != "" {
+		q = q.Where("url = ?", key.url)
+	}
+	q.Order("id DESC").Limit(anomalyWindow).Pluck("duration_ms", &durations)
+	b := &latencyBaseline{}
+	for i := len(durations) - 1; i >= 0; i-- {
+		b.add(float64(durations[i]))
+	}
+	return b
+}
+
+// latencyBaselineFor 返回地址的基线，还没有时从日志初始化，调用方需要持有 latencyMutex
+func latencyBaselineFor(key latencyKey) *latencyBaseline {
+	b, ok := latencyBaselines[key]
+	if !ok {
+		b = loadLatencyBaseline(key)
+		latencyBaselines[key] = b
+	}
+	return b
+}
+
+// checkLatency 在开启了响应时间异常检测的任务成功执行后调用：耗时超过基线均值加 k 倍标准差时标记为异常，
+// 并把本次耗时计入基线。开启了异常通知时，进入和退出异常状态时各通知一次
+func checkLatency(t *Task, entry *Log) {
+	if t.AnomalyK <= 0 || !entry.Success || entry.Skipped {
+		return
+	}
+	key := latencyKeyFor(t, entry.URL)
+	ms := float64(entry.DurationMs)
+
+	latencyMutex.Lock()
+	b := latencyBaselineFor(key)
+	wasAnomalous := b.anomalous
+	mean, std, threshold := b.mean, b.stddev(), b.threshold(t.AnomalyK)
+	b.anomalous = b.samples >= anomalyMinSamples && ms > threshold
+	if b.anomalous {
+		b.lastAnomaly = time.Now()
+	}
+	b.add(ms)
+	anomalous := b.anomalous
+	latencyMutex.Unlock()
+
+	if anomalous {
+		entry.Anomaly = true
+		entry.StatusText += fmt.Sprintf(", 响应时间异常 (%d ms，基线 %.0f±%.0f ms)", entry.DurationMs, mean, std)
+	}
+	if !t.AnomalyNotify || anomalous == wasAnomalous {
+		return
+	}
+	if anomalous {
+		msg := fmt.Sprintf("耗时 %d ms，超过基线 %.0f±%.0f ms 的阈值 %.0f ms", entry.DurationMs, mean, std, threshold)
+		fmt.Printf("[告警] 任务 #%d (%s) 响应时间异常: %s\n", t.ID, t.Name, msg)
+		notifyRun(t, severityWarning, "响应时间异常", msg, entry)
+	} else {
+		notifyRun(t, severityInfo, "响应时间已恢复正常", fmt.Sprintf("耗时 %d ms，基线 %.0f±%.0f ms", entry.DurationMs, mean, std), entry)
+	}
+}
+
+// clearLatencyBaseline 清除任务的响应时间基线，在任务被删除时调用
+func clearLatencyBaseline(id int) {
+	latencyMutex.Lock()
+	for key := range latencyBaselines {
+		if key.taskID == id {
+			delete(latencyBaselines, key)
+		}
+	}
+	latencyMutex.Unlock()
+}
+
+// latencyBaselineInfo 是接口返回的一个地址的响应时间基线
+type latencyBaselineInfo struct {
+	URL         string    `json:"url,omitempty"` // 整个任务共用一个基线时为空
+	Samples     int       `json:"samples"`
+	MeanMs      float64   `json:"mean_ms"`
+	StddevMs    float64   `json:"stddev_ms"`
+	ThresholdMs float64   `json:"threshold_ms"`
+	Ready       bool      `json:"ready"` // 样本数已足够开始判定异常
+	Anomalous   bool      `json:"anomalous"`
+	LastAnomaly time.Time `json:"last_anomaly"`
+}
+
+// registerAnomalyRoutes 注册查看响应时间基线的接口
+func registerAnomalyRoutes(r gin.IRoutes) {
+	// 任务当前的响应时间基线，扇出到多个地址的任务每个地址一条。重启后第一次查询时从最近的日志初始化
+	r.GET("/api/tasks/:id/latency-baseline", func(ctx *gin.Context) {
+		task, ok := findTask(ctx)
+		if !ok {
+			return
+		}
+		if task.AnomalyK <= 0 {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "任务未开启响应时间异常检测"})
+			return
+		}
+		list := []latencyBaselineInfo{}
+		latencyMutex.Lock()
+		urls := []string{""}
+		if len(task.URLs) > 0 && !task.Templated {
+			urls = append([]string{task.URL}, task.URLs...)
+		}
+		for _, u := range urls {
+			b := latencyBaselineFor(latencyKeyFor(&task, u))
+			list = append(list, latencyBaselineInfo{
+				URL:         u,
+				Samples:     b.samples,
+				MeanMs:      math.Round(b.mean*10) / 10,
+				StddevMs:    math.Round(b.stddev()*10) / 10,
+				ThresholdMs: math.Round(b.threshold(task.AnomalyK)*10) / 10,
+				Ready:       b.samples >= anomalyMinSamples,
+				Anomalous:   b.anomalous,
+				LastAnomaly: b.lastAnomaly,
+			})
+		}
+		latencyMutex.Unlock()
+		ctx.JSON(http.StatusOK, gin.H{"anomaly_k": task.AnomalyK, "window": anomalyWindow, "baselines": list})
+	})
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// 登录认证配置。用户保存在数据库中，首次启动时可以通过 PIPIGO_USERS 创建，没有任何用户时不启用认证。
+// 令牌使用 PIPIGO_JWT_SECRET 签名，未配置时启动时随机生成 (重启后已签发的令牌失效)。
+var (
+	jwtSecret = loadJWTSecret()
+	tokenTTL  = envDuration("PIPIGO_TOKEN_TTL", 12*time.Hour)
+)
+
+// HTTP Basic Auth 配置。同时设置 PIPIGO_AUTH_USER 和 PIPIGO_AUTH_PASS 时，所有页面和接口都需要先通过 Basic Auth，
+// 适合服务暴露在共享网络中、又不需要多用户的场景，可以与登录认证同时使用
+var (
+	basicAuthUser = os.Getenv("PIPIGO_AUTH_USER")
+	basicAuthPass = os.Getenv("PIPIGO_AUTH_PASS")
+)
+
+// basicAuth 返回校验 Basic Auth 的中间件，未配置时返回 nil。
+// 凭据缺失或错误时返回 401 和 WWW-Authenticate 响应头，浏览器会弹出登录框。
+func basicAuth() gin.HandlerFunc {
+	if basicAuthUser == "" || basicAuthPass == "" {
+		return nil
+	}
+	check := gin.BasicAuthForRealm(gin.Accounts{basicAuthUser: basicAuthPass}, "pipiGo")
+	return func(ctx *gin.Context) {
+		// 同时启用登录认证时，页面通过 Authorization: Bearer 调用接口，无法再携带 Basic Auth 凭据，
+		// 此时有效的令牌本身就说明已经通过了 Basic Auth (登录接口同样受保护)
+		if tokenString, found := strings.CutPrefix(ctx.GetHeader("Authorization"), "Bearer "); found && authEnabled() {
+			if _, err := parseToken(tokenString); err == nil {
+				ctx.Next()
+				return
+			}
+		}
+		check(ctx)
+		// gin.BasicAuth 会把用户名写入 "user"，与登录认证保存的当前用户同名，这里去掉以免被当作登录用户
+		if !ctx.IsAborted() {
+			delete(ctx.Keys, gin.AuthUserKey)
+		}
+	}
+}
+
+// authEnabled 表示是否启用了登录认证
+func authEnabled() bool {
+	return authOn
+}
+
+// loadJWTSecret 读取签名密钥，未配置时随机生成
+func loadJWTSecret() []byte {
+	if secret := os.Getenv("PIPIGO_JWT_SECRET"); secret != "" {
+		return []byte(secret)
+	}
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	if os.Getenv("PIPIGO_USERS") != "" {
+		fmt.Println("未配置 PIPIGO_JWT_SECRET，使用随机生成的签名密钥，重启后需要重新登录")
+	}
+	return []byte(hex.EncodeToString(b))
+}
+
+// dummyHash 用于在用户不存在时同样做一次哈希比较，避免通过耗时区分用户是否存在
+var dummyHash, _ = bcrypt.GenerateFromPassword([]byte("pipigo"), bcrypt.DefaultCost)
+
+// checkPassword 校验用户名和密码
+func checkPassword(username, password string) bool {
+	user, ok := findUser(username)
+	if !ok {
+		bcrypt.CompareHashAndPassword(dummyHash, []byte(password))
+		return false
+	}
+	return bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)) == nil
+}
+
+// issueToken 为用户签发一个新的令牌，返回令牌和过期时间
+func issueToken(username string) (string, time.Time, error) {
+	now := time.Now()
+	expiresAt := now.Add(tokenTTL)
+	claims := jwt.RegisteredClaims{
+		Subject:   username,
+		IssuedAt:  jwt.NewNumericDate(now),
+		ExpiresAt: jwt.NewNumericDate(expiresAt),
+	}
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(jwtSecret)
+	return token, expiresAt, err
+}
+
+// parseToken 校验令牌的签名和有效期，返回其中的用户名
+func parseToken(tokenString string) (string, error) {
+	var claims jwt.RegisteredClaims
+	_, err := jwt.ParseWithClaims(tokenString, &claims, func(*jwt.Token) (any, error) {
+		return jwtSecret, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithExpirationRequired())
+	if err != nil {
+		return "", err
+	}
+	if claims.Subject == "" {
+		return "", errors.New("令牌中缺少用户名")
+	}
+	return claims.Subject, nil
+}
+
+// authRequired 是校验 Authorization: Bearer 令牌的中间件，未启用认证时直接放行
+func authRequired() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if !authEnabled() {
+			ctx.Next()
+			return
+		}
+		tokenString, found := strings.CutPrefix(ctx.GetHeader("Authorization"), "Bearer ")
+		if !found || tokenString == "" {
+			ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "请先登录"})
+			return
+		}
+		username, err := parseToken(tokenString)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "登录已失效，请重新登录: " + err.Error()})
+			return
+		}
+		user, ok := findUser(username)
+		if !ok {
+			ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "用户不存在，请重新登录"})
+			return
+		}
+		ctx.Set("user", user)
+		ctx.Next()
+	}
+}
+
+// tokenResponse 返回签发的令牌
+func tokenResponse(ctx *gin.Context, username string) {
+	token, expiresAt, err := issueToken(username)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "签发令牌失败: " + err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{
+		"token":       token,
+		"username":    username,
+		"expires_at":  expiresAt,
+		"ttl_seconds": int(tokenTTL.Seconds()),
+	})
+}
+
+// registerAuthRoutes 注册登录相关接口。登录接口不需要令牌，刷新接口需要有效的令牌。
+func registerAuthRoutes(r gin.IRoutes, protected gin.IRoutes) {
+	// 查询是否需要登录，供页面决定是否显示登录框
+	r.GET("/api/auth", func(ctx *gin.Context) {
+		ctx.JSON(http.StatusOK, gin.H{"enabled": authEnabled()})
+	})
+
+	// 使用用户名和密码登录，返回令牌
+	r.POST("/api/login", func(ctx *gin.Context) {
+		var req struct {
+			Username string `json:"username"`
+			Password string `json:"password"`
+			Code     string `json:"code"` // 开启了两步验证的用户需要提供验证码
+		}
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if !authEnabled() {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "未启用登录认证"})
+			return
+		}
+		if !checkPassword(req.Username, req.Password) {
+			ctx.JSON(http.StatusUnauthorized, gin.H{"error": "用户名或密码错误"})
+			return
+		}
+		if user, ok := findUser(req.Username); ok && user.TOTPEnabled {
+			if strings.TrimSpace(req.Code) == "" {
+				ctx.JSON(http.StatusUnauthorized, gin.H{"error": "请输入两步验证码", "totp_required": true})
+				return
+			}
+			if err := checkUserTOTP(user, req.Code); err != nil {
+				ctx.JSON(totpErrorStatus(err, http.StatusUnauthorized), gin.H{"error": err.Error(), "totp_required": true})
+				return
+			}
+		}
+		tokenResponse(ctx, req.Username)
+	})
+
+	// 使用仍然有效的令牌换取一个新令牌，延长登录时间
+	protected.POST("/api/token/refresh", func(ctx *gin.Context) {
+		user := currentUser(ctx)
+		if user == nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "未启用登录认证"})
+			return
+		}
+		tokenResponse(ctx, user.Username)
+	})
+}
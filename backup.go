@@ -0,0 +1,396 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// 数据库自动备份配置。PIPIGO_BACKUP_INTERVAL 为备份间隔 (例如 24h)，未设置或为0时不自动备份，
+// 备份文件保存在 PIPIGO_BACKUP_DIR 中，只保留最近的 PIPIGO_BACKUP_KEEP 份。
+var (
+	backupInterval = envDuration("PIPIGO_BACKUP_INTERVAL", 0)
+	backupDir      = envString("PIPIGO_BACKUP_DIR", "db/backups")
+	backupKeep     = envInt("PIPIGO_BACKUP_KEEP", 7)
+)
+
+// backupMutex 保证同一时间只有一个备份或恢复在进行
+var backupMutex sync.Mutex
+
+// restoreConfirmation 是恢复数据库时必须提交的确认文字，防止误操作
+const restoreConfirmation = "RESTORE"
+
+// dbSwapLock 保护恢复数据库时对 db 和 readDB 的替换：处理请求和执行任务期间持有读锁，
+// 恢复时持有写锁，等待正在处理的请求和正在执行的任务结束后再关闭连接
+var dbSwapLock sync.RWMutex
+
+// dbLockExempt 是不持有读锁的接口：恢复接口自己获取写锁，事件推送是不访问数据库的长连接
+var dbLockExempt = map[string]bool{
+	"/api/admin/restore": true,
+	"/api/events":        true,
+}
+
+// holdDatabase 在处理请求期间持有 dbSwapLock 的读锁，恢复数据库期间的请求直接返回 503
+func holdDatabase() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if dbLockExempt[ctx.FullPath()] {
+			ctx.Next()
+			return
+		}
+		if !dbSwapLock.TryRLock() {
+			ctx.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"error": "正在恢复数据库，请稍后再试"})
+			return
+		}
+		defer dbSwapLock.RUnlock()
+		ctx.Next()
+	}
+}
+
+// backupInfo 描述一个备份文件
+type backupInfo struct {
+	Name      string    `json:"name"`
+	Size      int64     `json:"size"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// errNotSQLite 表示使用 MySQL 或 PostgreSQL 时不支持内置的备份和恢复
+var errNotSQLite = errors.New("内置的备份和恢复只支持 SQLite，请使用数据库自带的备份工具")
+
+// envString 从环境变量读取字符串配置，未设置时返回默认值
+func envString(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
+
+// backupDatabase 将数据库备份为带时间戳的文件，并清理超出保留数量的旧备份。
+// 使用 SQLite 的 VACUUM INTO 在线生成一致的快照，备份期间不影响任务的读写。
+func backupDatabase() (backupInfo, error) {
+	return snapshotDatabase(true)
+}
+
+// snapshotDatabase 生成数据库备份，prune 为 false 时不清理旧备份。
+// 恢复前的安全备份不清理，否则恢复最旧的备份时会在恢复开始前把它删除
+func snapshotDatabase(prune bool) (backupInfo, error) {
+	if !usingSQLite() {
+		return backupInfo{}, errNotSQLite
+	}
+	backupMutex.Lock()
+	defer backupMutex.Unlock()
+
+	if err := os.MkdirAll(backupDir, 0o755); err != nil {
+		return backupInfo{}, fmt.Errorf("创建备份目录失败: %v", err)
+	}
+	now := time.Now()
+	name := "tasks-" + now.Format("20060102-150405.000") + ".db"
+	path := filepath.Join(backupDir, name)
+	if err := db.Exec("VACUUM INTO ?", path).Error; err != nil {
+		return backupInfo{}, fmt.Errorf("备份数据库失败: %v", err)
+	}
+	stat, err := os.Stat(path)
+	if err != nil {
+		return backupInfo{}, err
+	}
+	if prune {
+		pruneBackups()
+	}
+	return backupInfo{Name: name, Size: stat.Size(), CreatedAt: now}, nil
+}
+
+// listBackups 返回备份目录中的备份文件，按时间从旧到新排列 (文件名中的时间戳可以直接排序)
+func listBackups() []string {
+	entries, err := os.ReadDir(backupDir)
+	if err != nil {
+		return nil
+	}
+	var names []string
+	for _, e := range entries {
+		if !e.IsDir() && strings.HasPrefix(e.Name(), "tasks-") && strings.HasSuffix(e.Name(), ".db") {
+			names = append(names, e.Name())
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// pruneBackups 删除超出保留数量的旧备份，调用方需持有 backupMutex
+func pruneBackups() {
+	if backupKeep <= 0 {
+		return
+	}
+	names := listBackups()
+	for len(names) > backupKeep {
+		if err := os.Remove(filepath.Join(backupDir, names[0])); err != nil {
+			fmt.Printf("删除旧备份 %s 失败: %v\n", names[0], err)
+		}
+		names = names[1:]
+	}
+}
+
+// scheduledBackup 是定时执行的自动备份
+func scheduledBackup() {
+	info, err := backupDatabase()
+	if err != nil {
+		fmt.Printf("[备份] %v\n", err)
+		return
+	}
+	fmt.Printf("[备份] 已备份数据库到 %s (%d 字节)\n", filepath.Join(backupDir, info.Name), info.Size)
+}
+
+// validateBackupFile 检查备份文件是一个完好的 SQLite 数据库，并且包含任务和日志表
+func validateBackupFile(path string) error {
+	conn, err := gorm.Open(sqlite.Open("file:"+path+"?mode=ro"), &gorm.Config{})
+	if err != nil {
+		return fmt.Errorf("无法打开备份文件: %v", err)
+	}
+	if sqlDB, err := conn.DB(); err == nil {
+		defer sqlDB.Close()
+	}
+	var result string
+	if err := conn.Raw("PRAGMA integrity_check").Scan(&result).Error; err != nil {
+		return fmt.Errorf("备份文件不是有效的数据库: %v", err)
+	}
+	if result != "ok" {
+		return fmt.Errorf("备份文件已损坏: %s", result)
+	}
+	for _, table := range []any{&Task{}, &Log{}} {
+		if !conn.Migrator().HasTable(table) {
+			return errors.New("备份文件中缺少任务或日志表，不是 pipiGo 的数据库")
+		}
+	}
+	return nil
+}
+
+// unregisterAllTasks 将所有任务从调度器中移除并清理其运行状态，数据库中的数据不受影响
+func unregisterAllTasks() {
+	taskMutex.Lock()
+	ids := make([]int, 0, len(tasks))
+	for id := range tasks {
+		ids = append(ids, id)
+		unschedule(id)
+	}
+	tasks = make(map[int]*Task)
+	taskMutex.Unlock()
+	for _, id := range ids {
+		clearFlapState(id)
+		clearNotifyState(id)
+		clearFailureSample(id)
+		clearBodyHashes(id)
+		clearOAuthToken(id)
+		clearLatencyBaseline(id)
+		clearTaskMetrics(id)
+	}
+}
+
+// closeDatabase 关闭数据库的读写连接和只读连接
+func closeDatabase() {
+	for _, conn := range []*gorm.DB{readDB, db} {
+		if conn == nil {
+			continue
+		}
+		if sqlDB, err := conn.DB(); err == nil {
+			sqlDB.Close()
+		}
+	}
+}
+
+// replaceDatabaseFile 用备份文件替换数据库文件，先复制到临时文件再改名，避免留下不完整的数据库
+func replaceDatabaseFile(src string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	tmp := dbPath + ".restore"
+	out, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, dbPath)
+}
+
+// databaseFiles 返回 SQLite 数据库文件及其 WAL 和共享内存文件
+func databaseFiles(base string) []string {
+	return []string{base, base + "-wal", base + "-shm"}
+}
+
+// moveDatabase 将数据库文件连同 WAL 和共享内存文件改名，后两者不存在时忽略
+func moveDatabase(from, to string) error {
+	dst := databaseFiles(to)
+	for i, src := range databaseFiles(from) {
+		os.Remove(dst[i])
+		if err := os.Rename(src, dst[i]); err != nil && !(i > 0 && os.IsNotExist(err)) {
+			return err
+		}
+	}
+	return nil
+}
+
+// reopenDatabase 重新打开数据库并加载任务，返回导致重新打开的原因 cause
+func reopenDatabase(cause error) error {
+	if err := openDatabase(); err != nil {
+		return fmt.Errorf("%v；重新打开数据库失败: %v", cause, err)
+	}
+	loadTasksFromDB()
+	return cause
+}
+
+// rollbackDatabase 删除恢复的数据库，改回保留的原数据库并重新打开
+func rollbackDatabase(previous string, cause error) error {
+	for _, f := range databaseFiles(dbPath) {
+		os.Remove(f)
+	}
+	if err := moveDatabase(previous, dbPath); err != nil {
+		return fmt.Errorf("%v；改回原来的数据库失败 (保留在 %s): %v", cause, previous, err)
+	}
+	return reopenDatabase(cause)
+}
+
+// restoreDatabase 用备份文件恢复数据库：暂停处理请求，停止调度器并等待正在执行的任务结束，关闭数据库连接，
+// 替换数据库文件后重新打开并加载任务，最后重新启动调度器。替换或打开失败时改回原来的数据库。
+func restoreDatabase(path string) error {
+	if !usingSQLite() {
+		return errNotSQLite
+	}
+	if err := checkBackupVersion(path); err != nil {
+		return err
+	}
+	backupMutex.Lock()
+	defer backupMutex.Unlock()
+
+	dbSwapLock.Lock()
+	defer dbSwapLock.Unlock()
+	<-c.Stop().Done()
+	defer c.Start()
+	unregisterAllTasks()
+	closeDatabase()
+
+	// 原来的数据库先改名保留，恢复完成后再删除
+	previous := dbPath + ".previous"
+	if err := moveDatabase(dbPath, previous); err != nil {
+		return reopenDatabase(fmt.Errorf("保留原来的数据库失败，已取消恢复: %v", err))
+	}
+	if err := replaceDatabaseFile(path); err != nil {
+		return rollbackDatabase(previous, fmt.Errorf("替换数据库文件失败，继续使用原来的数据库: %v", err))
+	}
+	if err := openDatabase(); err != nil {
+		closeDatabase()
+		return rollbackDatabase(previous, fmt.Errorf("打开恢复的数据库失败，继续使用原来的数据库: %v", err))
+	}
+	loadTasksFromDB()
+	for _, f := range databaseFiles(previous) {
+		os.Remove(f)
+	}
+	return nil
+}
+
+// registerBackupRoutes 注册数据库备份的管理接口，只有管理员可以访问
+func registerBackupRoutes(r gin.IRoutes) {
+	// 立即备份一次数据库
+	r.POST("/api/admin/backup", requireAdmin, func(ctx *gin.Context) {
+		info, err := backupDatabase()
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusOK, info)
+	})
+
+	// 从备份恢复数据库。可以通过 name 指定备份目录中的备份，也可以通过 file 上传备份文件，
+	// 必须同时提交 confirm=RESTORE。恢复前会先备份当前的数据库，以便撤销。
+	r.POST("/api/admin/restore", requireAdmin, func(ctx *gin.Context) {
+		if ctx.PostForm("confirm") != restoreConfirmation {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "恢复会覆盖当前的所有数据，请提交 confirm=" + restoreConfirmation + " 确认"})
+			return
+		}
+
+		var path string
+		if file, err := ctx.FormFile("file"); err == nil {
+			if err := os.MkdirAll(backupDir, 0o755); err != nil {
+				ctx.JSON(http.StatusInternalServerError, gin.H{"error": "创建备份目录失败: " + err.Error()})
+				return
+			}
+			path = filepath.Join(backupDir, "upload-"+time.Now().Format("20060102-150405.000")+".db")
+			if err := ctx.SaveUploadedFile(file, path); err != nil {
+				os.Remove(path)
+				ctx.JSON(http.StatusInternalServerError, gin.H{"error": "保存上传的文件失败: " + err.Error()})
+				return
+			}
+			// 上传的文件不属于备份，恢复结束后 (无论成功与否) 删除
+			defer os.Remove(path)
+		} else {
+			name := ctx.PostForm("name")
+			if name == "" || filepath.Base(name) != name || !strings.HasSuffix(name, ".db") {
+				ctx.JSON(http.StatusBadRequest, gin.H{"error": "请指定备份文件名或上传备份文件"})
+				return
+			}
+			path = filepath.Join(backupDir, name)
+			if _, err := os.Stat(path); err != nil {
+				ctx.JSON(http.StatusNotFound, gin.H{"error": "备份文件不存在"})
+				return
+			}
+		}
+
+		if err := validateBackupFile(path); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		safety, err := snapshotDatabase(false)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "恢复前备份当前数据库失败，已取消恢复: " + err.Error()})
+			return
+		}
+		if err := restoreDatabase(path); err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		taskMutex.Lock()
+		count := len(tasks)
+		taskMutex.Unlock()
+		fmt.Printf("[备份] 已从 %s 恢复数据库，恢复前的数据已备份为 %s\n", path, safety.Name)
+		ctx.JSON(http.StatusOK, gin.H{
+			"message":       "已从备份恢复",
+			"restored":      filepath.Base(path),
+			"safety_backup": safety.Name,
+			"tasks":         count,
+		})
+	})
+
+	// 查看现有的备份
+	r.GET("/api/admin/backups", requireAdmin, func(ctx *gin.Context) {
+		list := []backupInfo{}
+		for _, name := range listBackups() {
+			if stat, err := os.Stat(filepath.Join(backupDir, name)); err == nil {
+				list = append(list, backupInfo{Name: name, Size: stat.Size(), CreatedAt: stat.ModTime()})
+			}
+		}
+		ctx.JSON(http.StatusOK, gin.H{
+			"dir":      backupDir,
+			"interval": backupInterval.String(),
+			"keep":     backupKeep,
+			"backups":  list,
+		})
+	})
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// 全局熔断器：当所有任务最近的整体失败率过高时 (通常意味着网络中断等系统性问题)，暂停定时执行一段冷却时间，
+// 冷却后进入试探状态，逐个放行执行，连续成功足够次数后恢复正常。手动执行不受熔断限制。
+// PIPIGO_BREAKER_THRESHOLD 未设置或为0时不启用。
+var (
+	breakerThreshold  = envFloat("PIPIGO_BREAKER_THRESHOLD", 0)
+	breakerMinSamples = envInt("PIPIGO_BREAKER_MIN_SAMPLES", 20)
+	breakerWindow     = envDuration("PIPIGO_BREAKER_WINDOW", 5*time.Minute)
+	breakerCooldown   = envDuration("PIPIGO_BREAKER_COOLDOWN", time.Minute)
+)
+
+// breakerProbeSuccesses 是试探状态下恢复正常所需的连续成功次数
+const breakerProbeSuccesses = 3
+
+// 熔断器状态
+const (
+	breakerClosed   = "closed"    // 正常执行
+	breakerOpen     = "open"      // 熔断中，跳过定时执行
+	breakerHalfOpen = "half_open" // 试探中，一次只放行一个执行
+)
+
+// breakerTransition 记录一次熔断器状态变化
+type breakerTransition struct {
+	Time   time.Time `json:"time"`
+	From   string    `json:"from"`
+	To     string    `json:"to"`
+	Reason string    `json:"reason"`
+}
+
+// breakerOutcome 是一次执行结果
+type breakerOutcome struct {
+	at      time.Time
+	success bool
+}
+
+var (
+	breakerMutex       sync.Mutex
+	breakerState       = breakerClosed
+	breakerOpenedAt    time.Time
+	breakerOutcomes    []breakerOutcome
+	breakerProbing     bool // 试探状态下是否已有执行在进行
+	breakerProbeOK     int  // 试探状态下的连续成功次数
+	breakerTransitions []breakerTransition
+)
+
+// breakerAllow 判断定时执行是否可以进行。probe 为 true 表示本次执行是试探，结束后需要通过 breakerRecord 上报结果。
+func breakerAllow() (allowed, probe bool) {
+	if breakerThreshold <= 0 {
+		return true, false
+	}
+	breakerMutex.Lock()
+	defer breakerMutex.Unlock()
+
+	if breakerState == breakerOpen && time.Since(breakerOpenedAt) >= breakerCooldown {
+		setBreakerState(breakerHalfOpen, "冷却结束，开始试探")
+	}
+	switch breakerState {
+	case breakerOpen:
+		return false, false
+	case breakerHalfOpen:
+		if breakerProbing {
+			return false, false
+		}
+		breakerProbing = true
+		return true, true
+	default:
+		return true, false
+	}
+}
+
+// breakerRecord 上报一次执行结果，并在需要时切换熔断器状态
+func breakerRecord(success, probe bool) {
+	if breakerThreshold <= 0 {
+		return
+	}
+	breakerMutex.Lock()
+	defer breakerMutex.Unlock()
+
+	now := time.Now()
+	if probe && breakerState == breakerHalfOpen {
+		breakerProbing = false
+		if !success {
+			setBreakerState(breakerOpen, "试探执行失败")
+			return
+		}
+		breakerProbeOK++
+		if breakerProbeOK >= breakerProbeSuccesses {
+			breakerOutcomes = nil
+			setBreakerState(breakerClosed, fmt.Sprintf("试探执行连续成功 %d 次", breakerProbeOK))
+		}
+		return
+	}
+
+	breakerOutcomes = append(breakerOutcomes, breakerOutcome{at: now, success: success})
+	pruneBreakerOutcomes(now)
+	if breakerState != breakerClosed {
+		return
+	}
+	failures, samples := breakerFailures()
+	if samples >= breakerMinSamples && float64(failures)/float64(samples) >= breakerThreshold {
+		setBreakerState(breakerOpen, fmt.Sprintf("最近 %s 内 %d 次执行中失败 %d 次", breakerWindow, samples, failures))
+	}
+}
+
+// breakerRelease 归还未产生结果的试探机会 (例如请求全部在排队时被清除)，不计入成功或失败
+func breakerRelease(probe bool) {
+	if !probe || breakerThreshold <= 0 {
+		return
+	}
+	breakerMutex.Lock()
+	if breakerState == breakerHalfOpen {
+		breakerProbing = false
+	}
+	breakerMutex.Unlock()
+}
+
+// pruneBreakerOutcomes 丢弃窗口之外的执行结果，调用方需持有 breakerMutex
+func pruneBreakerOutcomes(now time.Time) {
+	i := 0
+	for i < len(breakerOutcomes) && now.Sub(breakerOutcomes[i].at) > breakerWindow {
+		i++
+	}
+	breakerOutcomes = breakerOutcomes[i:]
+}
+
+// breakerFailures 统计窗口内的失败次数和总次数，调用方需持有 breakerMutex
+func breakerFailures() (failures, samples int) {
+	for _, o := range breakerOutcomes {
+		if !o.success {
+			failures++
+		}
+	}
+	return failures, len(breakerOutcomes)
+}
+
+// setBreakerState 切换熔断器状态并记录，调用方需持有 breakerMutex
+func setBreakerState(to, reason string) {
+	from := breakerState
+	breakerState = to
+	switch to {
+	case breakerOpen:
+		breakerOpenedAt = time.Now()
+	case breakerHalfOpen:
+		breakerProbing = false
+		breakerProbeOK = 0
+	}
+	breakerTransitions = append(breakerTransitions, breakerTransition{Time: time.Now(), From: from, To: to, Reason: reason})
+	if len(breakerTransitions) > 50 {
+		breakerTransitions = breakerTransitions[len(breakerTransitions)-50:]
+	}
+	fmt.Printf("[熔断] 状态 %s -> %s: %s\n", from, to, reason)
+}
+
+// breakerStatus 返回熔断器的当前状态，供接口展示
+func breakerStatus() map[string]any {
+	breakerMutex.Lock()
+	defer breakerMutex.Unlock()
+	pruneBreakerOutcomes(time.Now())
+	failures, samples := breakerFailures()
+	status := map[string]any{
+		"enabled":     breakerThreshold > 0,
+		"state":       breakerState,
+		"threshold":   breakerThreshold,
+		"min_samples": breakerMinSamples,
+		"window":      breakerWindow.String(),
+		"cooldown":    breakerCooldown.String(),
+		"samples":     samples,
+		"failures":    failures,
+		"transitions": append([]breakerTransition{}, breakerTransitions...),
+	}
+	if breakerState == breakerOpen {
+		status["opened_at"] = breakerOpenedAt
+	}
+	return status
+}
+
+// breakerReset 手动将熔断器恢复为正常状态
+func breakerReset() {
+	breakerMutex.Lock()
+	defer breakerMutex.Unlock()
+	breakerOutcomes = nil
+	if breakerState != breakerClosed {
+		setBreakerState(breakerClosed, "手动恢复")
+	}
+}
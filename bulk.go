@@ -0,0 +1,224 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// bulkProtectedFields 是批量修改不能变更的字段，启用状态和置顶有专门的接口
+var bulkProtectedFields = []string{"enabled", "pinned"}
+
+// bulkUpdateRequest 是批量修改的请求。Fields 是要覆盖的任务字段 (与创建任务时的字段相同)；
+// SetHeaders 按名称合并到每个任务已有的请求头中，值为空表示删除该请求头，用于轮换令牌等只改一个请求头的场景
+type bulkUpdateRequest struct {
+	IDs        []int             `json:"ids"`
+	Fields     map[string]any    `json:"fields"`
+	SetHeaders map[string]string `json:"set_headers"`
+}
+
+// bulkResult 是批量修改中一个任务的结果
+type bulkResult struct {
+	ID          int    `json:"id"`
+	OK          bool   `json:"ok"`
+	Error       string `json:"error,omitempty"`
+	Rescheduled bool   `json:"rescheduled,omitempty"` // 执行计划 (Cron、间隔、时区或过期时间) 发生变化，已重新注册
+}
+
+// checkBulkFields 检查要修改的字段都是任务可以修改的字段
+func checkBulkFields(fields map[string]any) error {
+	known := taskDefinition(Task{})
+	for key := range fields {
+		if _, ok := known[key]; !ok || slices.Contains(bulkProtectedFields, key) {
+			return fmt.Errorf("字段 %s 不存在或不能批量修改", key)
+		}
+	}
+	return nil
+}
+
+// applyBulkUpdate 将修改应用到任务的拷贝上并校验，返回修改后的任务
+func applyBulkUpdate(old Task, req bulkUpdateRequest) (Task, error) {
+	def := taskDefinition(old)
+	for key, value := range req.Fields {
+		def[key] = value
+	}
+	raw, _ := json.Marshal(def)
+	var updated Task
+	if err := json.Unmarshal(raw, &updated); err != nil {
+		return updated, fmt.Errorf("字段格式错误: %v", err)
+	}
+	updated.ID = old.ID
+	updated.OwnerID = old.OwnerID
+	updated.Pinned = old.Pinned
+	updated.Enabled = old.Enabled
+	updated.CreatedAt = old.CreatedAt
+	updated.Source = old.Source
+	keepMaskedSecrets(&updated, old)
+	if err := keepCronTemplate(&updated, old); err != nil {
+		return updated, err
+	}
+
+	if len(req.SetHeaders) > 0 {
+		headers := map[string]string{}
+		if updated.Headers != "" {
+			if err := json.Unmarshal([]byte(updated.Headers), &headers); err != nil {
+				return updated, fmt.Errorf("任务的请求头不是有效的 JSON，无法合并: %v", err)
+			}
+		}
+		for name, value := range req.SetHeaders {
+			if value == "" {
+				delete(headers, name)
+			} else {
+				headers[name] = value
+			}
+		}
+		b, _ := json.Marshal(headers)
+		updated.Headers = string(b)
+	}
+
+	if err := validateTask(&updated); err != nil {
+		return updated, err
+	}
+	return updated, nil
+}
+
+// scheduleChanged 判断修改是否影响任务的调度
+func scheduleChanged(old, updated *Task) bool {
+	return cronSpec(old) != cronSpec(updated) || old.IntervalSeconds != updated.IntervalSeconds || !old.ExpireAt.Equal(updated.ExpireAt)
+}
+
+// replaceTask 用修改后的任务替换任务列表中的旧任务，调度不变
+func replaceTask(t *Task) {
+	taskMutex.Lock()
+	if old, ok := tasks[t.ID]; ok {
+		t.scheduledSince = old.scheduledSince
+	}
+	tasks[t.ID] = t
+	taskMutex.Unlock()
+}
+
+// registerBulkRoutes 注册批量修改和批量删除任务的接口
+func registerBulkRoutes(r gin.IRoutes) {
+	// 批量删除任务，返回实际删除的数量、不存在 (或无权访问) 的任务ID，以及由配置文件管理而没有删除的任务ID
+	r.POST("/api/tasks/bulk-delete", func(ctx *gin.Context) {
+		var req struct {
+			IDs []int `json:"ids"`
+		}
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if len(req.IDs) == 0 {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "需要提供任务ID列表 (ids)"})
+			return
+		}
+
+		var ids []int
+		db.Model(&Task{}).Scopes(ownedTasks(ctx)).Where("id IN ?", req.IDs).Pluck("id", &ids)
+		notFound := []int{}
+		for _, id := range req.IDs {
+			if !slices.Contains(ids, id) && !slices.Contains(notFound, id) {
+				notFound = append(notFound, id)
+			}
+		}
+		managed := []int{}
+		db.Model(&Task{}).Where("id IN ? AND source <> ''", ids).Pluck("id", &managed)
+		ids = slices.DeleteFunc(ids, func(id int) bool { return slices.Contains(managed, id) })
+		var deleted int64
+		if len(ids) > 0 {
+			deleted = deleteTasks(ids)
+		}
+		ctx.JSON(http.StatusOK, gin.H{"deleted": deleted, "not_found": notFound, "managed": managed})
+	})
+
+	// 将同一组字段修改应用到多个任务。所有任务都校验通过后才在一个事务中保存，任一任务失败时不做任何修改；
+	// 保存后执行计划发生变化的任务重新注册调度
+	r.POST("/api/tasks/bulk-update", func(ctx *gin.Context) {
+		var req bulkUpdateRequest
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if len(req.IDs) == 0 || (len(req.Fields) == 0 && len(req.SetHeaders) == 0) {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "需要提供任务ID列表 (ids)，以及要修改的字段 (fields) 或请求头 (set_headers)"})
+			return
+		}
+		if err := checkBulkFields(req.Fields); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		var list []Task
+		db.Scopes(ownedTasks(ctx)).Where("id IN ?", req.IDs).Find(&list)
+		found := make(map[int]Task, len(list))
+		for _, t := range list {
+			found[t.ID] = t
+		}
+
+		results := make([]bulkResult, len(req.IDs))
+		olds := make([]Task, 0, len(req.IDs))
+		updates := make([]Task, 0, len(req.IDs))
+		failed := false
+		for i, id := range req.IDs {
+			results[i] = bulkResult{ID: id}
+			old, ok := found[id]
+			if !ok {
+				results[i].Error, failed = "任务不存在", true
+				continue
+			}
+			if old.Source != "" {
+				results[i].Error, failed = "任务由配置文件 "+old.Source+" 管理，请修改配置文件", true
+				continue
+			}
+			updated, err := applyBulkUpdate(old, req)
+			if err != nil {
+				results[i].Error, failed = err.Error(), true
+				continue
+			}
+			olds = append(olds, old)
+			updates = append(updates, updated)
+		}
+		if failed {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "部分任务校验失败，没有修改任何任务", "results": results})
+			return
+		}
+
+		err := db.Transaction(func(tx *gorm.DB) error {
+			for i := range updates {
+				if err := tx.Save(&updates[i]).Error; err != nil {
+					return fmt.Errorf("保存任务 #%d 失败: %v", updates[i].ID, err)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		for i := range updates {
+			t := &updates[i]
+			results[i].OK = true
+			if scheduleChanged(&olds[i], t) {
+				results[i].Rescheduled = true
+				if err := rescheduleTask(t); err != nil {
+					results[i].OK, results[i].Error = false, "已保存，但重新注册调度失败: "+err.Error()
+				}
+			} else {
+				replaceTask(t)
+			}
+			// 地址或响应处理方式可能已经变化，之前的去重和采样状态不再适用
+			clearFailureSample(t.ID)
+			clearBodyHashes(t.ID)
+			clearOAuthToken(t.ID)
+			if t.Name != olds[i].Name {
+				clearTaskMetrics(t.ID)
+			}
+		}
+		ctx.JSON(http.StatusOK, gin.H{"updated": len(updates), "results": results})
+	})
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// runStart 记录任务最近一次开始执行的时间、触发方式和关联ID
+type runStart struct {
+	at            time.Time
+	trigger       string
+	correlationID string
+}
+
+var (
+	runStarts     = make(map[int]runStart)
+	runStartMutex sync.Mutex
+)
+
+// coalesceRun 在定时执行和手动执行开始时调用。任务设置了合并窗口，且窗口内已经有另一种触发方式的执行开始时，
+// 返回那次执行，本次执行应当跳过；否则记录本次执行的开始。同一种触发方式的执行不合并
+func coalesceRun(t *Task, trigger, correlationID string, now time.Time) (runStart, bool) {
+	if trigger != triggerSchedule && trigger != triggerManual {
+		return runStart{}, false
+	}
+	runStartMutex.Lock()
+	defer runStartMutex.Unlock()
+	prev, ok := runStarts[t.ID]
+	if ok && t.CoalesceSeconds > 0 && prev.trigger != trigger && now.Sub(prev.at) < time.Duration(t.CoalesceSeconds)*time.Second {
+		return prev, true
+	}
+	runStarts[t.ID] = runStart{at: now, trigger: trigger, correlationID: correlationID}
+	return runStart{}, false
+}
+
+// coalescedText 返回被合并的执行在日志中的说明
+func coalescedText(prev runStart, trigger string, now time.Time) string {
+	labels := map[string]string{triggerSchedule: "定时", triggerManual: "手动"}
+	return fmt.Sprintf("与 %.1f 秒前开始的%s执行合并，跳过本次%s执行",
+		now.Sub(prev.at).Seconds(), labels[prev.trigger], labels[trigger])
+}
+
+// clearRunStart 清除任务的执行开始记录，在任务被删除时调用
+func clearRunStart(id int) {
+	runStartMutex.Lock()
+	delete(runStarts, id)
+	runStartMutex.Unlock()
+}
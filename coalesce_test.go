@@ -0,0 +1,147 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// setupTestDB 在临时目录中打开一个新的 SQLite 数据库，测试结束时关闭
+func setupTestDB(t *testing.T) {
+	t.Helper()
+	dbPath = filepath.Join(t.TempDir(), "tasks.db")
+	if err := openDatabase(); err != nil {
+		t.Fatalf("打开数据库失败: %v", err)
+	}
+	t.Cleanup(closeDatabase)
+}
+
+// addTestTask 保存任务并放入内存中的任务表 (不注册到调度器)，测试结束时移除
+func addTestTask(t *testing.T, task *Task) {
+	t.Helper()
+	if err := db.Create(task).Error; err != nil {
+		t.Fatalf("保存任务失败: %v", err)
+	}
+	taskMutex.Lock()
+	tasks[task.ID] = task
+	taskMutex.Unlock()
+	t.Cleanup(func() {
+		taskMutex.Lock()
+		delete(tasks, task.ID)
+		taskMutex.Unlock()
+		clearRunStart(task.ID)
+		clearBodyHashes(task.ID)
+	})
+}
+
+// taskLogs 按写入顺序返回任务的所有日志
+func taskLogs(t *testing.T, id int) []Log {
+	t.Helper()
+	var logs []Log
+	if err := db.Where("task_id = ?", id).Order("id").Find(&logs).Error; err != nil {
+		t.Fatalf("查询日志失败: %v", err)
+	}
+	return logs
+}
+
+func TestCoalesceConcurrentRuns(t *testing.T) {
+	setupTestDB(t)
+	var hits atomic.Int32
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		time.Sleep(20 * time.Millisecond)
+		w.Write([]byte("ok"))
+	}))
+	defer target.Close()
+
+	task := &Task{Name: "coalesce", URL: target.URL, Method: "GET", CronExpr: "0 0 0 1 1 *", Enabled: true, CoalesceSeconds: 60}
+	addTestTask(t, task)
+
+	// 定时执行和手动执行同时开始
+	const runs = 10
+	start := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < runs; i++ {
+		opts := runOptions{Trigger: triggerManual}
+		if i%2 == 0 {
+			opts = runOptions{Trigger: triggerSchedule, ScheduledAt: time.Now()}
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			runTask(task.ID, opts)
+		}()
+	}
+	close(start)
+	wg.Wait()
+
+	logs := taskLogs(t, task.ID)
+	if len(logs) != runs {
+		t.Fatalf("每次执行应当写入一条日志，期望 %d 条，实际 %d 条", runs, len(logs))
+	}
+	seen := make(map[string]bool)
+	executed := make(map[string]string) // 关联ID -> 触发方式
+	for i, l := range logs {
+		if l.CorrelationID == "" || seen[l.CorrelationID] {
+			t.Fatalf("日志 #%d 的关联ID为空或重复: %q", l.ID, l.CorrelationID)
+		}
+		seen[l.CorrelationID] = true
+		if i > 0 && l.Time.Before(logs[i-1].Time) {
+			t.Errorf("日志 #%d 的时间早于前一条日志", l.ID)
+		}
+		if !l.Skipped {
+			executed[l.CorrelationID] = l.Trigger
+		}
+	}
+	if len(executed) == 0 || int(hits.Load()) != len(executed) {
+		t.Fatalf("实际请求 %d 次，但有 %d 条执行日志", hits.Load(), len(executed))
+	}
+	for _, l := range logs {
+		if !l.Skipped {
+			continue
+		}
+		trigger, ok := executed[l.CoalescedWith]
+		if !ok {
+			t.Errorf("被合并的日志 #%d 引用了不存在的执行 %q", l.ID, l.CoalescedWith)
+		} else if trigger == l.Trigger {
+			t.Errorf("日志 #%d 与同一种触发方式的执行合并", l.ID)
+		}
+	}
+}
+
+func TestCoalesceIgnoresSkippedRuns(t *testing.T) {
+	setupTestDB(t)
+	guard := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer guard.Close()
+	var hits atomic.Int32
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+	}))
+	defer target.Close()
+
+	task := &Task{Name: "guarded", URL: target.URL, Method: "GET", CronExpr: "0 0 0 1 1 *", Enabled: true,
+		CoalesceSeconds: 60, GuardFlagURL: guard.URL}
+	addTestTask(t, task)
+
+	// 定时执行因功能开关关闭被跳过，随后的手动执行不应被合并
+	runTask(task.ID, runOptions{Trigger: triggerSchedule, ScheduledAt: time.Now()})
+	runTask(task.ID, runOptions{Trigger: triggerManual})
+
+	logs := taskLogs(t, task.ID)
+	if len(logs) != 2 {
+		t.Fatalf("期望 2 条日志，实际 %d 条", len(logs))
+	}
+	if !logs[0].Skipped || logs[0].CoalescedWith != "" {
+		t.Errorf("定时执行应当因功能开关跳过: %+v", logs[0])
+	}
+	if logs[1].Skipped || hits.Load() != 1 {
+		t.Errorf("手动执行被跳过: %s", logs[1].StatusText)
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// cronDebug 为 true 时输出调度器的内部活动 (启动、唤醒、执行、添加和移除条目)，用于排查调度问题
+var cronDebug = os.Getenv("PIPIGO_CRON_DEBUG") == "true"
+
+// cronLogger 是调度器使用的日志，错误 (包括作业中被 Recover 捕获的 panic) 总是输出，其余活动只在调试模式下输出
+type cronLogger struct{}
+
+func (cronLogger) Info(msg string, keysAndValues ...any) {
+	if cronDebug {
+		fmt.Printf("[调度器] %s%s\n", msg, formatCronKV(keysAndValues))
+	}
+}
+
+func (cronLogger) Error(err error, msg string, keysAndValues ...any) {
+	fmt.Printf("[调度器] %s: %v%s\n", msg, err, formatCronKV(keysAndValues))
+}
+
+// formatCronKV 将调度器日志的键值对格式化为 " key=value" 的形式，时间按本地时间输出
+func formatCronKV(keysAndValues []any) string {
+	var b strings.Builder
+	for i := 0; i+1 < len(keysAndValues); i += 2 {
+		value := keysAndValues[i+1]
+		if t, ok := value.(time.Time); ok {
+			value = t.Format(time.DateTime)
+		}
+		fmt.Fprintf(&b, " %v=%v", keysAndValues[i], value)
+	}
+	return b.String()
+}
+
+// cronTaskJob 返回任务在 Cron 调度中执行的作业。作业中的 panic 带上任务编号后继续抛出，
+// 由调度器的 Recover 捕获并连同调用栈一起记录，不会导致程序退出
+func cronTaskJob(id int) func() {
+	return func() {
+		defer func() {
+			if r := recover(); r != nil {
+				panic(fmt.Errorf("任务 #%d 执行时发生 panic: %v", id, r))
+			}
+		}()
+		runTask(id, runOptions{Trigger: triggerSchedule, ScheduledAt: scheduledTime(id)})
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"hash/fnv"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// cronTemplateData 是 Cron 模板中可以访问的任务信息
+type cronTemplateData struct {
+	ID   int
+	Name string
+	Seed int // 由任务ID计算出的稳定数值，比ID本身分布得更分散
+}
+
+// cronTemplateFuncs 是 Cron 模板中可以使用的函数
+var cronTemplateFuncs = template.FuncMap{
+	"mod": func(a, b int) int {
+		if b == 0 {
+			return 0
+		}
+		return (a%b + b) % b
+	},
+	"add":  func(a, b int) int { return a + b },
+	"hash": hashString,
+}
+
+// hashString 将字符串散列为一个非负整数
+func hashString(s string) int {
+	h := fnv.New32a()
+	h.Write([]byte(s))
+	return int(h.Sum32())
+}
+
+// resolveCronTemplate 按任务的 Cron 模板计算出具体的 Cron 表达式并写入 CronExpr，没有模板时不做任何处理。
+// 模板使用 Go text/template 语法，例如 "0 {{mod .ID 60}} * * * *" 表示每小时在第 (ID % 60) 分钟执行，
+// 用于让批量创建的任务自然地错开执行时间。模板只在任务创建时计算一次，之后沿用保存的表达式。
+func resolveCronTemplate(t *Task) error {
+	t.CronTemplate = strings.TrimSpace(t.CronTemplate)
+	if t.CronTemplate == "" {
+		return nil
+	}
+	tmpl, err := template.New("cron").Funcs(cronTemplateFuncs).Option("missingkey=error").Parse(t.CronTemplate)
+	if err != nil {
+		return fmt.Errorf("Cron模板格式错误: %v", err)
+	}
+	var buf bytes.Buffer
+	data := cronTemplateData{ID: t.ID, Name: t.Name, Seed: hashString(strconv.Itoa(t.ID))}
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return fmt.Errorf("Cron模板计算失败: %v", err)
+	}
+	t.CronExpr = strings.TrimSpace(buf.String())
+	return nil
+}
+
+// finalizeCronTemplate 在任务保存后用实际的ID重新计算 Cron 表达式并保存，之后表达式不再随模板变化
+func finalizeCronTemplate(t *Task) error {
+	if t.CronTemplate == "" {
+		return nil
+	}
+	if err := resolveCronTemplate(t); err != nil {
+		return err
+	}
+	if err := validateCronInterval(cronSpec(t)); err != nil {
+		return err
+	}
+	return db.Model(t).Update("cron_expr", t.CronExpr).Error
+}
+
+// keepCronTemplate 修改已有任务时使用：模板没有变化时沿用创建时计算出的表达式，模板变化时按任务ID重新计算
+func keepCronTemplate(t *Task, old Task) error {
+	t.CronTemplate = strings.TrimSpace(t.CronTemplate)
+	if t.CronTemplate == "" {
+		return nil
+	}
+	if t.CronTemplate == old.CronTemplate {
+		t.CronExpr = old.CronExpr
+		return nil
+	}
+	return resolveCronTemplate(t)
+}
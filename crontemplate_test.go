@@ -0,0 +1,42 @@
+package main
+
+import "testing"
+
+func TestCronTemplateResolvedOnlyAtCreation(t *testing.T) {
+	created := Task{ID: 7, Name: "a", URL: "http://example.com", CronTemplate: "0 {{mod .Seed 60}} * * * *"}
+	if err := resolveCronTemplate(&created); err != nil {
+		t.Fatal(err)
+	}
+
+	// 改名不影响计算结果
+	renamed := created
+	renamed.Name = "b"
+	if err := resolveCronTemplate(&renamed); err != nil {
+		t.Fatal(err)
+	}
+	if renamed.CronExpr != created.CronExpr {
+		t.Errorf("改名后表达式从 %q 变为 %q", created.CronExpr, renamed.CronExpr)
+	}
+
+	// 修改已有任务时沿用保存的表达式
+	updated := created
+	updated.CronExpr = "0 0 * * * *"
+	if err := keepCronTemplate(&updated, created); err != nil {
+		t.Fatal(err)
+	}
+	if err := validateTask(&updated); err != nil {
+		t.Fatal(err)
+	}
+	if updated.CronExpr != created.CronExpr {
+		t.Errorf("修改任务后表达式从 %q 变为 %q", created.CronExpr, updated.CronExpr)
+	}
+
+	// 修改模板时按任务ID重新计算
+	updated.CronTemplate = "0 {{mod .ID 60}} * * * *"
+	if err := keepCronTemplate(&updated, created); err != nil {
+		t.Fatal(err)
+	}
+	if updated.CronExpr != "0 7 * * * *" {
+		t.Errorf("修改模板后表达式为 %q，期望 %q", updated.CronExpr, "0 7 * * * *")
+	}
+}
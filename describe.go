@@ -0,0 +1,283 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// describeCron 将 Cron 表达式翻译为中文描述，例如 "0 30 1 * * *" -> "每天凌晨1点30分"。
+// 只处理常见的字段组合，无法翻译的表达式原样返回。
+func describeCron(expr string) string {
+	expr = strings.TrimSpace(expr)
+	if strings.HasPrefix(expr, "@") {
+		if desc, ok := describeDescriptor(expr); ok {
+			return desc
+		}
+		return expr
+	}
+
+	fields := strings.Fields(expr)
+	if len(fields) != 6 {
+		return expr
+	}
+	sec, min, hour, dom, month, dow := fields[0], fields[1], fields[2], fields[3], fields[4], fields[5]
+
+	date, ok := describeDate(dom, month, dow)
+	if !ok {
+		return expr
+	}
+	clock, periodic, ok := describeTime(sec, min, hour)
+	if !ok {
+		return expr
+	}
+
+	switch {
+	case date == "" && periodic:
+		return clock
+	case date == "":
+		return "每天" + clock
+	case periodic:
+		return date + "，" + clock
+	default:
+		return date + clock
+	}
+}
+
+// describeDescriptor 翻译 @daily、@every 1h 等预定义写法
+func describeDescriptor(expr string) (string, bool) {
+	switch expr {
+	case "@yearly", "@annually":
+		return "每年1月1日0点", true
+	case "@monthly":
+		return "每月1日0点", true
+	case "@weekly":
+		return "每周日0点", true
+	case "@daily", "@midnight":
+		return "每天0点", true
+	case "@hourly":
+		return "每小时整点", true
+	}
+	if strings.HasPrefix(expr, "@every ") {
+		d, err := time.ParseDuration(strings.TrimSpace(strings.TrimPrefix(expr, "@every ")))
+		if err != nil {
+			return "", false
+		}
+		return "每隔" + describeDuration(d), true
+	}
+	return "", false
+}
+
+// describeDuration 将时长格式化为中文，例如 90m -> "1小时30分钟"
+func describeDuration(d time.Duration) string {
+	var b strings.Builder
+	if h := int(d / time.Hour); h > 0 {
+		fmt.Fprintf(&b, "%d小时", h)
+	}
+	if m := int(d % time.Hour / time.Minute); m > 0 {
+		fmt.Fprintf(&b, "%d分钟", m)
+	}
+	if s := int(d % time.Minute / time.Second); s > 0 || b.Len() == 0 {
+		fmt.Fprintf(&b, "%d秒", s)
+	}
+	return b.String()
+}
+
+// describeDate 翻译日期相关的三个字段，全部为通配时返回空字符串
+func describeDate(dom, month, dow string) (string, bool) {
+	if !isAny(dom) && !isAny(dow) {
+		// 日和星期同时指定时为"或"的关系，难以准确描述
+		return "", false
+	}
+
+	var monthDesc string
+	if !isAny(month) {
+		list, ok := describeList(month, nil)
+		if !ok {
+			return "", false
+		}
+		monthDesc = "每年" + list + "月"
+	}
+
+	switch {
+	case !isAny(dom):
+		if step, ok := parseStep(dom); ok {
+			if monthDesc != "" {
+				return monthDesc + "每隔" + strconv.Itoa(step) + "天", true
+			}
+			return "每隔" + strconv.Itoa(step) + "天", true
+		}
+		list, ok := describeList(dom, nil)
+		if !ok {
+			return "", false
+		}
+		if monthDesc == "" {
+			return "每月" + list + "日", true
+		}
+		return monthDesc + list + "日", true
+	case !isAny(dow):
+		list, ok := describeList(dow, weekdayName)
+		if !ok {
+			return "", false
+		}
+		return monthDesc + "每" + list, true
+	default:
+		return monthDesc, true
+	}
+}
+
+// describeTime 翻译秒、分、时三个字段。periodic 表示结果是"每隔多久"这类周期描述，而不是固定的时刻。
+func describeTime(sec, min, hour string) (desc string, periodic bool, ok bool) {
+	// 秒级周期
+	if isAny(min) && isAny(hour) {
+		if isAny(sec) {
+			return "每秒", true, true
+		}
+		if step, ok := parseStep(sec); ok {
+			return "每" + strconv.Itoa(step) + "秒", true, true
+		}
+	}
+
+	s, err := strconv.Atoi(sec)
+	if err != nil {
+		return "", false, false
+	}
+	secSuffix := ""
+	if s != 0 {
+		secSuffix = "的第" + sec + "秒"
+	}
+
+	// 分钟级周期
+	if isAny(hour) {
+		if isAny(min) {
+			return "每分钟" + secSuffix, true, true
+		}
+		if step, ok := parseStep(min); ok {
+			return "每" + strconv.Itoa(step) + "分钟" + secSuffix, true, true
+		}
+	}
+
+	m, err := strconv.Atoi(min)
+	if err != nil {
+		if step, ok := parseStep(min); ok {
+			if h, err := strconv.Atoi(hour); err == nil {
+				return hourName(h) + "内每" + strconv.Itoa(step) + "分钟" + secSuffix, true, true
+			}
+		}
+		return "", false, false
+	}
+	minute := fmt.Sprintf("%d分", m)
+	if s != 0 {
+		minute += sec + "秒"
+	}
+
+	// 小时级周期
+	switch {
+	case isAny(hour):
+		if m == 0 && s == 0 {
+			return "每小时整点", true, true
+		}
+		return "每小时的第" + minute, true, true
+	case strings.HasPrefix(hour, "*/"):
+		step, ok := parseStep(hour)
+		if !ok {
+			return "", false, false
+		}
+		if m == 0 && s == 0 {
+			return "每" + strconv.Itoa(step) + "小时整点", true, true
+		}
+		return "每" + strconv.Itoa(step) + "小时的第" + minute, true, true
+	}
+
+	// 固定时刻
+	h, err := strconv.Atoi(hour)
+	if err != nil {
+		list, ok := describeList(hour, func(n int) string { return strconv.Itoa(n) + "点" })
+		if !ok {
+			return "", false, false
+		}
+		if m == 0 && s == 0 {
+			return list + "整", false, true
+		}
+		return list + "的第" + minute, false, true
+	}
+	if m == 0 && s == 0 {
+		return hourName(h) + "整", false, true
+	}
+	return hourName(h) + minute, false, true
+}
+
+// hourName 将24小时制的小时转换为带时段的中文，例如 1 -> "凌晨1点"，15 -> "下午3点"
+func hourName(h int) string {
+	switch {
+	case h < 6:
+		return fmt.Sprintf("凌晨%d点", h)
+	case h < 12:
+		return fmt.Sprintf("上午%d点", h)
+	case h == 12:
+		return "中午12点"
+	case h < 18:
+		return fmt.Sprintf("下午%d点", h-12)
+	default:
+		return fmt.Sprintf("晚上%d点", h-12)
+	}
+}
+
+var weekdayNames = []string{"周日", "周一", "周二", "周三", "周四", "周五", "周六"}
+
+// weekdayName 将星期字段的数值转换为中文，7 同样表示周日
+func weekdayName(n int) string {
+	return weekdayNames[n%7]
+}
+
+// weekdayAbbr 用于解析星期字段中的英文缩写
+var weekdayAbbr = map[string]int{"SUN": 0, "MON": 1, "TUE": 2, "WED": 3, "THU": 4, "FRI": 5, "SAT": 6}
+
+// describeList 翻译由逗号分隔的数值或范围，例如 "1,3,5" -> "1、3、5"，"1-5" -> "1至5"
+func describeList(field string, name func(int) string) (string, bool) {
+	if name == nil {
+		name = strconv.Itoa
+	}
+	var parts []string
+	for _, item := range strings.Split(field, ",") {
+		if lo, hi, found := strings.Cut(item, "-"); found {
+			a, ok1 := parseFieldValue(lo)
+			b, ok2 := parseFieldValue(hi)
+			if !ok1 || !ok2 {
+				return "", false
+			}
+			parts = append(parts, name(a)+"至"+name(b))
+			continue
+		}
+		n, ok := parseFieldValue(item)
+		if !ok {
+			return "", false
+		}
+		parts = append(parts, name(n))
+	}
+	return strings.Join(parts, "、"), true
+}
+
+// parseFieldValue 解析字段中的单个数值，支持星期的英文缩写
+func parseFieldValue(s string) (int, bool) {
+	if n, ok := weekdayAbbr[strings.ToUpper(s)]; ok {
+		return n, true
+	}
+	n, err := strconv.Atoi(s)
+	return n, err == nil
+}
+
+// parseStep 解析 "*/n" 形式的步长
+func parseStep(field string) (int, bool) {
+	if !strings.HasPrefix(field, "*/") {
+		return 0, false
+	}
+	n, err := strconv.Atoi(strings.TrimPrefix(field, "*/"))
+	return n, err == nil && n > 0
+}
+
+// isAny 判断字段是否为通配
+func isAny(field string) bool {
+	return field == "*" || field == "?"
+}
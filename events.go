@@ -0,0 +1,129 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// heartbeatInterval 是长时间执行的任务输出 "仍在执行" 心跳的间隔，任务执行超过一个间隔后开始输出，设置为0表示关闭
+var heartbeatInterval = envDuration("PIPIGO_HEARTBEAT_INTERVAL", 30*time.Second)
+
+// 执行事件的类型
+const (
+	eventHeartbeat = "heartbeat" // 任务仍在执行
+	eventCompleted = "completed" // 输出过心跳的任务执行结束
+)
+
+// runEvent 是推送给页面的任务执行事件
+type runEvent struct {
+	Type      string    `json:"type"`
+	TaskID    int       `json:"task_id"`
+	Name      string    `json:"name"`
+	ElapsedMs int64     `json:"elapsed_ms"`
+	Time      time.Time `json:"time"`
+
+	ownerID int // 只推送给任务的所有者和管理员
+}
+
+var (
+	eventSubscribers = make(map[chan runEvent]struct{})
+	eventMutex       sync.Mutex
+)
+
+// publishEvent 将事件推送给所有订阅者，订阅者处理不及时时丢弃该事件，不阻塞任务的执行
+func publishEvent(ev runEvent) {
+	eventMutex.Lock()
+	defer eventMutex.Unlock()
+	for ch := range eventSubscribers {
+		select {
+		case ch <- ev:
+		default:
+		}
+	}
+}
+
+// subscribeEvents 订阅执行事件，返回的通道在 unsubscribeEvents 后不再接收事件
+func subscribeEvents() chan runEvent {
+	ch := make(chan runEvent, 16)
+	eventMutex.Lock()
+	eventSubscribers[ch] = struct{}{}
+	eventMutex.Unlock()
+	return ch
+}
+
+// unsubscribeEvents 取消订阅
+func unsubscribeEvents(ch chan runEvent) {
+	eventMutex.Lock()
+	delete(eventSubscribers, ch)
+	eventMutex.Unlock()
+}
+
+// startHeartbeat 在任务执行超过 heartbeatInterval 后定期输出心跳日志并推送事件，直到返回的函数被调用。
+// 输出过心跳的任务结束时再推送一个 completed 事件。
+func startHeartbeat(t *Task, startedAt time.Time) func() {
+	if heartbeatInterval <= 0 {
+		return func() {}
+	}
+	done := make(chan struct{})
+	finished := make(chan struct{})
+	go func() {
+		defer close(finished)
+		ticker := time.NewTicker(heartbeatInterval)
+		defer ticker.Stop()
+		beats := 0
+		for {
+			select {
+			case <-done:
+				if beats > 0 {
+					elapsed := time.Since(startedAt)
+					fmt.Printf("[执行中] 任务 #%d (%s) 已结束，共耗时 %s\n", t.ID, t.Name, elapsed.Round(time.Second))
+					publishEvent(runEvent{Type: eventCompleted, TaskID: t.ID, Name: t.Name, ElapsedMs: elapsed.Milliseconds(), Time: time.Now(), ownerID: t.OwnerID})
+				}
+				return
+			case now := <-ticker.C:
+				beats++
+				elapsed := now.Sub(startedAt)
+				fmt.Printf("[执行中] 任务 #%d (%s) 已执行 %s，仍在等待响应\n", t.ID, t.Name, elapsed.Round(time.Second))
+				publishEvent(runEvent{Type: eventHeartbeat, TaskID: t.ID, Name: t.Name, ElapsedMs: elapsed.Milliseconds(), Time: now, ownerID: t.OwnerID})
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-finished
+	}
+}
+
+// registerEventRoutes 注册执行事件的推送接口 (Server-Sent Events)
+func registerEventRoutes(r gin.IRoutes) {
+	r.GET("/api/events", func(ctx *gin.Context) {
+		user := currentUser(ctx)
+		ch := subscribeEvents()
+		defer unsubscribeEvents(ch)
+
+		ctx.Header("Cache-Control", "no-cache")
+		ctx.Header("X-Accel-Buffering", "no")
+		// 先发送一个事件，让客户端 (以及中间的代理) 立即收到响应头
+		ctx.SSEvent("ready", gin.H{"heartbeat_interval": heartbeatInterval.String()})
+		ctx.Writer.Flush()
+		ctx.Stream(func(w io.Writer) bool {
+			select {
+			case <-ctx.Request.Context().Done():
+				return false
+			case ev := <-ch:
+				if user == nil || user.IsAdmin || ev.ownerID == user.ID {
+					ctx.SSEvent(ev.Type, ev)
+				}
+				return true
+			case <-time.After(time.Minute):
+				// 定期发送注释行保持连接，避免被代理当作空闲连接关闭
+				io.WriteString(w, ": keepalive\n\n")
+				return true
+			}
+		})
+	})
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// taskDefinition 返回任务的定义部分 (创建任务时提交的字段)，去掉ID、日志以及运行时计算的字段
+func taskDefinition(t Task) map[string]any {
+	b, _ := json.Marshal(t)
+	var def map[string]any
+	json.Unmarshal(b, &def)
+	for _, key := range []string{"id", "logs", "next_run", "prev_run", "created_at", "flapping", "cron_description", "owner_id", "source"} {
+		delete(def, key)
+	}
+	return def
+}
+
+// exportShellScript 将任务导出为 shell 脚本，脚本通过 curl 调用接口重新创建这些任务
+func exportShellScript(list []Task) string {
+	var b strings.Builder
+	b.WriteString("#!/bin/sh\n")
+	fmt.Fprintf(&b, "# 由 pipiGo 导出于 %s，共 %d 个任务\n", time.Now().Format(time.DateTime), len(list))
+	b.WriteString("# 用法: PIPIGO_URL=http://localhost:8899 sh pipigo-tasks.sh\n")
+	b.WriteString("# 注意: 任务订阅的通知渠道和所属项目需要事先在目标实例中创建\n")
+	b.WriteString("# 注意: OAuth2 客户端密钥和 SigV4 私有访问密钥已被隐藏为 ******，导入前需要替换为实际的密钥\n")
+	b.WriteString("set -e\n\n")
+	b.WriteString("PIPIGO_URL=\"${PIPIGO_URL:-http://localhost:8899}\"\n")
+
+	for _, t := range list {
+		body, _ := json.MarshalIndent(taskDefinition(maskTask(t)), "", "  ")
+		fmt.Fprintf(&b, "\n# 任务 #%d: %s\n", t.ID, strings.ReplaceAll(t.Name, "\n", " "))
+		b.WriteString("curl -fsS -X POST \"$PIPIGO_URL/api/tasks\" -H 'Content-Type: application/json' --data-binary ")
+		b.WriteString(shellQuote(string(body)))
+		b.WriteString("\necho\n")
+	}
+	return b.String()
+}
+
+// shellQuote 用单引号包裹字符串，内容中的单引号通过先结束引用、转义后再重新开始引用的方式保留
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// roundTripIssue 描述任务在导出再导入后出现的一处差异
+type roundTripIssue struct {
+	TaskID   int    `json:"task_id"`
+	Name     string `json:"name"`
+	Field    string `json:"field,omitempty"`
+	Original any    `json:"original,omitempty"`
+	Imported any    `json:"imported,omitempty"`
+	Error    string `json:"error,omitempty"`
+	// Expected 表示这是导出脚本有意造成的差异 (例如被隐藏的密钥)，不影响校验结果
+	Expected bool `json:"expected,omitempty"`
+}
+
+// verifyRoundTrip 按导出脚本的格式导出任务 (包括隐藏密钥)，再像创建任务的接口一样校验并保存到临时的内存数据库，
+// 读回后与原任务逐字段比较，返回所有差异。内存数据库在检查结束后丢弃，不影响实际的数据。
+func verifyRoundTrip(list []Task) ([]roundTripIssue, error) {
+	mem, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	if err != nil {
+		return nil, fmt.Errorf("创建临时数据库失败: %v", err)
+	}
+	sqlDB, err := mem.DB()
+	if err != nil {
+		return nil, err
+	}
+	defer sqlDB.Close()
+	// 内存数据库只存在于单个连接中
+	sqlDB.SetMaxOpenConns(1)
+	if err := mem.AutoMigrate(&Task{}); err != nil {
+		return nil, fmt.Errorf("创建临时数据库失败: %v", err)
+	}
+
+	issues := []roundTripIssue{}
+	for _, t := range list {
+		original := taskDefinition(t)
+		exported, err := json.Marshal(taskDefinition(maskTask(t)))
+		if err != nil {
+			issues = append(issues, roundTripIssue{TaskID: t.ID, Name: t.Name, Error: "导出失败: " + err.Error()})
+			continue
+		}
+		var imported Task
+		if err := json.Unmarshal(exported, &imported); err != nil {
+			issues = append(issues, roundTripIssue{TaskID: t.ID, Name: t.Name, Error: "导入时解析失败: " + err.Error()})
+			continue
+		}
+		// 保留原来的ID，避免 Cron 模板等依赖ID的字段因为重新编号而产生差异
+		imported.ID = t.ID
+		if err := validateTask(&imported); err != nil {
+			issues = append(issues, roundTripIssue{TaskID: t.ID, Name: t.Name, Error: "导入时校验失败: " + err.Error()})
+			continue
+		}
+		if err := insertTask(mem, &imported); err != nil {
+			issues = append(issues, roundTripIssue{TaskID: t.ID, Name: t.Name, Error: "导入时保存失败: " + err.Error()})
+			continue
+		}
+		var stored Task
+		if err := mem.First(&stored, t.ID).Error; err != nil {
+			issues = append(issues, roundTripIssue{TaskID: t.ID, Name: t.Name, Error: "读取导入的任务失败: " + err.Error()})
+			continue
+		}
+		issues = append(issues, diffDefinitions(t, original, taskDefinition(stored))...)
+	}
+	return issues, nil
+}
+
+// secretFields 是任务定义中的密钥字段及其名称
+var secretFields = map[string]string{
+	"oauth_client_secret": "OAuth2 客户端密钥",
+	"sigv4_secret_key":    "SigV4 私有访问密钥",
+}
+
+// diffDefinitions 逐字段比较两个任务定义，字段按名称排序
+func diffDefinitions(t Task, original, imported map[string]any) []roundTripIssue {
+	fields := make([]string, 0, len(original))
+	for field := range original {
+		fields = append(fields, field)
+	}
+	for field := range imported {
+		if _, ok := original[field]; !ok {
+			fields = append(fields, field)
+		}
+	}
+	sort.Strings(fields)
+
+	var issues []roundTripIssue
+	for _, field := range fields {
+		if !reflect.DeepEqual(original[field], imported[field]) {
+			// 密钥不在结果中展示，导出时被隐藏的密钥是预期的差异
+			if label, ok := secretFields[field]; ok {
+				if imported[field] == maskedPassword {
+					issues = append(issues, roundTripIssue{TaskID: t.ID, Name: t.Name, Field: field, Expected: true,
+						Error: label + "导出时被隐藏为 " + maskedPassword + "，导入前需要替换为实际的密钥"})
+					continue
+				}
+				issues = append(issues, roundTripIssue{TaskID: t.ID, Name: t.Name, Field: field, Error: label + "不一致"})
+				continue
+			}
+			issues = append(issues, roundTripIssue{
+				TaskID:   t.ID,
+				Name:     t.Name,
+				Field:    field,
+				Original: original[field],
+				Imported: imported[field],
+			})
+		}
+	}
+	return issues
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Extraction 定义了从 JSON 响应中提取的一个命名字段，提取结果作为日志的一列展示
+type Extraction struct {
+	Name string `json:"name"`
+	Path string `json:"path"` // 字段路径，例如 data.items[0].count
+}
+
+// pathSegment 是字段路径中的一段，key 为对象字段名，否则为数组下标
+type pathSegment struct {
+	key   string
+	index int
+	isKey bool
+}
+
+// parseJSONPath 解析形如 data.items[0].count 的字段路径，数组下标也可以写成 items.0
+func parseJSONPath(path string) ([]pathSegment, error) {
+	path = strings.TrimPrefix(strings.TrimSpace(path), "$.")
+	if path == "" {
+		return nil, errors.New("路径不能为空")
+	}
+	var segs []pathSegment
+	for _, part := range strings.Split(path, ".") {
+		name, rest, _ := strings.Cut(part, "[")
+		if name == "" && rest == "" {
+			return nil, fmt.Errorf("路径 %q 中有空的字段名", path)
+		}
+		if name != "" {
+			if n, err := strconv.Atoi(name); err == nil {
+				segs = append(segs, pathSegment{index: n})
+			} else {
+				segs = append(segs, pathSegment{key: name, isKey: true})
+			}
+		}
+		for rest != "" {
+			idx, after, found := strings.Cut(rest, "]")
+			n, err := strconv.Atoi(idx)
+			if !found || err != nil || n < 0 {
+				return nil, fmt.Errorf("路径 %q 中的数组下标无效", path)
+			}
+			segs = append(segs, pathSegment{index: n})
+			if after == "" {
+				break
+			}
+			if !strings.HasPrefix(after, "[") {
+				return nil, fmt.Errorf("路径 %q 格式错误", path)
+			}
+			rest = after[1:]
+		}
+	}
+	return segs, nil
+}
+
+// lookupJSONPath 在解析后的 JSON 文档中按路径取值
+func lookupJSONPath(doc any, segs []pathSegment) (any, bool) {
+	cur := doc
+	for _, seg := range segs {
+		if seg.isKey {
+			obj, ok := cur.(map[string]any)
+			if !ok {
+				return nil, false
+			}
+			if cur, ok = obj[seg.key]; !ok {
+				return nil, false
+			}
+			continue
+		}
+		arr, ok := cur.([]any)
+		if !ok || seg.index >= len(arr) {
+			return nil, false
+		}
+		cur = arr[seg.index]
+	}
+	return cur, true
+}
+
+// validateExtractions 校验任务的提取配置：名称必填且不重复，路径格式正确
+func validateExtractions(t *Task) error {
+	seen := make(map[string]bool)
+	for i := range t.Extractions {
+		ex := &t.Extractions[i]
+		ex.Name = strings.TrimSpace(ex.Name)
+		if ex.Name == "" {
+			return errors.New("提取字段的名称是必填项")
+		}
+		if seen[ex.Name] {
+			return fmt.Errorf("提取字段名称重复: %s", ex.Name)
+		}
+		seen[ex.Name] = true
+		if _, err := parseJSONPath(ex.Path); err != nil {
+			return fmt.Errorf("提取字段 %s 的路径无效: %v", ex.Name, err)
+		}
+	}
+	return nil
+}
+
+// extractFields 按任务的提取配置从 JSON 响应体中取值，响应体不是 JSON 或字段不存在时对应的值为 nil
+func extractFields(t *Task, body string) map[string]any {
+	if len(t.Extractions) == 0 {
+		return nil
+	}
+	var doc any
+	if err := json.Unmarshal([]byte(body), &doc); err != nil {
+		doc = nil
+	}
+	result := make(map[string]any, len(t.Extractions))
+	for _, ex := range t.Extractions {
+		result[ex.Name] = nil
+		segs, err := parseJSONPath(ex.Path)
+		if err != nil || doc == nil {
+			continue
+		}
+		if v, ok := lookupJSONPath(doc, segs); ok {
+			result[ex.Name] = v
+		}
+	}
+	return result
+}
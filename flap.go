@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+)
+
+// flapWindow 是参与抖动检测的最近执行次数
+const flapWindow = 20
+
+// flapMinSamples 是开始判定抖动所需的最少执行次数
+const flapMinSamples = 10
+
+// flapThreshold 是判定任务进入抖动状态的状态切换比例，低于其一半时视为恢复稳定
+var flapThreshold = envFloat("PIPIGO_FLAP_THRESHOLD", 0.5)
+
+// flapState 记录单个任务最近的执行结果以及是否处于抖动状态
+type flapState struct {
+	outcomes []bool
+	flapping bool
+}
+
+var (
+	flapStates = make(map[int]*flapState)
+	flapMutex  sync.Mutex
+)
+
+// recordOutcome 记录一次执行结果并更新任务的抖动状态。
+// 进入或退出抖动状态时只发出一次提醒，抖动期间由通知逻辑通过 isFlapping 抑制逐次的状态变化通知。
+func recordOutcome(t *Task, success bool) {
+	flapMutex.Lock()
+	st, ok := flapStates[t.ID]
+	if !ok {
+		st = &flapState{}
+		flapStates[t.ID] = st
+	}
+	st.outcomes = append(st.outcomes, success)
+	if len(st.outcomes) > flapWindow {
+		st.outcomes = st.outcomes[len(st.outcomes)-flapWindow:]
+	}
+
+	rate := changeRate(st.outcomes)
+	started := !st.flapping && len(st.outcomes) >= flapMinSamples && rate >= flapThreshold
+	stopped := st.flapping && rate <= flapThreshold/2
+	if started {
+		st.flapping = true
+	} else if stopped {
+		st.flapping = false
+	}
+	samples := len(st.outcomes)
+	flapMutex.Unlock()
+
+	if started {
+		msg := fmt.Sprintf("最近 %d 次执行中状态切换比例为 %.0f%%，抖动期间不再逐次通知成功/失败", samples, rate*100)
+		fmt.Printf("[告警] 任务 #%d (%s) 状态不稳定: %s\n", t.ID, t.Name, msg)
+		notify(t, severityWarning, "任务状态不稳定", msg)
+	} else if stopped {
+		fmt.Printf("任务 #%d (%s) 状态已恢复稳定\n", t.ID, t.Name)
+		notify(t, severityInfo, "任务状态已恢复稳定", fmt.Sprintf("最近 %d 次执行中状态切换比例已降至 %.0f%%", samples, rate*100))
+	}
+}
+
+// isFlapping 返回任务当前是否处于抖动状态
+func isFlapping(id int) bool {
+	flapMutex.Lock()
+	defer flapMutex.Unlock()
+	st, ok := flapStates[id]
+	return ok && st.flapping
+}
+
+// clearFlapState 清除任务的抖动检测状态，在任务被删除时调用
+func clearFlapState(id int) {
+	flapMutex.Lock()
+	delete(flapStates, id)
+	flapMutex.Unlock()
+}
+
+// changeRate 计算相邻两次执行结果发生变化的比例
+func changeRate(outcomes []bool) float64 {
+	if len(outcomes) < 2 {
+		return 0
+	}
+	changes := 0
+	for i := 1; i < len(outcomes); i++ {
+		if outcomes[i] != outcomes[i-1] {
+			changes++
+		}
+	}
+	return float64(changes) / float64(len(outcomes)-1)
+}
+
+// envFloat 从环境变量读取浮点数配置，未设置或格式错误时返回默认值
+func envFloat(key string, def float64) float64 {
+	v := os.Getenv(key)
+	if v == "" {
+		return def
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		fmt.Printf("环境变量 %s 的值 %q 无效，使用默认值 %v\n", key, v, def)
+		return def
+	}
+	return f
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// guardCacheTTL 是功能开关结果的缓存时间，同一开关在此期间内不会重复请求
+var guardCacheTTL = envDuration("PIPIGO_GUARD_CACHE", 30*time.Second)
+
+// guardTimeout 是请求功能开关地址的超时时间
+const guardTimeout = 10 * time.Second
+
+// maxGuardBodySize 是功能开关响应体的大小上限
+const maxGuardBodySize = 1 << 20
+
+// guardResult 是一次功能开关检查的结果
+type guardResult struct {
+	enabled bool
+	detail  string // 开关的取值，用于记录跳过的原因
+	at      time.Time
+}
+
+var (
+	guardCache = make(map[string]guardResult)
+	guardMutex sync.Mutex
+)
+
+// validateGuard 校验任务的功能开关配置，未配置开关地址时清空字段路径
+func validateGuard(t *Task) error {
+	t.GuardFlagURL = strings.TrimSpace(t.GuardFlagURL)
+	t.GuardFlagPath = strings.TrimSpace(t.GuardFlagPath)
+	if t.GuardFlagURL == "" {
+		t.GuardFlagPath = ""
+		return nil
+	}
+	if u, err := url.Parse(t.GuardFlagURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("功能开关地址必须是 http 或 https 地址")
+	}
+	if t.GuardFlagPath != "" {
+		if _, err := parseJSONPath(t.GuardFlagPath); err != nil {
+			return fmt.Errorf("功能开关的字段路径无效: %v", err)
+		}
+	}
+	return nil
+}
+
+// guardEnabled 检查任务的功能开关是否开启，未配置开关时总是开启。
+// 没有配置字段路径时，开关地址返回 2xx 即视为开启；配置了字段路径时，取 JSON 响应中该字段的值判断。
+// 结果按开关地址和字段路径缓存 guardCacheTTL，多个任务共用同一个开关时只请求一次。
+func guardEnabled(t *Task) (bool, string, error) {
+	if t.GuardFlagURL == "" {
+		return true, "", nil
+	}
+	key := t.GuardFlagURL + "\x00" + t.GuardFlagPath
+	guardMutex.Lock()
+	cached, ok := guardCache[key]
+	guardMutex.Unlock()
+	if ok && time.Since(cached.at) < guardCacheTTL {
+		return cached.enabled, cached.detail, nil
+	}
+
+	enabled, detail, err := fetchGuard(t.GuardFlagURL, t.GuardFlagPath)
+	if err != nil {
+		return false, "", err
+	}
+	guardMutex.Lock()
+	guardCache[key] = guardResult{enabled: enabled, detail: detail, at: time.Now()}
+	guardMutex.Unlock()
+	return enabled, detail, nil
+}
+
+// fetchGuard 请求功能开关地址并判断开关是否开启
+func fetchGuard(target, path string) (bool, string, error) {
+	client := &http.Client{Timeout: guardTimeout}
+	resp, err := client.Get(target)
+	if err != nil {
+		return false, "", err
+	}
+	defer resp.Body.Close()
+	status := fmt.Sprintf("状态 %d", resp.StatusCode)
+	if path == "" {
+		return resp.StatusCode >= 200 && resp.StatusCode < 300, status, nil
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return false, "", fmt.Errorf("开关地址返回%s", status)
+	}
+
+	b, err := io.ReadAll(io.LimitReader(resp.Body, maxGuardBodySize))
+	if err != nil {
+		return false, "", fmt.Errorf("读取开关响应失败: %v", err)
+	}
+	var doc any
+	if err := json.Unmarshal(b, &doc); err != nil {
+		return false, "", fmt.Errorf("开关响应不是 JSON: %v", err)
+	}
+	segs, err := parseJSONPath(path)
+	if err != nil {
+		return false, "", err
+	}
+	v, ok := lookupJSONPath(doc, segs)
+	if !ok {
+		return false, fmt.Sprintf("%s 不存在", path), nil
+	}
+	raw, _ := json.Marshal(v)
+	return truthy(v), fmt.Sprintf("%s = %s", path, raw), nil
+}
+
+// truthy 判断开关字段的值是否表示开启: true、非0数字，或 "true"、"1"、"yes"、"on"、"enabled" 等字符串
+func truthy(v any) bool {
+	switch val := v.(type) {
+	case bool:
+		return val
+	case float64:
+		return val != 0
+	case string:
+		switch strings.ToLower(strings.TrimSpace(val)) {
+		case "true", "1", "yes", "on", "enabled":
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// logHeaderBytes 是每条日志中保存的请求头和响应头 (各自) 的大小上限 (字节)，为0表示不保存
+var logHeaderBytes = envInt("PIPIGO_LOG_HEADER_BYTES", 4096)
+
+// sensitiveHeaderWords 是名称中含有这些词的请求头 (和响应头) 在日志中隐藏值，避免凭据被保存到日志中
+var sensitiveHeaderWords = []string{"authorization", "cookie", "token", "secret", "password", "api-key", "apikey", "signature"}
+
+// isSensitiveHeader 判断请求头的值是否需要隐藏
+func isSensitiveHeader(name string) bool {
+	name = strings.ToLower(name)
+	for _, word := range sensitiveHeaderWords {
+		if strings.Contains(name, word) {
+			return true
+		}
+	}
+	return false
+}
+
+// encodeHeaders 将请求头或响应头编码为保存在日志中的 JSON 对象，同名的多个值用逗号连接，凭据类的值被隐藏。
+// 按名称排序后依次加入，超过大小上限的部分省略，并用 "..." 记录省略的数量
+func encodeHeaders(h http.Header) string {
+	if logHeaderBytes <= 0 || len(h) == 0 {
+		return ""
+	}
+	names := make([]string, 0, len(h))
+	for name := range h {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	headers := make(map[string]string, len(names))
+	size := 2
+	for i, name := range names {
+		value := strings.Join(h[name], ", ")
+		if isSensitiveHeader(name) {
+			value = maskedPassword
+		}
+		// 每个字段的开销: 两对引号、冒号和逗号
+		size += len(name) + len(value) + 6
+		if size > logHeaderBytes {
+			headers["..."] = fmt.Sprintf("超过大小上限，省略了 %d 个", len(names)-i)
+			break
+		}
+		headers[name] = value
+	}
+	b, _ := json.Marshal(headers)
+	return string(b)
+}
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 节假日日历配置。PIPIGO_HOLIDAY_CALENDARS 形如 "cn=/data/holidays-cn.txt,us=https://example.com/us.ics"，
+// 每个日历的来源可以是本地文件或 http(s) 地址，内容为每行一个 YYYY-MM-DD 日期的列表 (# 开头为注释)，或 iCal 格式。
+// 日历在首次使用时加载，之后每隔 PIPIGO_HOLIDAY_REFRESH 重新加载。
+var (
+	holidaySources = parseHolidaySources(os.Getenv("PIPIGO_HOLIDAY_CALENDARS"))
+	holidayRefresh = envDuration("PIPIGO_HOLIDAY_REFRESH", 12*time.Hour)
+)
+
+// defaultHolidayCalendar 是任务未指定日历时使用的日历名称
+const defaultHolidayCalendar = "default"
+
+// maxHolidaySize 是节假日日历内容的大小上限
+const maxHolidaySize = 1 << 20
+
+// maxHolidaySpan 是 iCal 中单个事件最多展开的天数，避免错误的结束日期产生大量日期
+const maxHolidaySpan = 31
+
+// holidayCalendar 是一个已加载的节假日日历
+type holidayCalendar struct {
+	dates    map[string]bool // YYYY-MM-DD
+	loadedAt time.Time
+	err      error // 最近一次加载失败的原因，加载失败时继续使用上一次成功加载的日期
+}
+
+var (
+	holidayCalendars = make(map[string]*holidayCalendar)
+	holidayMutex     sync.Mutex
+)
+
+// parseHolidaySources 解析日历名称到来源的映射，没有名称的来源作为默认日历
+func parseHolidaySources(s string) map[string]string {
+	sources := make(map[string]string)
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		name, source, ok := strings.Cut(part, "=")
+		// 等号前出现路径或地址中的字符时，说明等号属于来源本身 (例如地址的查询参数)
+		if !ok || strings.ContainsAny(name, "/:") {
+			name, source = defaultHolidayCalendar, part
+		}
+		sources[strings.TrimSpace(name)] = strings.TrimSpace(source)
+	}
+	return sources
+}
+
+// holidayCalendarName 返回任务使用的日历名称
+func holidayCalendarName(t *Task) string {
+	if t.HolidayCalendar != "" {
+		return t.HolidayCalendar
+	}
+	return defaultHolidayCalendar
+}
+
+// validateHoliday 校验任务的节假日设置，开启时日历必须已配置
+func validateHoliday(t *Task) error {
+	t.HolidayCalendar = strings.TrimSpace(t.HolidayCalendar)
+	if !t.SkipHolidays {
+		return nil
+	}
+	if _, ok := holidaySources[holidayCalendarName(t)]; !ok {
+		if len(holidaySources) == 0 {
+			return fmt.Errorf("服务端没有配置节假日日历 (PIPIGO_HOLIDAY_CALENDARS)")
+		}
+		return fmt.Errorf("节假日日历 %q 不存在", holidayCalendarName(t))
+	}
+	return nil
+}
+
+// isHoliday 判断某天是否在任务使用的节假日日历中。日历无法加载时返回错误，调用方按非节假日处理
+func isHoliday(t *Task, day time.Time) (bool, error) {
+	cal, err := loadHolidayCalendar(holidayCalendarName(t))
+	if cal == nil {
+		return false, err
+	}
+	return cal.dates[day.Format(time.DateOnly)], err
+}
+
+// loadHolidayCalendar 返回已加载的日历，超过刷新间隔时重新加载
+func loadHolidayCalendar(name string) (*holidayCalendar, error) {
+	source, ok := holidaySources[name]
+	if !ok {
+		return nil, fmt.Errorf("节假日日历 %q 不存在", name)
+	}
+	holidayMutex.Lock()
+	cal := holidayCalendars[name]
+	holidayMutex.Unlock()
+	if cal != nil && time.Since(cal.loadedAt) < holidayRefresh {
+		return cal, cal.err
+	}
+
+	dates, err := fetchHolidays(source)
+	if err != nil {
+		fmt.Printf("加载节假日日历 %s 失败: %v\n", name, err)
+		// 从未成功加载过时不缓存，下次使用时重试
+		if cal == nil {
+			return nil, err
+		}
+		dates = cal.dates
+	}
+	next := &holidayCalendar{dates: dates, loadedAt: time.Now(), err: err}
+	holidayMutex.Lock()
+	holidayCalendars[name] = next
+	holidayMutex.Unlock()
+	return next, err
+}
+
+// fetchHolidays 读取日历来源并解析出其中的日期
+func fetchHolidays(source string) (map[string]bool, error) {
+	var b []byte
+	var err error
+	if strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://") {
+		client := &http.Client{Timeout: 10 * time.Second}
+		resp, err := client.Get(source)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			return nil, fmt.Errorf("日历地址返回状态 %d", resp.StatusCode)
+		}
+		if b, err = io.ReadAll(io.LimitReader(resp.Body, maxHolidaySize)); err != nil {
+			return nil, err
+		}
+	} else if b, err = os.ReadFile(source); err != nil {
+		return nil, err
+	}
+	if bytes.Contains(b, []byte("BEGIN:VCALENDAR")) {
+		return parseICalDates(b)
+	}
+	return parseDateList(b)
+}
+
+// parseDateList 解析每行一个日期的列表，日期后可以跟说明，例如 "2025-10-01 国庆节"
+func parseDateList(b []byte) (map[string]bool, error) {
+	dates := make(map[string]bool)
+	scanner := bufio.NewScanner(bytes.NewReader(b))
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		field := strings.Fields(text)[0]
+		d, err := time.Parse(time.DateOnly, field)
+		if err != nil {
+			return nil, fmt.Errorf("第 %d 行的日期 %q 格式错误，应为 YYYY-MM-DD", line, field)
+		}
+		dates[d.Format(time.DateOnly)] = true
+	}
+	return dates, scanner.Err()
+}
+
+// parseICalDates 解析 iCal 中每个事件覆盖的日期 (DTSTART 到 DTEND，不含 DTEND)，不支持重复规则
+func parseICalDates(b []byte) (map[string]bool, error) {
+	// 展开折行：以空格或制表符开头的行是上一行的延续
+	text := strings.ReplaceAll(string(b), "\r\n", "\n")
+	text = strings.ReplaceAll(text, "\n ", "")
+	text = strings.ReplaceAll(text, "\n\t", "")
+
+	dates := make(map[string]bool)
+	var start, end time.Time
+	for _, line := range strings.Split(text, "\n") {
+		name, value, ok := strings.Cut(strings.TrimSpace(line), ":")
+		if !ok {
+			continue
+		}
+		prop, _, _ := strings.Cut(name, ";")
+		switch strings.ToUpper(prop) {
+		case "BEGIN":
+			if value == "VEVENT" {
+				start, end = time.Time{}, time.Time{}
+			}
+		case "DTSTART":
+			start = parseICalDate(value)
+		case "DTEND":
+			end = parseICalDate(value)
+		case "END":
+			if value != "VEVENT" || start.IsZero() {
+				continue
+			}
+			if !end.After(start) {
+				end = start.AddDate(0, 0, 1)
+			}
+			for d, n := start, 0; d.Before(end) && n < maxHolidaySpan; d, n = d.AddDate(0, 0, 1), n+1 {
+				dates[d.Format(time.DateOnly)] = true
+			}
+		}
+	}
+	if len(dates) == 0 {
+		return nil, fmt.Errorf("iCal 日历中没有找到任何事件")
+	}
+	return dates, nil
+}
+
+// parseICalDate 取 iCal 日期或日期时间值中的日期部分，例如 20251001 或 20251001T000000Z
+func parseICalDate(v string) time.Time {
+	if len(v) < 8 {
+		return time.Time{}
+	}
+	d, err := time.Parse("20060102", v[:8])
+	if err != nil {
+		return time.Time{}
+	}
+	return d
+}
+
+// holidayInfo 是接口返回的节假日日历状态
+type holidayInfo struct {
+	Name     string    `json:"name"`
+	Dates    int       `json:"dates"`
+	Upcoming []string  `json:"upcoming"`
+	LoadedAt time.Time `json:"loaded_at"`
+	Error    string    `json:"error,omitempty"`
+}
+
+// registerHolidayRoutes 注册节假日日历的查询接口
+func registerHolidayRoutes(r gin.IRoutes) {
+	// 列出配置的日历及接下来的几个节假日，便于确认日历已正确加载
+	r.GET("/api/holidays", func(ctx *gin.Context) {
+		names := make([]string, 0, len(holidaySources))
+		for name := range holidaySources {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		today := time.Now().Format(time.DateOnly)
+		list := []holidayInfo{}
+		for _, name := range names {
+			info := holidayInfo{Name: name, Upcoming: []string{}}
+			cal, err := loadHolidayCalendar(name)
+			if err != nil {
+				info.Error = err.Error()
+			}
+			if cal != nil {
+				info.Dates = len(cal.dates)
+				info.LoadedAt = cal.loadedAt
+				for d := range cal.dates {
+					if d >= today {
+						info.Upcoming = append(info.Upcoming, d)
+					}
+				}
+				sort.Strings(info.Upcoming)
+				info.Upcoming = info.Upcoming[:min(len(info.Upcoming), 5)]
+			}
+			list = append(list, info)
+		}
+		ctx.JSON(http.StatusOK, list)
+	})
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// allowScripts 表示是否允许任务使用请求预处理脚本。脚本可以读取任务的全部字段和请求体，默认关闭，
+// 由管理员通过 PIPIGO_ALLOW_SCRIPTS=true 开启。
+var allowScripts = os.Getenv("PIPIGO_ALLOW_SCRIPTS") == "true"
+
+// hookData 是预处理脚本中可以访问的数据
+type hookData struct {
+	TaskID      int
+	TaskName    string
+	Method      string
+	URL         string
+	Body        string
+	RequestID   string
+	Time        time.Time
+	Timestamp   int64 // 秒级 Unix 时间戳
+	TimestampMs int64 // 毫秒级 Unix 时间戳
+}
+
+// hookFuncs 是预处理脚本中可以使用的函数，只包含无副作用的编码和签名函数
+var hookFuncs = template.FuncMap{
+	"hmacSHA256": func(key, msg string) string {
+		return hex.EncodeToString(hmacSHA256([]byte(key), msg))
+	},
+	"hmacSHA256Base64": func(key, msg string) string {
+		return base64.StdEncoding.EncodeToString(hmacSHA256([]byte(key), msg))
+	},
+	"sha256": func(s string) string { return sha256Hex([]byte(s)) },
+	"md5": func(s string) string {
+		sum := md5.Sum([]byte(s))
+		return hex.EncodeToString(sum[:])
+	},
+	"base64": func(s string) string { return base64.StdEncoding.EncodeToString([]byte(s)) },
+	"upper":  strings.ToUpper,
+	"lower":  strings.ToLower,
+}
+
+// hookHeader 是预处理脚本中的一行: 请求头名称和用于计算其值的模板
+type hookHeader struct {
+	name string
+	tmpl *template.Template
+}
+
+// parsePreRequestScript 解析预处理脚本。脚本每行一个请求头，格式为 "Header-Name: 模板"，
+// 模板使用 Go text/template 语法，例如:
+//
+//	X-Timestamp: {{.Timestamp}}
+//	X-Signature: {{hmacSHA256 "secret" (printf "%d\n%s" .Timestamp .Body)}}
+//
+// 空行和以 # 开头的行会被忽略。
+func parsePreRequestScript(script string) ([]hookHeader, error) {
+	var headers []hookHeader
+	for i, line := range strings.Split(script, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		name, expr, found := strings.Cut(line, ":")
+		name = strings.TrimSpace(name)
+		if !found || name == "" || strings.ContainsAny(name, " \t") {
+			return nil, fmt.Errorf("第 %d 行格式错误，应为 \"Header-Name: 模板\"", i+1)
+		}
+		tmpl, err := template.New(name).Funcs(hookFuncs).Option("missingkey=error").Parse(strings.TrimSpace(expr))
+		if err != nil {
+			return nil, fmt.Errorf("第 %d 行模板错误: %v", i+1, err)
+		}
+		headers = append(headers, hookHeader{name: name, tmpl: tmpl})
+	}
+	return headers, nil
+}
+
+// validatePreRequestScript 检查任务的预处理脚本是否允许使用且语法正确
+func validatePreRequestScript(t *Task) error {
+	if strings.TrimSpace(t.PreRequestScript) == "" {
+		return nil
+	}
+	if !allowScripts {
+		return errors.New("服务端未开启请求预处理脚本，请由管理员设置 PIPIGO_ALLOW_SCRIPTS=true")
+	}
+	_, err := parsePreRequestScript(t.PreRequestScript)
+	return err
+}
+
+// applyPreRequestScript 在发送前执行任务的预处理脚本，并把计算结果设置为请求头
+func applyPreRequestScript(t *Task, req *http.Request, body []byte) error {
+	if strings.TrimSpace(t.PreRequestScript) == "" {
+		return nil
+	}
+	if !allowScripts {
+		return errors.New("服务端未开启请求预处理脚本")
+	}
+	headers, err := parsePreRequestScript(t.PreRequestScript)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	data := hookData{
+		TaskID:      t.ID,
+		TaskName:    t.Name,
+		Method:      req.Method,
+		URL:         req.URL.String(),
+		Body:        string(body),
+		RequestID:   req.Header.Get("X-Request-Id"),
+		Time:        now,
+		Timestamp:   now.Unix(),
+		TimestampMs: now.UnixMilli(),
+	}
+	for _, h := range headers {
+		var value bytes.Buffer
+		if err := h.tmpl.Execute(&value, data); err != nil {
+			return fmt.Errorf("计算请求头 %s 失败: %v", h.name, err)
+		}
+		req.Header.Set(h.name, value.String())
+	}
+	return nil
+}
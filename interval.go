@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"time"
+)
+
+// intervalTimer 是间隔模式任务的定时器：任务在上一次执行完成后等待固定的间隔再执行，
+// 不会像 Cron 那样在执行耗时较长时发生重叠
+type intervalTimer struct {
+	timer *time.Timer
+	next  time.Time // 下一次计划执行的时间
+	prev  time.Time // 上一次计划执行的时间，与 Cron 条目的 Prev 含义相同，重新注册后为零值
+}
+
+// intervalTimers 保存间隔模式任务的定时器，与 cronIDs 一样由 taskMutex 保护
+var intervalTimers = make(map[int]*intervalTimer)
+
+// registerIntervalTask 将间隔模式的任务加入调度，第一次执行在一个间隔之后
+func registerIntervalTask(t *Task) {
+	taskMutex.Lock()
+	scheduleInterval(t.ID, time.Duration(t.IntervalSeconds)*time.Second)
+	taskMutex.Unlock()
+	fmt.Printf("任务 #%d (%s) 已成功注册, 间隔: 上次执行完成后 %d 秒\n", t.ID, t.Name, t.IntervalSeconds)
+}
+
+// scheduleInterval 安排任务在 delay 之后执行，执行完成后按任务当前的间隔安排下一次。
+// 任务在执行期间被移除 (删除、过期等) 时不再安排。调用方需持有 taskMutex。
+func scheduleInterval(id int, delay time.Duration) {
+	it := &intervalTimer{next: time.Now().Add(delay)}
+	it.timer = time.AfterFunc(delay, func() {
+		runIntervalTask(id, it.next)
+
+		taskMutex.Lock()
+		defer taskMutex.Unlock()
+		t, ok := tasks[id]
+		if ok && intervalTimers[id] == it {
+			scheduleInterval(id, time.Duration(t.IntervalSeconds)*time.Second)
+			intervalTimers[id].prev = it.next
+		}
+	})
+	intervalTimers[id] = it
+}
+
+// runIntervalTask 执行间隔模式任务的一次触发。与 Cron 作业一样，执行中的 panic 被捕获并连同调用栈一起记录，
+// 不会导致程序退出，之后仍会照常安排下一次执行
+func runIntervalTask(id int, scheduledAt time.Time) {
+	defer func() {
+		if r := recover(); r != nil {
+			buf := make([]byte, 64<<10)
+			buf = buf[:runtime.Stack(buf, false)]
+			cronLogger{}.Error(fmt.Errorf("任务 #%d 执行时发生 panic: %v", id, r), "panic", "stack", "...\n"+string(buf))
+		}
+	}()
+	runTask(id, runOptions{Trigger: triggerSchedule, ScheduledAt: scheduledAt})
+}
+
+// isScheduled 判断任务当前是否在调度中 (Cron 或间隔模式)，调用方需持有 taskMutex
+func isScheduled(id int) bool {
+	_, inCron := cronIDs[id]
+	_, inInterval := intervalTimers[id]
+	return inCron || inInterval
+}
+
+// unschedule 将任务从调度中移除 (Cron 或间隔模式)，调用方需持有 taskMutex
+func unschedule(id int) {
+	if entryID, ok := cronIDs[id]; ok {
+		c.Remove(entryID)
+		delete(cronIDs, id)
+	}
+	if it, ok := intervalTimers[id]; ok {
+		it.timer.Stop()
+		delete(intervalTimers, id)
+	}
+}
+
+// nextRun 返回任务的下一次执行时间，未调度时返回零值，调用方需持有 taskMutex
+func nextRun(id int) time.Time {
+	if entryID, ok := cronIDs[id]; ok {
+		return c.Entry(entryID).Next
+	}
+	if it, ok := intervalTimers[id]; ok {
+		return it.next
+	}
+	return time.Time{}
+}
+
+// prevRun 返回调度器记录的任务上一次触发的计划时间，注册后尚未触发或未调度时返回零值，调用方需持有 taskMutex。
+// 它反映调度器的视角，与日志中的执行时间不同：触发后被跳过或仍在执行中时可能没有对应的日志
+func prevRun(id int) time.Time {
+	if entryID, ok := cronIDs[id]; ok {
+		return c.Entry(entryID).Prev
+	}
+	if it, ok := intervalTimers[id]; ok {
+		return it.prev
+	}
+	return time.Time{}
+}
+
+// describeSchedule 返回任务执行计划的中文描述
+func describeSchedule(t *Task) string {
+	if t.IntervalSeconds > 0 {
+		return fmt.Sprintf("上次执行完成后间隔 %s", time.Duration(t.IntervalSeconds)*time.Second)
+	}
+	return describeCron(t.CronExpr)
+}
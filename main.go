@@ -2,15 +2,27 @@ package main
 
 import (
 	"bytes"
+	"crypto/rand"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/robfig/cron/v3"
+	"gorm.io/driver/mysql"
+	"gorm.io/driver/postgres"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 )
@@ -26,263 +38,2265 @@ type Task struct {
 	Headers string `json:"headers" gorm:"type:text"` // 请求头 (JSON string)
 	Body    string `json:"body" gorm:"type:text"`    // 请求体 (JSON string)
 	Timeout int    `json:"timeout"`                  // 超时时间 (秒)
+	// 请求体类型: json (默认)、form (application/x-www-form-urlencoded) 或 raw (原样发送)
+	BodyType string `json:"body_type"`
+	// 过期时间，到期后任务会被自动停止调度 (零值表示永不过期)
+	ExpireAt time.Time `json:"expire_at"`
+	// 执行成功/失败后回调的地址，常用于对接心跳监控服务，为空表示不回调
+	OnSuccessURL string `json:"on_success_url"`
+	OnFailureURL string `json:"on_failure_url"`
+	// 失败重试次数，以及滚动窗口内允许的重试预算 (预算为0表示不限制，窗口单位为秒)
+	MaxRetries        int `json:"max_retries"`
+	RetryBudget       int `json:"retry_budget"`
+	RetryBudgetWindow int `json:"retry_budget_window"`
+	// 首次重试前的等待时间 (毫秒)，之后每次重试翻倍，为0时使用默认的1秒
+	RetryDelayMs int `json:"retry_delay_ms"`
+	// 非幂等的请求 (POST、PATCH) 默认只在请求尚未送达 (连接失败、连接或 TLS 握手超时) 时重试，避免重复写入；
+	// 确认接口幂等后开启此项，与其他请求一样在响应超时、5xx 和 429 时也重试
+	IdempotentRetry bool `json:"idempotent_retry"`
+	// 连接级超时 (秒)，为0表示不单独限制。ResponseHeaderTimeout 是发出请求后等待响应头的时间，
+	// 服务端接受连接却迟迟不返回响应头时尽快失败，而不是等到 Timeout；IdleConnTimeout 是空闲连接保留复用的时间
+	ResponseHeaderTimeout int `json:"response_header_timeout"`
+	IdleConnTimeout       int `json:"idle_conn_timeout"`
+	// 跳过 TLS 证书校验，仅用于使用自签名证书的可信内部服务，默认校验证书
+	InsecureSkipVerify bool `json:"insecure_skip_verify"`
+	// 是否跟随重定向，未设置 (旧任务和导入的任务) 时跟随。不跟随时记录 3xx 状态和 Location，
+	// 跟随时最多跟随 MaxRedirects 次，为0时使用默认的10次
+	FollowRedirects *bool `json:"follow_redirects" gorm:"default:true"`
+	MaxRedirects    int   `json:"max_redirects"`
+	// 任务说明和备注 (例如负责人、运行手册链接)，仅作为元数据展示
+	Description string `json:"description" gorm:"type:text"`
+	Notes       string `json:"notes" gorm:"type:text"`
+	// 订阅的通知渠道名称，多个用逗号分隔
+	Channels string `json:"channels"`
+	// 持续失败时的重复通知节流：首次失败立即通知，之后距上次通知超过 NotifyThrottleMinutes 分钟，
+	// 或自上次通知以来又连续失败 NotifyFailureThreshold 次时再次通知。两者都为0表示不重复通知。
+	NotifyThrottleMinutes  int `json:"notify_throttle_minutes"`
+	NotifyFailureThreshold int `json:"notify_failure_threshold"`
+	// 每次执行失败时以 POST 方式发送 JSON 通知的地址 (例如事件频道的 webhook)，不受通知节流影响，为空表示不发送
+	NotifyWebhookURL string `json:"notify_webhook_url"`
+	// 合并窗口 (秒)：定时执行和手动执行在该时间内先后开始时，后开始的一次跳过并记录为已合并，为0表示不合并
+	CoalesceSeconds int `json:"coalesce_seconds"`
+	// 响应时间异常检测：成功执行的耗时超过近期基线的均值加 AnomalyK 倍标准差时标记为异常，为0表示不检测。
+	// AnomalyNotify 开启时，进入和退出异常状态时各发送一次通知
+	AnomalyK      float64 `json:"anomaly_k"`
+	AnomalyNotify bool    `json:"anomaly_notify"`
+	// 由任务配置文件 (PIPIGO_TASKS_DIR) 管理的任务所在的文件名，这类任务只能通过修改文件变更；通过接口创建的任务为空
+	Source string `json:"source" gorm:"index;size:191"`
+	// 置顶的任务在列表中排在最前面
+	Pinned bool `json:"pinned"`
+	// 禁用的任务不再调度，但保留配置和日志，仍可手动执行
+	Enabled bool `json:"enabled" gorm:"default:true"`
+	// 失败采样：连续出现相同的失败时只完整保存第一条的响应体，后续只记录状态和对第一条的引用
+	SampleFailures bool `json:"sample_failures"`
+	// 请求预处理脚本，每行计算一个请求头 (例如时间戳和签名)，需服务端开启 PIPIGO_ALLOW_SCRIPTS
+	PreRequestScript string `json:"pre_request_script" gorm:"type:text"`
+	// 启用请求模板：URL、请求头和请求体按 Go text/template 语法在每次执行前渲染，例如 {{.UnixMs}}、{{.Date "2006-01-02"}}
+	Templated bool `json:"templated"`
+	// 从 JSON 响应中提取的命名字段，提取结果保存在每条日志中，作为执行历史的列展示
+	Extractions []Extraction `json:"extractions" gorm:"serializer:json"`
+	// 所属项目，为空表示未分组
+	ProjectID *int `json:"project_id" gorm:"index"`
+	// 任务的所有者，启用认证后普通用户只能查看和管理自己的任务
+	OwnerID int `json:"owner_id" gorm:"index"`
+	// Cron 表达式模板，设置后 CronExpr 在创建任务时由模板计算得到并固定下来，例如 "0 {{mod .ID 60}} * * * *"
+	CronTemplate string `json:"cron_template"`
+	// 请求体地址，设置后每次执行前先从该地址获取请求体 (GET)，代替 Body 发送，仅对 POST 请求有效
+	BodyURL string `json:"body_url"`
+	// 间隔模式：大于0时不使用 Cron 表达式，而是在上一次执行完成后等待该秒数再执行，适合耗时较长或不固定的任务
+	IntervalSeconds int `json:"interval_seconds"`
+	// 日志保留天数，超过的日志会被定期清理，为0时使用默认值 (PIPIGO_LOG_RETENTION_DAYS，默认永久保留)
+	RetentionDays int `json:"retention_days"`
+	// 保存的响应体大小上限 (字节)，超出部分被截断，为0时使用默认值 (PIPIGO_MAX_BODY_BYTES，默认 1MB)
+	MaxBodyBytes int `json:"max_body_bytes"`
+	// 保存响应体的 Content-Type 前缀，逗号分隔，例如 "application/json,text/"，其他类型只记录类型和大小。
+	// 为空时使用默认值 (PIPIGO_BODY_CONTENT_TYPES，默认全部保存)，"*" 表示全部保存
+	BodyContentTypes string `json:"body_content_types"`
+	// 视为成功的响应状态码，例如 "200-299,304,418"，为空时只有 2xx 视为成功。
+	// 包含 3xx 时请求不再跟随重定向，按重定向响应本身判断
+	SuccessStatusRanges string `json:"success_status_ranges"`
+	// 按响应头判断健康状态：状态码成功时还要求响应头 ExpectHeader 的值与 ExpectHeaderValue 相同，
+	// ExpectHeaderValue 写成 /正则表达式/ 时按正则匹配
+	ExpectHeader      string `json:"expect_header"`
+	ExpectHeaderValue string `json:"expect_header_value"`
+	// 响应断言：ExpectStatus 不为0时要求状态码等于该值 (代替 SuccessStatusRanges)，ExpectBodyContains 不为空时要求响应体包含该内容。
+	// 不满足时本次执行记为失败，状态文本中注明断言失败的原因
+	ExpectStatus       int    `json:"expect_status"`
+	ExpectBodyContains string `json:"expect_body_contains" gorm:"type:text"`
+	// 响应校验规则，与状态码和响应头的判断一起按顺序检查，全部通过才视为成功；包含 status 规则时代替 SuccessStatusRanges
+	Validators []Validator `json:"validators" gorm:"serializer:json"`
+	// OAuth2 客户端凭据模式：配置令牌地址后，每次请求前自动获取访问令牌并设置 Authorization 请求头，
+	// 令牌会被缓存到过期为止。客户端密钥在接口响应中会被隐藏，授权范围以空格或逗号分隔
+	OAuthTokenURL     string `json:"oauth_token_url" gorm:"column:oauth_token_url"`
+	OAuthClientID     string `json:"oauth_client_id" gorm:"column:oauth_client_id"`
+	OAuthClientSecret string `json:"oauth_client_secret" gorm:"column:oauth_client_secret"`
+	OAuthScopes       string `json:"oauth_scopes" gorm:"column:oauth_scopes"`
+	// AWS SigV4 签名：填写访问密钥ID后，每次请求按 AWS Signature Version 4 签名，用于直接调用 AWS 或要求 SigV4 的接口。
+	// 密钥在接口响应和导出中隐藏
+	SigV4AccessKey string `json:"sigv4_access_key" gorm:"column:sigv4_access_key"`
+	SigV4SecretKey string `json:"sigv4_secret_key" gorm:"column:sigv4_secret_key"`
+	SigV4Region    string `json:"sigv4_region" gorm:"column:sigv4_region"`   // 例如 us-east-1
+	SigV4Service   string `json:"sigv4_service" gorm:"column:sigv4_service"` // 例如 execute-api、lambda、s3
+	// 功能开关：配置后每次定时执行前先请求该地址，开关关闭时跳过本次执行 (手动执行不受影响)。
+	// GuardFlagPath 为空时地址返回 2xx 即视为开启，否则取 JSON 响应中该字段的值判断
+	GuardFlagURL  string `json:"guard_flag_url"`
+	GuardFlagPath string `json:"guard_flag_path"`
+	// 节假日跳过：开启后定时执行的当天在节假日日历中时跳过本次执行 (手动执行不受影响)。
+	// HolidayCalendar 为 PIPIGO_HOLIDAY_CALENDARS 中配置的日历名称，为空时使用默认日历
+	SkipHolidays    bool   `json:"skip_holidays"`
+	HolidayCalendar string `json:"holiday_calendar"`
+	// 除 URL 外同时请求的其他地址 (例如各个地区的节点)，每次触发会扇出到所有地址，每个地址各记录一条日志
+	URLs []string `json:"urls" gorm:"serializer:json"`
+	// Cron 表达式使用的时区 (IANA 名称，例如 Asia/Shanghai 或 UTC)，为空时使用服务器的本地时区
+	Timezone string `json:"timezone"`
 
-	Logs    []Log     `json:"logs" gorm:"foreignKey:TaskID;constraint:OnDelete:CASCADE"`
-	NextRun time.Time `json:"next_run"`
+	Logs      []Log     `json:"logs" gorm:"foreignKey:TaskID;constraint:OnDelete:CASCADE"`
+	NextRun   time.Time `json:"next_run"`
+	PrevRun   time.Time `json:"prev_run" gorm:"-"` // 调度器记录的上一次触发的计划时间
+	CreatedAt time.Time `json:"created_at"`
+	Flapping  bool      `json:"flapping" gorm:"-"` // 最近执行结果是否频繁在成功和失败之间切换
+	// Cron 表达式的中文描述，仅用于展示
+	CronDescription string `json:"cron_description" gorm:"-"`
+
+	correlationID  string    // 本次执行的关联ID，只存在于执行时的任务拷贝中
+	scheduledSince time.Time // 最近一次注册到调度器的时间，调度自检不统计此前的触发
 }
 
 // Log 定义了任务执行日志的结构
 type Log struct {
-	ID           int       `json:"id" gorm:"primaryKey"`
-	TaskID       int       `json:"task_id"`
-	Time         time.Time `json:"time"`
-	StatusText   string    `json:"status_text"`                    // 简短的状态文本，例如 "状态: 200"
-	ResponseBody string    `json:"response_body" gorm:"type:text"` // 完整的响应体
+	ID            int       `json:"id" gorm:"primaryKey"`
+	TaskID        int       `json:"task_id" gorm:"index:idx_logs_task_time,priority:1"`
+	Time          time.Time `json:"time" gorm:"index:idx_logs_task_time,priority:2"`
+	StatusText    string    `json:"status_text"`                    // 简短的状态文本，例如 "状态: 200"
+	Success       bool      `json:"success" gorm:"index"`           // 本次请求是否成功 (收到响应且符合任务的成功条件)，连接失败、超时和跳过均为 false
+	ResponseBody  string    `json:"response_body"`                  // 完整的响应体
+	DurationMs    int64     `json:"duration_ms"`                    // 请求耗时 (毫秒)
+	RequestID     string    `json:"request_id"`                     // 随请求发送的 X-Request-Id，便于下游去重和追踪
+	Trigger       string    `json:"trigger"`                        // 触发方式: schedule (定时) 或 manual (手动)
+	ScheduledAt   time.Time `json:"scheduled_at"`                   // 定时触发时计划的执行时间
+	LagMs         int64     `json:"lag_ms"`                         // 实际开始执行相对计划时间的延迟 (毫秒)
+	SampleOfID    int       `json:"sample_of"`                      // 与该日志的失败相同，响应体已省略，为0表示保存了完整响应体
+	RequestBytes  int       `json:"request_bytes"`                  // 发送的请求体大小 (字节)
+	RateLimited   bool      `json:"rate_limited"`                   // 本次执行是否收到过 429 限流响应
+	Skipped       bool      `json:"skipped"`                        // 本次执行被跳过 (例如全局熔断)，没有发出请求
+	TimeoutSec    int       `json:"timeout"`                        // 本次执行实际使用的超时时间 (秒)
+	TimeoutKind   string    `json:"timeout_kind"`                   // 请求超时的类型: connect、tls_handshake、response_header 或 total，未超时为空
+	URL           string    `json:"url"`                            // 本次请求的地址，任务扇出到多个地址时用于区分
+	BodyHash      string    `json:"body_hash" gorm:"index;size:64"` // 响应体的 SHA-256，与上一次相同时 ResponseBody 只保存哈希引用
+	ResponseBytes int64     `json:"response_bytes"`                 // 收到的响应体大小 (字节)
+	// 按任务的提取配置从响应中取出的字段值
+	Extracted map[string]any `json:"extracted" gorm:"serializer:json"`
+	// 任务配置了校验规则时，每条规则的检查结果
+	Validations []ValidationResult `json:"validations,omitempty" gorm:"serializer:json"`
+	// 本次执行的关联ID：由触发方通过 X-Correlation-Id 传入，未传入时自动生成，并随请求转发给目标
+	CorrelationID string `json:"correlation_id" gorm:"index;size:191"`
+	// 本次执行因与另一次执行合并而跳过时，另一次执行的关联ID
+	CoalescedWith string `json:"coalesced_with,omitempty"`
+	// 跟随重定向后最终请求的地址，没有发生重定向时为空
+	FinalURL string `json:"final_url,omitempty"`
+	// 耗时明显超过任务近期的响应时间基线
+	Anomaly bool `json:"anomaly,omitempty"`
+	// 实际发送的请求头和收到的响应头 (JSON 对象)，凭据类的值已隐藏，超过 PIPIGO_LOG_HEADER_BYTES 的部分省略
+	RequestHeaders  string `json:"request_headers,omitempty" gorm:"type:text"`
+	ResponseHeaders string `json:"response_headers,omitempty" gorm:"type:text"`
+
+	retryAfter time.Duration // 限流响应中 Retry-After 要求的等待时间，仅在重试时使用
+	statusCode int           // 响应状态码，没有收到响应时为0，用于判断失败是否值得重试
 }
 
+// recentLogLimit 是任务列表中每个任务附带的最近日志条数
+const recentLogLimit = 20
+
 var (
 	db        *gorm.DB
+	readDB    *gorm.DB // 只读连接，供读多写少的查询使用，避免被日志写入阻塞
 	tasks     = make(map[int]*Task)
 	cronIDs   = make(map[int]cron.EntryID)
 	taskMutex sync.Mutex
-	c         = cron.New(cron.WithSeconds())
+	// cronParser 与调度器使用同一套解析规则 (支持秒字段)，用于在保存前校验表达式
+	cronParser = cron.NewParser(cron.Second | cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor)
+	// 作业中的 panic 由 Recover 捕获并记录，不会导致程序退出
+	c = cron.New(cron.WithParser(cronParser), cron.WithLogger(cronLogger{}), cron.WithChain(cron.Recover(cronLogger{})))
+
+	// minInterval 是任务两次执行之间允许的最小间隔，默认为0表示不限制。启用后已有的更频繁的任务照常执行，
+	// 但修改、批量修改或重新导入时会被拒绝，需要先调整执行计划
+	minInterval = envDuration("PIPIGO_MIN_INTERVAL", 0)
+	// lateThreshold 是定时触发允许的最大延迟，超过视为延迟触发
+	lateThreshold = envDuration("PIPIGO_LATE_THRESHOLD", 5*time.Second)
+	// defaultMaxBodyBytes 是任务未设置 MaxBodyBytes 时读取的响应体大小上限
+	defaultMaxBodyBytes = envInt("PIPIGO_MAX_BODY_BYTES", 1<<20)
+	// maxConcurrency 是所有任务同时进行的请求数上限 (包括扇出到多个地址的请求)，设置为0表示不限制
+	maxConcurrency = envInt("PIPIGO_MAX_CONCURRENCY", 0)
+	requestSlots   = make(chan struct{}, max(maxConcurrency, 1))
+
+	// listenSocket 不为空时，服务监听该路径的 Unix socket 而不是 TCP 端口
+	listenSocket = os.Getenv("PIPIGO_LISTEN_SOCKET")
+	// listenAddr 是服务监听的 TCP 地址
+	listenAddr = envString("PIPIGO_ADDR", "0.0.0.0:8899")
+	// dbDriver 是数据库类型: sqlite (默认)、mysql 或 postgres，后两者通过 PIPIGO_DSN 连接，可以在多个实例间共享
+	dbDriver = envString("PIPIGO_DB_DRIVER", "sqlite")
+	dbDSN    = os.Getenv("PIPIGO_DSN")
+	// dbPath 是 SQLite 数据库文件的路径，同一台机器上运行多个实例时需要分别设置
+	dbPath = envString("PIPIGO_DB_PATH", "db/tasks.db")
+	// 页面的默认主题 (light 或 dark)，用户在页面上切换后以浏览器保存的选择为准
+	defaultTheme = envTheme("PIPIGO_DEFAULT_THEME")
+
+	// startTime 是进程启动时间，进程未运行期间错过的触发不计入调度器自检
+	startTime = time.Now()
 )
 
-func main() {
+// openDatabase 打开数据库的读写连接和只读连接，并自动迁移表结构
+func openDatabase() error {
+	var dialector gorm.Dialector
+	switch dbDriver {
+	case "sqlite":
+		if err := os.MkdirAll(filepath.Dir(dbPath), 0o755); err != nil {
+			return fmt.Errorf("创建数据库目录失败: %v", err)
+		}
+		// 使用 WAL 模式，读操作不会被写操作阻塞
+		dialector = sqlite.Open(dbPath + "?_journal_mode=WAL&_busy_timeout=5000")
+	case "mysql", "postgres":
+		if dbDSN == "" {
+			return fmt.Errorf("PIPIGO_DB_DRIVER=%s 时必须通过 PIPIGO_DSN 设置数据库连接串", dbDriver)
+		}
+		if dbDriver == "mysql" {
+			dialector = mysql.Open(dbDSN)
+		} else {
+			dialector = postgres.Open(dbDSN)
+		}
+	default:
+		return fmt.Errorf("不支持的数据库类型 %q，支持 sqlite、mysql 和 postgres", dbDriver)
+	}
 	var err error
-	db, err = gorm.Open(sqlite.Open("db/tasks.db"), &gorm.Config{})
+	db, err = gorm.Open(dialector, &gorm.Config{})
 	if err != nil {
-		panic("连接数据库失败: " + err.Error())
+		return fmt.Errorf("连接数据库失败: %v", err)
 	}
 
 	// 自动迁移数据库结构
-	db.AutoMigrate(&Task{}, &Log{})
+	if err := migrateDatabase(); err != nil {
+		return err
+	}
+	seedUsers()
+
+	// MySQL 和 PostgreSQL 本身支持并发读写，读操作直接使用同一个连接池
+	if !usingSQLite() {
+		readDB = db
+		return nil
+	}
+	// 打开独立的只读连接，必须在迁移之后打开，确保数据库文件和表结构已存在
+	readDB, err = gorm.Open(sqlite.Open("file:"+dbPath+"?mode=ro&_busy_timeout=5000"), &gorm.Config{})
+	if err != nil {
+		return fmt.Errorf("打开只读数据库连接失败: %v", err)
+	}
+	return nil
+}
+
+// usingSQLite 判断是否使用 SQLite，数据库文件的备份、恢复和大小统计只在 SQLite 下可用
+func usingSQLite() bool {
+	return dbDriver == "sqlite"
+}
+
+func main() {
+	if err := openDatabase(); err != nil {
+		fmt.Printf("启动失败: %v\n", err)
+		os.Exit(1)
+	}
 
 	// 启动时从数据库加载任务
 	loadTasksFromDB()
 
 	r := gin.Default()
+	// 恢复数据库期间暂停处理请求，正在处理的请求结束后才会替换数据库
+	r.Use(holdDatabase())
+
+	// 存活检查，供 Kubernetes 等探测使用：只检查数据库能否连通，不执行任何任务。
+	// 在 Basic Auth 之前注册，不需要凭据
+	r.GET("/healthz", func(ctx *gin.Context) {
+		sqlDB, err := db.DB()
+		if err == nil {
+			err = sqlDB.Ping()
+		}
+		if err != nil {
+			ctx.JSON(http.StatusServiceUnavailable, gin.H{"status": "error", "error": err.Error()})
+			return
+		}
+		taskMutex.Lock()
+		n := len(tasks)
+		taskMutex.Unlock()
+		ctx.JSON(http.StatusOK, gin.H{"status": "ok", "tasks": n})
+	})
+
+	// 任务的只读分享页面，持有分享链接即可访问，不需要任何凭据
+	registerSharedViewRoutes(r)
+
+	// 配置了 Basic Auth 时，除存活检查和分享页面外的所有页面和接口都需要凭据
+	if mw := basicAuth(); mw != nil {
+		r.Use(mw)
+	}
+
+	// Prometheus 抓取接口，不需要登录 (配置了 Basic Auth 时仍需要凭据)
+	registerMetricsRoutes(r)
 
 	// 提供静态文件服务
 	r.Static("/js", "./static/js")
 
 	// 首页
 	r.GET("/", func(ctx *gin.Context) {
-		ctx.Data(http.StatusOK, "text/html; charset=utf-8", []byte(htmlPage))
+		ctx.Data(http.StatusOK, "text/html; charset=utf-8", indexPage)
 	})
 
-	// 获取所有任务
-	r.GET("/api/tasks", func(ctx *gin.Context) {
+	// 除登录接口外的所有接口都需要登录 (启用认证时)
+	api := r.Group("", authRequired())
+	registerAuthRoutes(r, api)
+
+	// 获取当前用户的任务，管理员可以通过 all=true 查看所有用户的任务
+	api.GET("/api/tasks", func(ctx *gin.Context) {
 		var list []Task
-		// 预加载日志并按时间倒序排序
-		db.Preload("Logs", func(db *gorm.DB) *gorm.DB {
-			return db.Order("logs.time DESC")
-		}).Order("id DESC").Find(&list)
+		// 预加载每个任务最近的日志并按时间倒序排序，走只读连接；更早的日志通过分页接口查看
+		query := readDB.Preload("Logs", func(db *gorm.DB) *gorm.DB {
+			return db.Where(`logs.id IN (SELECT id FROM (
+				SELECT id, ROW_NUMBER() OVER (PARTITION BY task_id ORDER BY time DESC, id DESC) AS rn FROM logs
+			) AS recent WHERE rn <= ?)`, recentLogLimit).Order("logs.time DESC")
+		}).Order("pinned DESC").Order("id DESC")
+		if user := currentUser(ctx); user != nil && !(user.IsAdmin && ctx.Query("all") == "true") {
+			query = query.Where("owner_id = ?", user.ID)
+		}
+		// 按名称或地址搜索 (不区分大小写的子串匹配)，为空时返回所有任务
+		if search := strings.TrimSpace(ctx.Query("search")); search != "" {
+			pattern := "%" + escapeLike(strings.ToLower(search)) + "%"
+			query = query.Where("(LOWER(name) LIKE ? ESCAPE '!' OR LOWER(url) LIKE ? ESCAPE '!')", pattern, pattern)
+		}
+		query.Find(&list)
 
 		// 更新每个任务的下一次执行时间
 		taskMutex.Lock()
 		for i := range list {
-			if entryID, ok := cronIDs[list[i].ID]; ok {
-				list[i].NextRun = c.Entry(entryID).Next
-			}
+			list[i].NextRun = inTaskZone(&list[i], nextRun(list[i].ID))
+			list[i].PrevRun = inTaskZone(&list[i], prevRun(list[i].ID))
 		}
 		taskMutex.Unlock()
+		for i := range list {
+			list[i].Flapping = isFlapping(list[i].ID)
+			list[i].CronDescription = describeSchedule(&list[i])
+			list[i] = maskTask(list[i])
+		}
 
 		ctx.JSON(http.StatusOK, list)
 	})
 
 	// 添加新任务
-	r.POST("/api/tasks", func(ctx *gin.Context) {
-		var req Task
+	api.POST("/api/tasks", func(ctx *gin.Context) {
+		// 未指定 enabled 时任务默认启用
+		req := Task{Enabled: true}
 		if err := ctx.ShouldBindJSON(&req); err != nil {
 			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
 
-		if req.Name == "" || req.CronExpr == "" || req.URL == "" {
-			ctx.JSON(http.StatusBadRequest, gin.H{"error": "任务名称、Cron表达式和URL是必填项"})
+		if err := validateTask(&req); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
-
-		if req.Timeout <= 0 {
-			req.Timeout = 10 // 默认超时时间10秒
+		// 任务归属于创建它的用户，转移归属需通过专门的接口；通过接口创建的任务不由配置文件管理
+		req.Source = ""
+		req.OwnerID = 0
+		if user := currentUser(ctx); user != nil {
+			req.OwnerID = user.ID
 		}
 
-		if err := db.Create(&req).Error; err != nil {
+		if err := insertTask(db, &req); err != nil {
 			ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
+		if err := finalizeCronTemplate(&req); err != nil {
+			db.Delete(&req)
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
 
 		registerTask(&req)
-		ctx.JSON(http.StatusOK, req)
+		// run_now=true 时创建后立即执行一次并等待结果，便于确认任务配置正确 (同样受全局并发上限约束)
+		if ctx.Query("run_now") != "true" {
+			ctx.JSON(http.StatusOK, maskTask(req))
+			return
+		}
+		opts := runOptions{Trigger: triggerManual, CorrelationID: newRequestID()}
+		runTask(req.ID, opts)
+		var first Log
+		if err := readDB.Where("task_id = ? AND correlation_id = ?", req.ID, opts.CorrelationID).Order("id").First(&first).Error; err != nil {
+			ctx.JSON(http.StatusOK, gin.H{"task": maskTask(req), "log": nil})
+			return
+		}
+		ctx.JSON(http.StatusOK, gin.H{"task": maskTask(req), "log": first})
+	})
+
+	// 用给定的响应模拟一次执行，返回日志将会记录的内容，不发出任何请求，用于调试成功判断和提取字段
+	api.POST("/api/tasks/:id/simulate", func(ctx *gin.Context) {
+		task, ok := findTask(ctx)
+		if !ok {
+			return
+		}
+		var req struct {
+			Status  int               `json:"status"`
+			Headers map[string]string `json:"headers"`
+			Body    string            `json:"body"`
+		}
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if req.Status == 0 {
+			req.Status = http.StatusOK
+		}
+		if req.Status < 100 || req.Status > 599 {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "状态码无效"})
+			return
+		}
+		header := make(http.Header)
+		for key, value := range req.Headers {
+			header.Set(key, value)
+		}
+
+		entry := &Log{TaskID: task.ID, Time: time.Now(), URL: task.URL, Trigger: triggerSimulate, TimeoutSec: task.Timeout}
+		success := evaluateResponse(&task, entry, req.Status, header, []byte(req.Body))
+		entry.Success = success
+		result := gin.H{"success": success, "log": entry, "would_retry": !success && task.MaxRetries > 0 && retryable(&task, entry)}
+		if entry.retryAfter > 0 {
+			result["retry_after"] = entry.retryAfter.String()
+		}
+		ctx.JSON(http.StatusOK, result)
+	})
+
+	// 修改任务，保留任务的日志。调度会按新的 Cron 表达式或间隔重新注册
+	api.PUT("/api/tasks/:id", func(ctx *gin.Context) {
+		old, ok := findTask(ctx)
+		if !ok || rejectFileTask(ctx, &old) {
+			return
+		}
+		var req Task
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		// ID、归属、置顶、启用状态和创建时间不能通过修改接口变更；提交被隐藏的密钥时沿用原来的密钥
+		req.ID = old.ID
+		req.OwnerID = old.OwnerID
+		req.Pinned = old.Pinned
+		req.Enabled = old.Enabled
+		req.CreatedAt = old.CreatedAt
+		req.Source = old.Source
+		req.Logs = nil
+		keepMaskedSecrets(&req, old)
+		if err := keepCronTemplate(&req, old); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := validateTask(&req); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err := db.Save(&req).Error; err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if err := rescheduleTask(&req); err != nil {
+			db.Save(&old)
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		// 地址或响应处理方式可能已经变化，之前的去重和采样状态不再适用
+		clearFailureSample(req.ID)
+		clearBodyHashes(req.ID)
+		clearOAuthToken(req.ID)
+		if req.Name != old.Name {
+			clearTaskMetrics(req.ID)
+		}
+
+		ctx.JSON(http.StatusOK, maskTask(req))
+	})
+
+	// 复制任务：复制全部配置创建一个新任务，名称加上 " (副本)"，不复制日志和置顶状态，新任务归属于当前用户
+	api.POST("/api/tasks/:id/clone", func(ctx *gin.Context) {
+		task, ok := findTask(ctx)
+		if !ok {
+			return
+		}
+		clone := task
+		clone.ID = 0
+		clone.Logs = nil
+		clone.CreatedAt = time.Time{}
+		clone.Pinned = false
+		clone.Source = ""
+		clone.Name = task.Name + " (副本)"
+		clone.OwnerID = 0
+		if user := currentUser(ctx); user != nil {
+			clone.OwnerID = user.ID
+		}
+		if err := validateTask(&clone); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err := insertTask(db, &clone); err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if err := finalizeCronTemplate(&clone); err != nil {
+			db.Delete(&clone)
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		registerTask(&clone)
+		ctx.JSON(http.StatusOK, maskTask(clone))
 	})
 
 	// 删除任务
-	r.DELETE("/api/tasks/:id", func(ctx *gin.Context) {
-		var task Task
-		if err := db.First(&task, ctx.Param("id")).Error; err != nil {
-			ctx.JSON(http.StatusNotFound, gin.H{"error": "任务不存在"})
+	api.DELETE("/api/tasks/:id", func(ctx *gin.Context) {
+		task, ok := findTask(ctx)
+		if !ok || rejectFileTask(ctx, &task) {
+			return
+		}
+		deleteTask(task)
+		ctx.JSON(http.StatusOK, gin.H{"message": "任务已删除"})
+	})
+
+	// 立即执行任务，可以通过 timeout 参数 (秒) 临时指定本次执行的超时时间，用于排查接近超时的任务
+	api.POST("/api/tasks/:id/run", func(ctx *gin.Context) {
+		task, ok := findTask(ctx)
+		if !ok {
+			return
+		}
+		opts := runOptions{Trigger: triggerManual, CorrelationID: strings.TrimSpace(ctx.GetHeader("X-Correlation-Id"))}
+		if opts.CorrelationID == "" {
+			opts.CorrelationID = newRequestID()
+		} else if !correlationIDPattern.MatchString(opts.CorrelationID) {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "X-Correlation-Id 只能包含字母、数字和 ._:/=+- 字符，且不超过128个字符"})
+			return
+		}
+		if v := ctx.Query("timeout"); v != "" {
+			timeout, err := strconv.Atoi(v)
+			if err != nil || timeout <= 0 {
+				ctx.JSON(http.StatusBadRequest, gin.H{"error": "timeout 参数必须是正整数 (秒)"})
+				return
+			}
+			opts.Timeout = timeout
+		}
+		go runTask(task.ID, opts)
+		ctx.Header("X-Correlation-Id", opts.CorrelationID)
+		ctx.JSON(http.StatusOK, gin.H{"message": "任务已在后台立即执行", "correlation_id": opts.CorrelationID})
+	})
+
+	// 分页查看任务的日志，按时间倒序，page 从1开始
+	api.GET("/api/tasks/:id/logs", func(ctx *gin.Context) {
+		task, ok := findTask(ctx)
+		if !ok {
+			return
+		}
+		page, err := strconv.Atoi(ctx.DefaultQuery("page", "1"))
+		if err != nil || page <= 0 {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "page 参数必须是正整数"})
+			return
+		}
+		size, err := strconv.Atoi(ctx.DefaultQuery("size", "50"))
+		if err != nil || size <= 0 || size > 200 {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "size 参数必须是 1 到 200 之间的整数"})
+			return
+		}
+
+		var total int64
+		readDB.Model(&Log{}).Where("task_id = ?", task.ID).Count(&total)
+		logs := []Log{}
+		readDB.Where("task_id = ?", task.ID).Order("time DESC").Order("id DESC").
+			Offset((page - 1) * size).Limit(size).Find(&logs)
+		ctx.JSON(http.StatusOK, gin.H{
+			"total": total,
+			"page":  page,
+			"size":  size,
+			"logs":  logs,
+		})
+	})
+
+	// 获取日志的完整响应体，保存在外部存储中的响应体会被透明地读取出来
+	api.GET("/api/logs/:id/body", func(ctx *gin.Context) {
+		var log Log
+		var owner Task
+		if err := readDB.First(&log, ctx.Param("id")).Error; err != nil ||
+			readDB.First(&owner, log.TaskID).Error != nil || !canAccess(ctx, &owner) {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "日志不存在"})
+			return
+		}
+		// 被采样省略的响应体与引用的日志相同
+		if log.SampleOfID != 0 {
+			var sample Log
+			if err := readDB.First(&sample, log.SampleOfID).Error; err != nil {
+				ctx.JSON(http.StatusNotFound, gin.H{"error": "引用的日志已不存在"})
+				return
+			}
+			log = sample
+		}
+		body, err := loadBody(&log)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "读取响应体失败: " + err.Error()})
+			return
+		}
+		ctx.Data(http.StatusOK, "text/plain; charset=utf-8", body)
+	})
+
+	// 置顶或取消置顶任务
+	api.POST("/api/tasks/:id/pin", func(ctx *gin.Context) {
+		var req struct {
+			Pinned bool `json:"pinned"`
+		}
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		task, ok := findTask(ctx)
+		if !ok {
 			return
 		}
+		db.Model(&task).Update("pinned", req.Pinned)
 
-		// 从 cron 调度中移除
 		taskMutex.Lock()
-		if entryID, ok := cronIDs[task.ID]; ok {
-			c.Remove(entryID)
-			delete(cronIDs, task.ID)
+		if t, ok := tasks[task.ID]; ok {
+			t.Pinned = req.Pinned
 		}
-		delete(tasks, task.ID)
 		taskMutex.Unlock()
-
-		// 从数据库删除
-		db.Delete(&task)
-		ctx.JSON(http.StatusOK, gin.H{"message": "任务已删除"})
+		ctx.JSON(http.StatusOK, gin.H{"pinned": req.Pinned})
 	})
 
-	// 立即执行任务
-	r.POST("/api/tasks/:id/run", func(ctx *gin.Context) {
-		var task Task
-		if err := db.First(&task, ctx.Param("id")).Error; err != nil {
-			ctx.JSON(http.StatusNotFound, gin.H{"error": "任务不存在"})
+	// 启用或禁用任务：禁用的任务从调度器中移除，但保留在数据库和任务列表中，重新启用时再注册
+	api.POST("/api/tasks/:id/toggle", func(ctx *gin.Context) {
+		task, ok := findTask(ctx)
+		if !ok || rejectFileTask(ctx, &task) {
 			return
 		}
-		go runTask(task.ID)
-		ctx.JSON(http.StatusOK, gin.H{"message": "任务已在后台立即执行"})
+		enabled := !task.Enabled
+		db.Model(&task).Update("enabled", enabled)
+
+		taskMutex.Lock()
+		t, ok := tasks[task.ID]
+		if ok {
+			t.Enabled = enabled
+			if !enabled {
+				unschedule(task.ID)
+			}
+		}
+		taskMutex.Unlock()
+		if ok && enabled && !t.isExpired(time.Now()) {
+			registerTask(t)
+		}
+		ctx.JSON(http.StatusOK, gin.H{"enabled": enabled})
 	})
 
-	c.Start()
-	fmt.Println("服务已启动，请访问 http://localhost:8080")
-	r.Run("0.0.0.0:8899")
-}
+	// 通知渠道管理
+	registerChannelRoutes(api)
 
-// registerTask 将任务注册到 cron 调度器
-func registerTask(t *Task) {
-	taskMutex.Lock()
-	tasks[t.ID] = t
-	taskMutex.Unlock()
+	// 项目管理
+	registerProjectRoutes(api)
+
+	// 用户管理和任务归属
+	registerUserRoutes(api)
+	registerTOTPRoutes(api)
+
+	// Postman 集合导入和导出
+	registerPostmanRoutes(api)
+
+	// 数据库备份
+	registerBackupRoutes(api)
+	registerStatsRoutes(api)
+	registerEventRoutes(api)
+	registerQueueRoutes(api)
+	registerHolidayRoutes(api)
+	registerSmokeTestRoutes(api)
+	registerBulkRoutes(api)
+	registerShareRoutes(api)
+	registerTaskFileRoutes(api)
+	registerAnomalyRoutes(api)
 
-	entryID, err := c.AddFunc(t.CronExpr, func() {
-		runTask(t.ID)
+	// 将 Cron 表达式翻译为可读的描述
+	api.GET("/api/cron/describe", func(ctx *gin.Context) {
+		expr := ctx.Query("expr")
+		if _, err := cronParser.Parse(expr); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "Cron表达式无效: " + err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusOK, gin.H{"expr": expr, "description": describeCron(expr)})
 	})
-	if err != nil {
-		fmt.Printf("任务 #%d (%s) 注册失败: %v\n", t.ID, t.Name, err)
-		return
-	}
 
-	taskMutex.Lock()
-	cronIDs[t.ID] = entryID
-	taskMutex.Unlock()
-	fmt.Printf("任务 #%d (%s) 已成功注册, Cron: '%s'\n", t.ID, t.Name, t.CronExpr)
-}
+	// 获取任务在时间窗口内的耗时分位数
+	api.GET("/api/tasks/:id/latency", func(ctx *gin.Context) {
+		task, ok := findTask(ctx)
+		if !ok {
+			return
+		}
 
-// runTask 执行指定的任务
-func runTask(id int) {
-	taskMutex.Lock()
-	t, ok := tasks[id]
-	taskMutex.Unlock()
-	if !ok {
-		fmt.Printf("执行任务失败：找不到任务 #%d\n", id)
-		return
-	}
+		window, err := parseWindow(ctx.DefaultQuery("window", "24h"))
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "window 参数无效: " + err.Error()})
+			return
+		}
 
-	fmt.Printf("开始执行任务 #%d: %s\n", t.ID, t.Name)
+		// 只统计有实际耗时的记录（创建请求失败的记录耗时为0）
+		var durations []int64
+		readDB.Model(&Log{}).
+			Where("task_id = ? AND time >= ? AND duration_ms > 0", task.ID, time.Now().Add(-window)).
+			Order("duration_ms").
+			Pluck("duration_ms", &durations)
 
-	client := &http.Client{Timeout: time.Duration(t.Timeout) * time.Second}
-	var req *http.Request
-	var err error
+		ctx.JSON(http.StatusOK, gin.H{
+			"window": window.String(),
+			"count":  len(durations),
+			"p50":    percentile(durations, 50),
+			"p90":    percentile(durations, 90),
+			"p95":    percentile(durations, 95),
+			"p99":    percentile(durations, 99),
+		})
+	})
 
-	// 创建请求
-	if t.Method == "POST" {
-		req, err = http.NewRequest("POST", t.URL, bytes.NewBufferString(t.Body))
-		if err == nil {
-			// 默认设置为JSON格式，如果Headers中指定了，则会被覆盖
-			req.Header.Set("Content-Type", "application/json")
+	// 预览任务接下来的执行时间，count 默认5，最多 maxPreviewRuns
+	api.GET("/api/tasks/:id/schedule", func(ctx *gin.Context) {
+		task, ok := findTask(ctx)
+		if !ok {
+			return
 		}
-	} else { // 默认为GET
-		req, err = http.NewRequest("GET", t.URL, nil)
-	}
+		count, err := strconv.Atoi(ctx.DefaultQuery("count", "5"))
+		if err != nil || count <= 0 {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "count 参数必须是正整数"})
+			return
+		}
+		runs, err := nextRunTimes(&task, time.Now(), min(count, maxPreviewRuns))
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusOK, gin.H{"cron": task.CronExpr, "timezone": taskLocation(&task).String(), "runs": runs})
+	})
 
-	if err != nil {
-		appendLog(t.ID, "创建请求失败: "+err.Error(), "")
-		return
+	// 每分钟检查一次是否有任务已过期
+	addSystemJob("@every 1m", retireExpiredTasks)
+	// 按保留天数和保留条数清理日志，默认每天一次
+	if logPruneInterval > 0 {
+		addSystemJob("@every "+logPruneInterval.String(), pruneLogs)
+	}
+	// 定期自检调度器是否存在延迟或漏触发
+	addSystemJob("@every 10m", checkSchedulerHealth)
+	// 定期将缓存的执行指标批量写入时序数据库
+	if metricsBackend != nil {
+		addSystemJob("@every "+metricsFlushInterval.String(), flushMetrics)
+	}
+	// 按配置的间隔自动备份数据库
+	if backupInterval > 0 && usingSQLite() {
+		addSystemJob("@every "+backupInterval.String(), scheduledBackup)
+	}
+	// 启动时同步一次任务配置文件，之后定期检查文件是否变化
+	if tasksDir != "" {
+		scheduledTaskFileSync()
+		addSystemJob("@every "+tasksDirInterval.String(), scheduledTaskFileSync)
 	}
 
-	// 设置请求头
-	if t.Headers != "" {
-		var headers map[string]string
-		if err := json.Unmarshal([]byte(t.Headers), &headers); err == nil {
-			for key, value := range headers {
-				req.Header.Set(key, value)
-			}
-		} else {
-			// 如果JSON解析失败，记录一个警告，但继续执行
-			fmt.Printf("任务 #%d 的请求头JSON格式错误: %v\n", t.ID, err)
+	// 将所有任务导出为可重新创建它们的 shell 脚本，便于纳入版本管理
+	api.GET("/api/tasks/export.sh", func(ctx *gin.Context) {
+		var list []Task
+		readDB.Scopes(ownedTasks(ctx)).Order("id").Find(&list)
+		ctx.Header("Content-Disposition", `attachment; filename="pipigo-tasks.sh"`)
+		ctx.Data(http.StatusOK, "text/x-shellscript; charset=utf-8", []byte(exportShellScript(list)))
+	})
+
+	// 将所有任务导出后导入到临时数据库，逐字段比较，检查导出和导入能否完整地保留任务的定义
+	api.POST("/api/admin/verify-roundtrip", requireAdmin, func(ctx *gin.Context) {
+		var list []Task
+		readDB.Order("id").Find(&list)
+		issues, err := verifyRoundTrip(list)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
 		}
-	}
+		// 只有预期差异 (被隐藏的密钥) 时仍视为一致
+		ok := true
+		for _, issue := range issues {
+			ok = ok && issue.Expected
+		}
+		ctx.JSON(http.StatusOK, gin.H{
+			"total":  len(list),
+			"ok":     ok,
+			"issues": issues,
+		})
+	})
 
-	// 执行请求
-	resp, err := client.Do(req)
-	if err != nil {
-		appendLog(t.ID, "请求失败: "+err.Error(), "")
-		return
-	}
-	defer resp.Body.Close()
+	// 用当前的解析规则校验所有任务的 Cron 表达式，找出无法注册或实际未被调度的任务
+	api.GET("/api/tasks/validate-all", func(ctx *gin.Context) {
+		var list []Task
+		readDB.Scopes(ownedTasks(ctx)).Order("id").Find(&list)
+		problems := validateAllTasks(list)
+		ctx.JSON(http.StatusOK, gin.H{
+			"total":    len(list),
+			"valid":    len(list) - len(problems),
+			"problems": problems,
+		})
+	})
 
-	// 读取响应体
-	bodyBytes, err := io.ReadAll(resp.Body)
-	if err != nil {
-		appendLog(t.ID, fmt.Sprintf("状态: %d, 读取响应体失败: %s", resp.StatusCode, err.Error()), "")
+	// 全局熔断器状态及最近的状态变化
+	api.GET("/api/breaker", func(ctx *gin.Context) {
+		ctx.JSON(http.StatusOK, breakerStatus())
+	})
+
+	// 手动解除全局熔断
+	api.POST("/api/breaker/reset", requireAdmin, func(ctx *gin.Context) {
+		breakerReset()
+		ctx.JSON(http.StatusOK, breakerStatus())
+	})
+
+	// 调度器健康状况：统计各任务在时间窗口内按时、延迟和漏触发的次数
+	api.GET("/api/scheduler/health", requireAdmin, func(ctx *gin.Context) {
+		window, err := parseWindow(ctx.DefaultQuery("window", "1h"))
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "window 参数无效: " + err.Error()})
+			return
+		}
+		reports := schedulerHealth(window)
+		total := fireReport{}
+		for _, rep := range reports {
+			total.Expected += rep.Expected
+			total.OnTime += rep.OnTime
+			total.Late += rep.Late
+			total.Missed += rep.Missed
+		}
+		ctx.JSON(http.StatusOK, gin.H{
+			"window":         window.String(),
+			"late_threshold": lateThreshold.String(),
+			"expected":       total.Expected,
+			"on_time":        total.OnTime,
+			"late":           total.Late,
+			"missed":         total.Missed,
+			"tasks":          reports,
+		})
+	})
+
+	// 重建调度器：清空所有任务的调度条目后从数据库重新注册，用于修复调度状态与任务不一致的情况，无需重启进程
+	api.POST("/api/admin/rebuild-scheduler", requireAdmin, func(ctx *gin.Context) {
+		registered, orphaned := rebuildScheduler()
+		taskMutex.Lock()
+		total := len(tasks)
+		taskMutex.Unlock()
+		ctx.JSON(http.StatusOK, gin.H{
+			"tasks":            total,
+			"registered":       registered,
+			"orphaned_entries": orphaned,
+		})
+	})
+
+	c.Start()
+
+	srv := &http.Server{Handler: r}
+	if listenSocket != "" {
+		ln, err := listenUnix(listenSocket)
+		if err != nil {
+			panic("监听 Unix socket 失败: " + err.Error())
+		}
+		fmt.Printf("服务已启动，监听 Unix socket: %s\n", listenSocket)
+		srv.Serve(ln)
 		return
 	}
 
-	// 记录日志
-	statusText := fmt.Sprintf("状态: %d", resp.StatusCode)
-	appendLog(t.ID, statusText, string(bodyBytes))
+	fmt.Printf("服务已启动，请访问 http://%s\n", displayAddr(listenAddr))
+	srv.Addr = listenAddr
+	if err := srv.ListenAndServe(); err != nil {
+		panic("启动服务失败: " + err.Error())
+	}
 }
 
-// appendLog 向数据库添加一条日志
-func appendLog(taskID int, statusText, responseBody string) {
-	log := Log{
-		TaskID:       taskID,
-		Time:         time.Now(),
-		StatusText:   statusText,
-		ResponseBody: responseBody,
+// displayAddr 返回监听地址对应的访问地址，监听所有网卡时显示为 localhost
+func displayAddr(addr string) string {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
 	}
-	if err := db.Create(&log).Error; err != nil {
-		fmt.Printf("任务 #%d 写日志失败: %v\n", taskID, err)
+	if host == "" || host == "0.0.0.0" || host == "::" {
+		host = "localhost"
 	}
+	return net.JoinHostPort(host, port)
 }
 
-// loadTasksFromDB 从数据库加载所有任务并注册它们
-func loadTasksFromDB() {
-	var list []Task
-	db.Find(&list)
-	fmt.Printf("从数据库加载了 %d 个任务...\n", len(list))
-	for i := range list {
-		// 使用拷贝，避免闭包问题
-		taskCopy := list[i]
-		registerTask(&taskCopy)
+// listenUnix 在指定路径上监听 Unix socket，启动前会清理上次运行遗留的 socket 文件
+func listenUnix(path string) (net.Listener, error) {
+	if info, err := os.Lstat(path); err == nil {
+		// 只删除 socket 文件，避免误删同名的普通文件
+		if info.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("%s 已存在且不是 socket 文件", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
 	}
+	return net.Listen("unix", path)
 }
 
-// htmlPage 定义了前端页面的内容
-const htmlPage = `
-<!DOCTYPE html>
+// validateTask 校验任务配置并填充默认值，返回的错误信息可直接展示给用户
+func validateTask(t *Task) error {
+	// 新任务设置了 Cron 模板时，表达式由模板计算得到 (任务保存后会用实际的ID重新计算)；
+	// 已有任务沿用创建时计算出的表达式，修改时由 keepCronTemplate 处理
+	if t.ID == 0 {
+		if err := resolveCronTemplate(t); err != nil {
+			return err
+		}
+	}
+	if t.IntervalSeconds < 0 {
+		return errors.New("执行间隔不能为负数")
+	}
+	if t.Name == "" || (t.CronExpr == "" && t.IntervalSeconds == 0) || t.URL == "" {
+		return errors.New("任务名称、Cron表达式 (或执行间隔) 和URL是必填项")
+	}
+
+	if t.Timeout <= 0 {
+		t.Timeout = 10 // 默认超时时间10秒
+	}
+
+	// 未指定请求方法时按 GET 处理，与旧版本一致
+	t.Method = strings.ToUpper(strings.TrimSpace(t.Method))
+	if t.Method == "" {
+		t.Method = http.MethodGet
+	}
+	if !slices.Contains(supportedMethods, t.Method) {
+		return fmt.Errorf("不支持的请求方法: %s (支持 %s)", t.Method, strings.Join(supportedMethods, "、"))
+	}
+
+	// 去掉其他地址中的空行和重复项
+	seen := map[string]bool{t.URL: true}
+	urls := t.URLs[:0]
+	for _, u := range t.URLs {
+		u = strings.TrimSpace(u)
+		if u != "" && !seen[u] {
+			seen[u] = true
+			urls = append(urls, u)
+		}
+	}
+	t.URLs = urls
+
+	if err := validateOAuth(t); err != nil {
+		return err
+	}
+	if err := validateSigV4(t); err != nil {
+		return err
+	}
+	if err := validateGuard(t); err != nil {
+		return err
+	}
+	if err := validateHoliday(t); err != nil {
+		return err
+	}
+	if err := validateStatusRanges(t); err != nil {
+		return err
+	}
+	if t.RetentionDays < 0 {
+		return errors.New("日志保留天数不能为负数")
+	}
+	if t.MaxBodyBytes < 0 {
+		return errors.New("响应体大小上限不能为负数")
+	}
+	if err := validateBodyContentTypes(t); err != nil {
+		return err
+	}
+
+	t.ExpectHeader = strings.TrimSpace(t.ExpectHeader)
+	if t.ExpectHeader == "" {
+		t.ExpectHeaderValue = ""
+	} else if err := validateExpected(t.ExpectHeaderValue); err != nil {
+		return fmt.Errorf("响应头%v", err)
+	}
+	if t.ExpectStatus != 0 && (t.ExpectStatus < 100 || t.ExpectStatus > 599) {
+		return errors.New("期望状态码必须在 100-599 之间")
+	}
+	if err := validateValidators(t); err != nil {
+		return err
+	}
+
+	t.BodyURL = strings.TrimSpace(t.BodyURL)
+	if t.BodyURL != "" {
+		if !methodHasBody(t.Method) {
+			return errors.New("只有 POST、PUT 和 PATCH 请求可以设置请求体地址")
+		}
+		if u, err := url.Parse(t.BodyURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return errors.New("请求体地址必须是有效的 http 或 https 地址")
+		}
+	}
+
+	if t.IntervalSeconds > 0 {
+		// 间隔模式不使用 Cron 表达式
+		t.CronExpr, t.CronTemplate, t.Timezone = "", "", ""
+		if interval := time.Duration(t.IntervalSeconds) * time.Second; interval < minInterval {
+			return fmt.Errorf("执行间隔 %s 低于允许的最小间隔 %s (可通过 PIPIGO_MIN_INTERVAL 调整)", interval, minInterval)
+		}
+	} else if err := validateTimezone(t); err != nil {
+		return err
+	} else if err := validateCronInterval(cronSpec(t)); err != nil {
+		return err
+	}
+
+	if !t.ExpireAt.IsZero() && !t.ExpireAt.After(time.Now()) {
+		return errors.New("过期时间必须晚于当前时间")
+	}
+
+	switch t.BodyType {
+	case "":
+		t.BodyType = bodyTypeJSON
+	case bodyTypeJSON, bodyTypeRaw:
+	case bodyTypeForm:
+		if _, err := url.ParseQuery(t.Body); err != nil {
+			return fmt.Errorf("表单请求体格式错误: %v", err)
+		}
+	default:
+		return fmt.Errorf("不支持的请求体类型: %s", t.BodyType)
+	}
+
+	if err := validateChannels(t); err != nil {
+		return err
+	}
+	if err := validatePreRequestScript(t); err != nil {
+		return err
+	}
+	if err := validateRequestTemplates(t); err != nil {
+		return err
+	}
+	if err := validateExtractions(t); err != nil {
+		return err
+	}
+	if err := validateTaskProject(t); err != nil {
+		return err
+	}
+
+	if t.CoalesceSeconds < 0 {
+		return errors.New("合并窗口不能为负数")
+	}
+	if t.MaxRedirects < 0 {
+		return errors.New("最大重定向次数不能为负数")
+	}
+	if t.AnomalyK < 0 {
+		return errors.New("响应时间异常的标准差倍数不能为负数")
+	}
+	if t.AnomalyK == 0 {
+		t.AnomalyNotify = false
+	}
+	if t.FollowRedirects == nil {
+		follow := true
+		t.FollowRedirects = &follow
+	}
+	if t.NotifyThrottleMinutes < 0 || t.NotifyFailureThreshold < 0 {
+		return errors.New("通知节流时间和失败次数阈值不能为负数")
+	}
+	t.NotifyWebhookURL = strings.TrimSpace(t.NotifyWebhookURL)
+	if t.NotifyWebhookURL != "" && !strings.HasPrefix(t.NotifyWebhookURL, "http://") && !strings.HasPrefix(t.NotifyWebhookURL, "https://") {
+		return errors.New("失败通知 webhook 地址必须以 http:// 或 https:// 开头")
+	}
+
+	if t.ResponseHeaderTimeout < 0 || t.IdleConnTimeout < 0 {
+		return errors.New("响应头超时和空闲连接超时不能为负数")
+	}
+	if t.ResponseHeaderTimeout > 0 && t.ResponseHeaderTimeout >= t.Timeout {
+		return fmt.Errorf("响应头超时必须小于超时时间 (%d 秒)，否则不会先于超时时间生效", t.Timeout)
+	}
+
+	if t.MaxRetries < 0 || t.RetryBudget < 0 || t.RetryBudgetWindow < 0 || t.RetryDelayMs < 0 {
+		return errors.New("重试次数、重试间隔和重试预算不能为负数")
+	}
+	// 不重试或请求方法本身幂等时，可安全重试的标记没有意义
+	if t.MaxRetries == 0 || !nonIdempotentMethod(t.Method) {
+		t.IdempotentRetry = false
+	}
+	if t.RetryBudget > 0 && t.RetryBudgetWindow == 0 {
+		t.RetryBudgetWindow = 3600 // 默认按1小时的窗口计算预算
+	}
+	return nil
+}
+
+// validateCronInterval 解析 Cron 表达式，确认它还会触发，并检查其相邻两次执行的最短间隔不低于 minInterval。
+// 能解析但永远不会触发的表达式 (例如2月30日) 注册到调度器时不会报错，保存后任务却从不执行，因此在这里拒绝
+func validateCronInterval(expr string) error {
+	schedule, err := cronParser.Parse(expr)
+	if err != nil {
+		return fmt.Errorf("Cron表达式无效: %v", err)
+	}
+	prev := schedule.Next(time.Now())
+	if prev.IsZero() {
+		return errors.New("Cron表达式永远不会触发，请检查日期是否存在 (例如2月没有30日)")
+	}
+	if minInterval <= 0 {
+		return nil
+	}
+
+	// 只看第一个间隔不够，例如 "0,1 0 * * * *" 每小时只有一次两秒内连续触发，
+	// 因此取接下来若干次执行中的最短间隔
+	shortest := time.Duration(-1)
+	for i := 0; i < 100; i++ {
+		next := schedule.Next(prev)
+		if next.IsZero() {
+			break
+		}
+		if gap := next.Sub(prev); shortest < 0 || gap < shortest {
+			shortest = gap
+		}
+		prev = next
+	}
+	if shortest >= 0 && shortest < minInterval {
+		return fmt.Errorf("执行过于频繁: 该Cron表达式最短每 %s 执行一次，低于允许的最小间隔 %s (可通过 PIPIGO_MIN_INTERVAL 调整)", shortest, minInterval)
+	}
+	return nil
+}
+
+// envDuration 从环境变量读取时长配置，未设置或格式错误时返回默认值
+func envDuration(key string, def time.Duration) time.Duration {
+	v := os.Getenv(key)
+	if v == "" {
+		return def
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		fmt.Printf("环境变量 %s 的值 %q 无效，使用默认值 %s\n", key, v, def)
+		return def
+	}
+	return d
+}
+
+// maxPreviewRuns 是预览执行时间时最多返回的次数
+const maxPreviewRuns = 50
+
+// nextRunTimes 按任务的 Cron 表达式计算 from 之后的 count 次执行时间，到达过期时间或表达式不再触发时提前结束。
+// 只反映表达式本身，不考虑禁用、节假日跳过等运行时的条件
+func nextRunTimes(t *Task, from time.Time, count int) ([]time.Time, error) {
+	if t.IntervalSeconds > 0 {
+		return nil, errors.New("间隔模式的任务在上一次执行完成后才安排下一次，无法预览执行时间")
+	}
+	schedule, err := cronParser.Parse(cronSpec(t))
+	if err != nil {
+		return nil, fmt.Errorf("Cron表达式无效: %v", err)
+	}
+	runs := []time.Time{}
+	for next := schedule.Next(from); !next.IsZero() && len(runs) < count; next = schedule.Next(next) {
+		if !t.ExpireAt.IsZero() && next.After(t.ExpireAt) {
+			break
+		}
+		runs = append(runs, inTaskZone(t, next))
+	}
+	return runs, nil
+}
+
+// registerTask 将任务注册到 cron 调度器，间隔模式的任务使用独立的定时器
+func registerTask(t *Task) {
+	taskMutex.Lock()
+	tasks[t.ID] = t
+	t.scheduledSince = time.Now()
+	taskMutex.Unlock()
+	// 禁用的任务只加入任务列表，不注册到调度器
+	if !t.Enabled {
+		return
+	}
+	if t.IntervalSeconds > 0 {
+		registerIntervalTask(t)
+		return
+	}
+
+	entryID, err := c.AddFunc(cronSpec(t), cronTaskJob(t.ID))
+	if err != nil {
+		fmt.Printf("任务 #%d (%s) 注册失败: %v\n", t.ID, t.Name, err)
+		return
+	}
+
+	taskMutex.Lock()
+	cronIDs[t.ID] = entryID
+	taskMutex.Unlock()
+	fmt.Printf("任务 #%d (%s) 已成功注册, Cron: '%s'\n", t.ID, t.Name, cronSpec(t))
+}
+
+// insertTask 保存新任务。Enabled 在数据库中默认为 true，插入时 false 会被默认值替换 (并回填到结构体中)，
+// 因此禁用的任务需要在插入后单独更新
+func insertTask(conn *gorm.DB, t *Task) error {
+	enabled := t.Enabled
+	if err := conn.Create(t).Error; err != nil {
+		return err
+	}
+	if !enabled {
+		t.Enabled = false
+		return conn.Model(t).Update("enabled", false).Error
+	}
+	return nil
+}
+
+// rescheduleTask 用修改后的任务替换调度中的旧任务。新的 Cron 表达式注册失败时返回错误，旧的调度保持不变；
+// 已禁用或已过期的任务只更新定义，不再调度。
+func rescheduleTask(t *Task) error {
+	t.scheduledSince = time.Now()
+	if !t.Enabled || t.isExpired(time.Now()) {
+		taskMutex.Lock()
+		unschedule(t.ID)
+		tasks[t.ID] = t
+		taskMutex.Unlock()
+		return nil
+	}
+	if t.IntervalSeconds > 0 {
+		taskMutex.Lock()
+		unschedule(t.ID)
+		tasks[t.ID] = t
+		scheduleInterval(t.ID, time.Duration(t.IntervalSeconds)*time.Second)
+		taskMutex.Unlock()
+		fmt.Printf("任务 #%d (%s) 已重新注册, 间隔: 上次执行完成后 %d 秒\n", t.ID, t.Name, t.IntervalSeconds)
+		return nil
+	}
+
+	// 先注册新的条目，成功后再移除旧的，避免任务在替换过程中失去调度
+	entryID, err := c.AddFunc(cronSpec(t), cronTaskJob(t.ID))
+	if err != nil {
+		return fmt.Errorf("Cron表达式格式错误: %v", err)
+	}
+	taskMutex.Lock()
+	unschedule(t.ID)
+	tasks[t.ID] = t
+	cronIDs[t.ID] = entryID
+	taskMutex.Unlock()
+	fmt.Printf("任务 #%d (%s) 已重新注册, Cron: '%s'\n", t.ID, t.Name, cronSpec(t))
+	return nil
+}
+
+// deleteTask 将任务从调度器中移除，清理其运行状态和外部存储的响应体，并从数据库删除
+func deleteTask(task Task) {
+	deleteTasks([]int{task.ID})
+}
+
+// deleteTasks 与 deleteTask 相同，一次删除多个任务，返回数据库中实际删除的任务数
+func deleteTasks(ids []int) int64 {
+	// 从调度中移除
+	taskMutex.Lock()
+	for _, id := range ids {
+		unschedule(id)
+		delete(tasks, id)
+	}
+	taskMutex.Unlock()
+	for _, id := range ids {
+		clearFlapState(id)
+		clearNotifyState(id)
+		clearFailureSample(id)
+		clearBodyHashes(id)
+		clearOAuthToken(id)
+		clearRunStart(id)
+		clearLatencyBaseline(id)
+		clearTaskMetrics(id)
+	}
+	deleteShareLinks(ids)
+
+	// 删除外部存储中的响应体
+	var stored []Log
+	db.Where("task_id IN ? AND response_body LIKE ?", ids, bodyRefPrefix+"%").Find(&stored)
+	deleteBodies(stored)
+
+	// 从数据库删除。SQLite 默认不启用外键约束，日志不会被级联删除，需要单独删除
+	db.Where("task_id IN ?", ids).Delete(&Log{})
+	return db.Where("id IN ?", ids).Delete(&Task{}).RowsAffected
+}
+
+// cronProblem 描述一个无法正常调度的任务
+type cronProblem struct {
+	TaskID   int    `json:"task_id"`
+	Name     string `json:"name"`
+	CronExpr string `json:"cron"`
+	Error    string `json:"error"`
+}
+
+// validateAllTasks 逐个校验任务的 Cron 表达式：能否被当前解析器解析、是否还会触发，
+// 以及启用且未过期的任务是否确实注册到了调度器中 (例如启动时注册失败的任务)。
+func validateAllTasks(list []Task) []cronProblem {
+	now := time.Now()
+	problems := []cronProblem{}
+	for _, t := range list {
+		problem := cronProblem{TaskID: t.ID, Name: t.Name, CronExpr: t.CronExpr}
+		schedule, err := cronParser.Parse(cronSpec(&t))
+		switch {
+		case t.IntervalSeconds > 0:
+			// 间隔模式的任务没有 Cron 表达式，只检查是否在调度中
+			taskMutex.Lock()
+			registered := isScheduled(t.ID)
+			taskMutex.Unlock()
+			if !registered && t.Enabled && !t.isExpired(now) {
+				problem.Error = "任务未注册到调度器中"
+			}
+		case err != nil:
+			problem.Error = "Cron表达式无效: " + err.Error()
+		case schedule.Next(now).IsZero():
+			problem.Error = "Cron表达式永远不会触发"
+		case t.Enabled && !t.isExpired(now):
+			taskMutex.Lock()
+			_, registered := cronIDs[t.ID]
+			taskMutex.Unlock()
+			if !registered {
+				problem.Error = "任务未注册到调度器中"
+			}
+		}
+		if problem.Error != "" {
+			problems = append(problems, problem)
+		}
+	}
+	return problems
+}
+
+// 任务的触发方式
+const (
+	triggerSchedule = "schedule"
+	triggerManual   = "manual"
+	triggerSimulate = "simulate" // 模拟执行，只返回结果，不会写入日志
+	triggerSmoke    = "smoke"    // 试运行全部任务，只在要求保存日志时写入
+)
+
+// runOptions 描述一次执行的上下文
+type runOptions struct {
+	Trigger     string    // 触发方式
+	ScheduledAt time.Time // 定时触发时计划的执行时间
+	Timeout     int       // 仅对本次执行生效的超时时间 (秒)，为0时使用任务的设置
+	// 触发方传入的关联ID，为空时自动生成
+	CorrelationID string
+}
+
+// correlationIDPattern 限制外部传入的关联ID只能包含常见的ID字符，避免把任意内容转发到请求头中
+var correlationIDPattern = regexp.MustCompile(`^[A-Za-z0-9._:/=+-]{1,128}$`)
+
+// scheduledTime 返回任务当前这次定时触发的计划时间。
+// 调度器在启动任务后才会响应 Entry 查询，此时 Prev 已更新为本次触发的时间。
+func scheduledTime(id int) time.Time {
+	taskMutex.Lock()
+	entryID, ok := cronIDs[id]
+	taskMutex.Unlock()
+	if !ok {
+		return time.Time{}
+	}
+	return c.Entry(entryID).Prev
+}
+
+// runTask 执行指定的任务
+func runTask(id int, opts runOptions) {
+	startedAt := time.Now()
+	taskMutex.Lock()
+	t, ok := tasks[id]
+	taskMutex.Unlock()
+	if !ok {
+		fmt.Printf("执行任务失败：找不到任务 #%d\n", id)
+		return
+	}
+
+	// 恢复数据库期间不执行任务，恢复会等待已经开始的执行结束
+	if !dbSwapLock.TryRLock() {
+		fmt.Printf("正在恢复数据库，跳过执行任务 #%d (%s)\n", t.ID, t.Name)
+		return
+	}
+	defer dbSwapLock.RUnlock()
+
+	fmt.Printf("开始执行任务 #%d: %s\n", t.ID, t.Name)
+
+	// 覆盖本次执行的超时时间并带上关联ID，使用任务的拷贝，不影响任务本身的设置
+	if opts.CorrelationID == "" {
+		opts.CorrelationID = newRequestID()
+	}
+	override := *t
+	override.correlationID = opts.CorrelationID
+	if opts.Timeout > 0 {
+		override.Timeout = opts.Timeout
+	}
+	t = &override
+
+	var lagMs int64
+	if !opts.ScheduledAt.IsZero() {
+		lag := startedAt.Sub(opts.ScheduledAt)
+		lagMs = lag.Milliseconds()
+		if lag > lateThreshold {
+			fmt.Printf("[调度自检] 任务 #%d (%s) 延迟触发: 计划 %s，实际延迟 %s\n",
+				t.ID, t.Name, opts.ScheduledAt.Format(time.DateTime), lag.Round(time.Millisecond))
+		}
+	}
+
+	// 功能开关关闭或无法获取时跳过定时执行，只记录一条跳过日志
+	if opts.Trigger == triggerSchedule {
+		if enabled, detail, err := guardEnabled(t); err != nil || !enabled {
+			reason := "功能开关未开启 (" + detail + ")，跳过执行"
+			if err != nil {
+				reason = "获取功能开关失败，跳过执行: " + err.Error()
+			}
+			fmt.Printf("任务 #%d (%s) %s\n", t.ID, t.Name, reason)
+			appendLog(&Log{TaskID: t.ID, StatusText: reason, Skipped: true,
+				Trigger: opts.Trigger, ScheduledAt: opts.ScheduledAt, LagMs: lagMs, CorrelationID: opts.CorrelationID})
+			return
+		}
+	}
+
+	// 计划执行的日期是节假日时跳过定时执行。日历无法加载时照常执行，避免漏掉工作日的执行
+	if opts.Trigger == triggerSchedule && t.SkipHolidays {
+		day := opts.ScheduledAt
+		if day.IsZero() {
+			day = startedAt
+		}
+		holiday, err := isHoliday(t, day)
+		if err != nil {
+			fmt.Printf("任务 #%d (%s) 无法确认是否为节假日，照常执行: %v\n", t.ID, t.Name, err)
+		}
+		if holiday {
+			reason := fmt.Sprintf("%s 是节假日 (日历 %s)，跳过执行", day.Format(time.DateOnly), holidayCalendarName(t))
+			fmt.Printf("任务 #%d (%s) %s\n", t.ID, t.Name, reason)
+			appendLog(&Log{TaskID: t.ID, StatusText: reason, Skipped: true,
+				Trigger: opts.Trigger, ScheduledAt: opts.ScheduledAt, LagMs: lagMs, CorrelationID: opts.CorrelationID})
+			return
+		}
+	}
+
+	// 全局熔断时跳过定时执行，只记录一条跳过日志
+	var probe bool
+	if opts.Trigger == triggerSchedule {
+		var allowed bool
+		if allowed, probe = breakerAllow(); !allowed {
+			fmt.Printf("任务 #%d (%s) 因全局熔断跳过执行\n", t.ID, t.Name)
+			appendLog(&Log{TaskID: t.ID, StatusText: "全局熔断中，跳过执行", Skipped: true,
+				Trigger: opts.Trigger, ScheduledAt: opts.ScheduledAt, LagMs: lagMs, CorrelationID: opts.CorrelationID})
+			return
+		}
+	}
+
+	// 定时执行和手动执行几乎同时发生时，按任务的合并窗口只保留先开始的一次。
+	// 在开关、节假日和熔断检查之后判断，被跳过的执行不会让另一种触发方式的执行被合并
+	if prev, ok := coalesceRun(t, opts.Trigger, opts.CorrelationID, startedAt); ok {
+		breakerRelease(probe)
+		reason := coalescedText(prev, opts.Trigger, startedAt)
+		fmt.Printf("任务 #%d (%s) %s\n", t.ID, t.Name, reason)
+		appendLog(&Log{TaskID: t.ID, StatusText: reason, Skipped: true, CoalescedWith: prev.correlationID,
+			Trigger: opts.Trigger, ScheduledAt: opts.ScheduledAt, LagMs: lagMs, CorrelationID: opts.CorrelationID})
+		return
+	}
+
+	// 执行时间较长时定期输出心跳，请求全部结束后停止
+	stopHeartbeat := startHeartbeat(t, startedAt)
+	entries, results := executeTask(t)
+	stopHeartbeat()
+	// 所有请求都在排队时被清除，本次执行没有发出请求，只记录跳过日志，不计入成功率和熔断
+	abandoned := true
+	for _, entry := range entries {
+		abandoned = abandoned && entry.Skipped
+	}
+	if abandoned {
+		fmt.Printf("任务 #%d (%s) 排队时被清除，跳过执行\n", t.ID, t.Name)
+		for _, entry := range entries {
+			entry.Trigger = opts.Trigger
+			entry.ScheduledAt = opts.ScheduledAt
+			entry.LagMs = lagMs
+			entry.CorrelationID = opts.CorrelationID
+			appendLog(entry)
+		}
+		breakerRelease(probe)
+		return
+	}
+	success := true
+	var reported *Log // 用于通知的日志，优先选择第一条失败的
+	for i, entry := range entries {
+		entry.Trigger = opts.Trigger
+		entry.ScheduledAt = opts.ScheduledAt
+		entry.LagMs = lagMs
+		entry.TimeoutSec = t.Timeout
+		entry.CorrelationID = opts.CorrelationID
+		entry.Success = results[i]
+		checkLatency(t, entry)
+		newSample := sampleFailure(t, entry, results[i])
+		appendLog(entry)
+		if newSample {
+			setFailureSample(t.ID, entry.ID)
+		}
+		exportRun(t, entry)
+		recordRunMetrics(t, entry)
+		if !results[i] && success {
+			success = false
+			reported = entry
+		}
+	}
+	if reported == nil {
+		reported = entries[len(entries)-1]
+	}
+	recordOutcome(t, success)
+	breakerRecord(success, probe)
+	notifyOutcome(t, success, reported)
+	if !success {
+		go notifyFailureWebhook(t, reported)
+	}
+
+	go fireCallback(t, success)
+}
+
+// executeTask 请求任务的所有地址，返回待写入的日志和每个地址的结果，不写日志也不更新任务的运行状态。
+// 请求模板和外部地址提供的请求体每次执行只渲染 (获取) 一次，所有地址和重试共用
+func executeTask(t *Task) ([]*Log, []bool) {
+	rendered, err := renderRequest(t, time.Now())
+	if err != nil {
+		fmt.Printf("任务 #%d 渲染请求模板失败: %v\n", t.ID, err)
+		return []*Log{{TaskID: t.ID, URL: t.URL, StatusText: "渲染请求模板失败: " + err.Error()}}, []bool{false}
+	}
+	t = rendered
+	if t.BodyURL != "" && methodHasBody(t.Method) {
+		body, err := fetchBody(t)
+		if err != nil {
+			fmt.Printf("任务 #%d 获取请求体失败: %v\n", t.ID, err)
+			return []*Log{{TaskID: t.ID, URL: t.URL, StatusText: "获取请求体失败: " + err.Error()}}, []bool{false}
+		}
+		override := *t
+		override.Body = body
+		t = &override
+	}
+	return fanOut(t)
+}
+
+// maxFetchedBodySize 是从请求体地址获取的请求体的大小上限
+const maxFetchedBodySize = 10 << 20
+
+// fetchBody 从任务的请求体地址获取本次执行要发送的请求体，使用任务的超时时间
+func fetchBody(t *Task) (string, error) {
+	client := &http.Client{Timeout: time.Duration(t.Timeout) * time.Second}
+	resp, err := client.Get(t.BodyURL)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return "", fmt.Errorf("请求体地址返回状态 %d", resp.StatusCode)
+	}
+	b, err := io.ReadAll(io.LimitReader(resp.Body, maxFetchedBodySize+1))
+	if err != nil {
+		return "", fmt.Errorf("读取请求体失败: %v", err)
+	}
+	if len(b) > maxFetchedBodySize {
+		return "", fmt.Errorf("请求体超过 %d 字节的上限", maxFetchedBodySize)
+	}
+	return string(b), nil
+}
+
+// taskURLs 返回任务每次触发需要请求的所有地址 (URL 在前，其余按配置顺序)
+func taskURLs(t *Task) []string {
+	return append([]string{t.URL}, t.URLs...)
+}
+
+// fanOut 并发请求任务的所有地址，返回的日志和结果与 taskURLs 的顺序一致
+func fanOut(t *Task) ([]*Log, []bool) {
+	targets := taskURLs(t)
+	entries := make([]*Log, len(targets))
+	results := make([]bool, len(targets))
+	var wg sync.WaitGroup
+	for i, target := range targets {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			entries[i], results[i] = runTarget(t, target)
+		}()
+	}
+	wg.Wait()
+	return entries, results
+}
+
+// runTarget 请求任务的一个地址，失败时按任务的配置重试
+func runTarget(t *Task, target string) (*Log, bool) {
+	if target != t.URL {
+		override := *t
+		override.URL = target
+		t = &override
+	}
+
+	// 每次执行生成一个请求ID，同一次执行内的重试会复用它，便于下游识别重复请求
+	requestID := newRequestID()
+	entry, success := limitedRequest(t, requestID)
+	retries := 0
+	for attempt := 1; !success && !entry.Skipped && retryable(t, entry) && attempt <= t.MaxRetries; attempt++ {
+		// 按指数退避等待，被限流时按 Retry-After 等待
+		delay := retryDelayFor(t, attempt)
+		if entry.RateLimited && entry.retryAfter > 0 {
+			if entry.retryAfter > maxRetryAfter {
+				fmt.Printf("任务 #%d 被限流，Retry-After %s 超过上限，放弃剩余重试\n", t.ID, entry.retryAfter)
+				entry.StatusText += " (Retry-After 超过上限，放弃重试)"
+				break
+			}
+			delay = entry.retryAfter
+		}
+		if !takeRetryBudget(t) {
+			fmt.Printf("任务 #%d 重试预算已用尽，放弃剩余重试\n", t.ID)
+			entry.StatusText += " (重试预算已用尽)"
+			break
+		}
+		time.Sleep(delay)
+		rateLimited := entry.RateLimited
+		entry, success = limitedRequest(t, requestID)
+		entry.RateLimited = entry.RateLimited || rateLimited
+		retries = attempt
+	}
+	if !success && !entry.Skipped && t.MaxRetries > retries && retryableFailure(entry) && retryBlockedByMethod(t, entry) {
+		entry.StatusText += fmt.Sprintf(" (%s 请求可能已被处理，为避免重复写入不自动重试，确认接口幂等后可开启 idempotent_retry)", strings.ToUpper(t.Method))
+	}
+	// 重试过的执行只记录最后一次的结果，并注明重试的次数
+	if retries > 0 && !entry.Skipped {
+		if success {
+			entry.StatusText += fmt.Sprintf(" (重试 %d 次后成功)", retries)
+		} else {
+			entry.StatusText += fmt.Sprintf(" (重试 %d 次后仍失败)", retries)
+		}
+	}
+	entry.URL = target
+	return entry, success
+}
+
+// retryable 判断失败是否值得重试：没有收到响应 (连接失败、超时等)、5xx 和 429 限流可以重试，
+// 其他状态码 (例如 4xx) 和响应内容不符合期望重试也不会改变结果。非幂等的请求还需满足 retryBlockedByMethod 的限制
+func retryable(t *Task, entry *Log) bool {
+	return retryableFailure(entry) && !retryBlockedByMethod(t, entry)
+}
+
+// retryableFailure 判断失败本身是否可能通过重试恢复，不考虑请求方法
+func retryableFailure(entry *Log) bool {
+	return entry.statusCode == 0 || entry.statusCode >= 500 || entry.statusCode == http.StatusTooManyRequests
+}
+
+// retryBlockedByMethod 判断非幂等的请求是否因为可能已被服务端处理而不能重试。
+// 未标记 IdempotentRetry 时，只有确定请求没有送达 (没有收到响应，且不是在等待响应时超时) 才允许重试
+func retryBlockedByMethod(t *Task, entry *Log) bool {
+	if t.IdempotentRetry || !nonIdempotentMethod(t.Method) {
+		return false
+	}
+	return entry.statusCode != 0 || entry.TimeoutKind == timeoutResponseHeader || entry.TimeoutKind == timeoutTotal
+}
+
+// nonIdempotentMethod 判断请求方法是否非幂等，重复发送可能产生重复的副作用
+func nonIdempotentMethod(method string) bool {
+	method = strings.ToUpper(method)
+	return method == http.MethodPost || method == http.MethodPatch
+}
+
+// retryDelayFor 返回第 attempt 次重试前的等待时间，从任务的重试间隔开始每次翻倍，不超过 maxRetryDelay
+func retryDelayFor(t *Task, attempt int) time.Duration {
+	delay := retryDelay
+	if t.RetryDelayMs > 0 {
+		delay = time.Duration(t.RetryDelayMs) * time.Millisecond
+	}
+	for i := 1; i < attempt && delay < maxRetryDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, maxRetryDelay)
+}
+
+// limitedRequest 在全局并发上限内执行一次请求，没有空闲名额时排队等待，排队期间被清除时不发出请求
+func limitedRequest(t *Task, requestID string) (*Log, bool) {
+	if maxConcurrency > 0 {
+		if !acquireSlot(t) {
+			return &Log{TaskID: t.ID, URL: t.URL, RequestID: requestID, StatusText: "排队等待并发名额时被清除，跳过执行", Skipped: true}, false
+		}
+		defer func() { <-requestSlots }()
+	}
+	return doRequest(t, requestID)
+}
+
+// retryDelay 是任务未设置重试间隔时首次重试前的等待时间
+const retryDelay = time.Second
+
+// maxRetryDelay 是指数退避后单次重试等待时间的上限
+const maxRetryDelay = 5 * time.Minute
+
+// maxRetryAfter 是被限流时愿意等待的最长时间，Retry-After 超过该值时放弃重试
+const maxRetryAfter = 5 * time.Minute
+
+// parseRetryAfter 解析 Retry-After 响应头，支持秒数和 HTTP 日期两种格式
+func parseRetryAfter(v string, now time.Time) (time.Duration, bool) {
+	v = strings.TrimSpace(v)
+	if v == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(v); err == nil {
+		if secs < 0 {
+			return 0, false
+		}
+		return time.Duration(secs) * time.Second, true
+	}
+	at, err := http.ParseTime(v)
+	if err != nil {
+		return 0, false
+	}
+	if d := at.Sub(now); d > 0 {
+		return d, true
+	}
+	return 0, true
+}
+
+var (
+	// retryHistory 记录每个任务最近的重试时间，用于按滚动窗口计算重试预算
+	retryHistory = make(map[int][]time.Time)
+	retryMutex   sync.Mutex
+)
+
+// takeRetryBudget 尝试为任务消耗一次重试预算，预算已用尽时返回 false
+func takeRetryBudget(t *Task) bool {
+	if t.RetryBudget <= 0 {
+		return true
+	}
+	window := time.Duration(t.RetryBudgetWindow) * time.Second
+	now := time.Now()
+
+	retryMutex.Lock()
+	defer retryMutex.Unlock()
+
+	// 丢弃滚动窗口之外的记录
+	history := retryHistory[t.ID]
+	kept := history[:0]
+	for _, at := range history {
+		if now.Sub(at) < window {
+			kept = append(kept, at)
+		}
+	}
+	if len(kept) >= t.RetryBudget {
+		retryHistory[t.ID] = kept
+		return false
+	}
+	retryHistory[t.ID] = append(kept, now)
+	return true
+}
+
+// doRequest 发送任务配置的 HTTP 请求，返回待写入的日志以及本次执行是否成功
+func doRequest(t *Task, requestID string) (*Log, bool) {
+	entry := &Log{TaskID: t.ID, RequestID: requestID}
+
+	client := &http.Client{Timeout: time.Duration(t.Timeout) * time.Second, Transport: taskTransport(t)}
+	client.CheckRedirect = redirectPolicy(t)
+	var req *http.Request
+	var err error
+
+	// 创建请求，只有 POST、PUT 和 PATCH 发送请求体。早于请求方法校验创建的任务可能是小写或为空
+	method := strings.ToUpper(t.Method)
+	if method == "" {
+		method = http.MethodGet
+	}
+	var payload []byte
+	if methodHasBody(method) {
+		payload = []byte(t.Body)
+		entry.RequestBytes = len(payload)
+		req, err = http.NewRequest(method, t.URL, bytes.NewReader(payload))
+		if err == nil {
+			// 按请求体类型设置默认的 Content-Type，如果Headers中指定了，则会被覆盖
+			req.Header.Set("Content-Type", bodyContentType(t.BodyType))
+		}
+	} else {
+		req, err = http.NewRequest(method, t.URL, nil)
+	}
+
+	if err != nil {
+		entry.StatusText = "创建请求失败: " + err.Error()
+		return entry, false
+	}
+
+	// 默认注入请求ID和关联ID，如果Headers中指定了，则会被覆盖
+	req.Header.Set("X-Request-Id", requestID)
+	if t.correlationID != "" {
+		req.Header.Set("X-Correlation-Id", t.correlationID)
+	}
+
+	// 设置请求头
+	if t.Headers != "" {
+		var headers map[string]string
+		if err := json.Unmarshal([]byte(t.Headers), &headers); err == nil {
+			for key, value := range headers {
+				req.Header.Set(key, value)
+			}
+		} else {
+			// 如果JSON解析失败，记录一个警告，但继续执行
+			fmt.Printf("任务 #%d 的请求头JSON格式错误: %v\n", t.ID, err)
+		}
+	}
+	// 使用 OAuth2 时设置获取到的访问令牌，预处理脚本仍然可以覆盖
+	if auth, err := oauthAuthorization(t); err != nil {
+		entry.StatusText = "获取 OAuth2 令牌失败: " + err.Error()
+		return entry, false
+	} else if auth != "" {
+		req.Header.Set("Authorization", auth)
+	}
+	// 执行预处理脚本，计算签名等动态请求头
+	if err := applyPreRequestScript(t, req, payload); err != nil {
+		entry.StatusText = "预处理脚本执行失败: " + err.Error()
+		return entry, false
+	}
+	entry.RequestID = req.Header.Get("X-Request-Id")
+	// Content-Length 总是按实际发送的请求体计算，忽略Headers中可能与实际长度不符的值
+	req.Header.Del("Content-Length")
+	req.ContentLength = int64(entry.RequestBytes)
+	// SigV4 签名覆盖最终的请求，必须在所有请求头设置完成之后进行
+	signSigV4(t, req, payload)
+	entry.RequestHeaders = encodeHeaders(req.Header)
+
+	// 执行请求，并记录耗时（失败时同样记录到失败为止的耗时）
+	start := time.Now()
+	resp, err := client.Do(req)
+	entry.DurationMs = time.Since(start).Milliseconds()
+	if err != nil {
+		logAccess(t, req.Method, entry, 0, err)
+		entry.TimeoutKind = timeoutKind(err)
+		entry.StatusText = failureText("请求失败", err, entry.TimeoutKind)
+		return entry, false
+	}
+	defer resp.Body.Close()
+	logAccess(t, req.Method, entry, resp.StatusCode, nil)
+	entry.ResponseHeaders = encodeHeaders(resp.Header)
+	if final := resp.Request.URL.String(); final != req.URL.String() {
+		entry.FinalURL = final
+	}
+	// 令牌被拒绝时 (例如在服务端被提前吊销) 丢弃缓存，下次请求重新获取
+	if resp.StatusCode == http.StatusUnauthorized && t.OAuthTokenURL != "" {
+		clearOAuthToken(t.ID)
+	}
+
+	// 读取响应体，最多读取上限的大小，避免过大的响应占满内存和数据库
+	limit := t.MaxBodyBytes
+	if limit <= 0 {
+		limit = defaultMaxBodyBytes
+	}
+	bodyBytes, err := io.ReadAll(io.LimitReader(resp.Body, int64(limit)+1))
+	if err != nil {
+		entry.TimeoutKind = timeoutKind(err)
+		entry.StatusText = failureText(fmt.Sprintf("状态: %d, 读取响应体失败", resp.StatusCode), err, entry.TimeoutKind)
+		return entry, false
+	}
+	truncated := len(bodyBytes) > limit
+	if truncated {
+		bodyBytes = bodyBytes[:limit]
+	}
+
+	entry.ResponseBytes = int64(len(bodyBytes))
+	success := evaluateResponse(t, entry, resp.StatusCode, resp.Header, bodyBytes)
+	if location := resp.Header.Get("Location"); location != "" && resp.StatusCode >= 300 && resp.StatusCode < 400 {
+		entry.StatusText += ", Location: " + location
+	}
+	if truncated {
+		if _, stored := storedContentType(t, resp.Header, bodyBytes); stored {
+			entry.ResponseBody += truncatedMarker
+		}
+		entry.StatusText += fmt.Sprintf(", 响应体超过 %d 字节，已截断", limit)
+	}
+	return entry, success
+}
+
+// truncatedMarker 附加在被截断的响应体末尾
+const truncatedMarker = "...(已截断)"
+
+// evaluateResponse 根据响应填充日志 (状态、响应体、限流信息和提取字段) 并判断本次执行是否成功。
+// 实际执行和模拟执行共用这段逻辑，保证两者的判断结果一致。
+func evaluateResponse(t *Task, entry *Log, statusCode int, header http.Header, body []byte) bool {
+	entry.StatusText = fmt.Sprintf("状态: %d", statusCode)
+	entry.statusCode = statusCode
+	entry.ResponseBody = string(body)
+	if statusCode == http.StatusTooManyRequests {
+		entry.RateLimited = true
+		entry.retryAfter, _ = parseRetryAfter(header.Get("Retry-After"), time.Now())
+	}
+	entry.Extracted = extractFields(t, entry.ResponseBody)
+
+	// 不保存的类型 (例如图片) 只记录类型和大小，提取字段和校验规则仍然使用完整的响应体
+	if contentType, stored := storedContentType(t, header, body); !stored {
+		entry.ResponseBody = fmt.Sprintf("(%s, %d 字节)", contentType, len(body))
+	}
+
+	// 依次检查状态码和各条校验规则，状态码以外的失败原因附加到状态文本中
+	results := runValidators(t, statusCode, header, body)
+	if len(t.Validators) > 0 {
+		entry.Validations = results
+	}
+	success := true
+	for _, r := range results {
+		if r.Passed {
+			continue
+		}
+		success = false
+		if r.Type != validatorStatus || r.assertion {
+			entry.StatusText += ", " + r.Message
+		}
+	}
+	return success
+}
+
+// expectedPattern 返回 /正则表达式/ 形式的期望值中的正则表达式，不是该形式时返回 false
+func expectedPattern(expected string) (string, bool) {
+	if len(expected) >= 2 && strings.HasPrefix(expected, "/") && strings.HasSuffix(expected, "/") {
+		return expected[1 : len(expected)-1], true
+	}
+	return "", false
+}
+
+// matchExpected 判断实际值是否符合期望，期望值为 /正则表达式/ 时按正则匹配，否则要求完全相同
+func matchExpected(expected, actual string) bool {
+	if pattern, ok := expectedPattern(expected); ok {
+		re, err := regexp.Compile(pattern)
+		return err == nil && re.MatchString(actual)
+	}
+	return actual == expected
+}
+
+// supportedMethods 是任务可以使用的请求方法
+var supportedMethods = []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete, http.MethodHead}
+
+// methodHasBody 判断该请求方法是否发送请求体
+func methodHasBody(method string) bool {
+	return method == http.MethodPost || method == http.MethodPut || method == http.MethodPatch
+}
+
+// 请求体类型
+const (
+	bodyTypeJSON = "json"
+	bodyTypeForm = "form"
+	bodyTypeRaw  = "raw"
+)
+
+// bodyContentType 返回请求体类型对应的默认 Content-Type，未设置类型时按 JSON 处理以兼容旧任务
+func bodyContentType(bodyType string) string {
+	switch bodyType {
+	case bodyTypeForm:
+		return "application/x-www-form-urlencoded"
+	case bodyTypeRaw:
+		return "text/plain; charset=utf-8"
+	default:
+		return "application/json"
+	}
+}
+
+// callbackClient 用于成功/失败回调，使用独立的短超时，避免回调地址异常拖慢任务
+var callbackClient = &http.Client{Timeout: 10 * time.Second}
+
+// fireCallback 根据执行结果向任务配置的回调地址发送一次 GET 请求 (例如 healthchecks.io 的心跳地址)。
+// 回调是尽力而为的，失败只打印日志，不影响任务本身。
+func fireCallback(t *Task, success bool) {
+	target := t.OnFailureURL
+	if success {
+		target = t.OnSuccessURL
+	}
+	if target == "" {
+		return
+	}
+
+	resp, err := callbackClient.Get(target)
+	if err != nil {
+		fmt.Printf("任务 #%d 回调 %s 失败: %v\n", t.ID, target, err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		fmt.Printf("任务 #%d 回调 %s 返回状态: %d\n", t.ID, target, resp.StatusCode)
+	}
+}
+
+// logWriteLocks 按任务串行化日志写入 (任务ID -> *sync.Mutex)：同一任务的多个执行 (例如同时发生的定时和手动执行)
+// 并发写日志时，日志的时间顺序与ID顺序保持一致，响应体去重也只会引用已经写入的日志。
+// 不同任务的写入互不等待，一个任务的响应体上传到外部存储较慢时不会拖慢其他任务
+var logWriteLocks sync.Map
+
+// appendLog 向数据库添加一条日志，执行时间由此处统一填写，过大的响应体会转存到外部存储
+func appendLog(log *Log) {
+	escapeBody(log)
+	lock, _ := logWriteLocks.LoadOrStore(log.TaskID, new(sync.Mutex))
+	mu := lock.(*sync.Mutex)
+	mu.Lock()
+	defer mu.Unlock()
+	log.Time = time.Now()
+	dedupeBody(log)
+	offloadBody(log)
+	if err := db.Create(log).Error; err != nil {
+		// 写入失败的日志不能作为之后去重的引用
+		forgetBodyHash(log)
+		fmt.Printf("任务 #%d 写日志失败: %v\n", log.TaskID, err)
+	}
+}
+
+// newRequestID 生成一个随机的 UUID (v4) 字符串
+func newRequestID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		// crypto/rand 几乎不会失败，退化为基于时间的ID
+		return fmt.Sprintf("%d", time.Now().UnixNano())
+	}
+	b[6] = (b[6] & 0x0f) | 0x40 // 版本 4
+	b[8] = (b[8] & 0x3f) | 0x80 // RFC 4122 变体
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
+// fireReport 汇总单个任务在一段时间内的触发情况
+type fireReport struct {
+	TaskID   int    `json:"task_id"`
+	Name     string `json:"name"`
+	Expected int    `json:"expected"`
+	OnTime   int    `json:"on_time"`
+	Late     int    `json:"late"`
+	Missed   int    `json:"missed"`
+	MaxLagMs int64  `json:"max_lag_ms"`
+	// 漏触发的计划时间，便于排查
+	MissedAt []time.Time `json:"missed_at,omitempty"`
+}
+
+// schedulerHealth 根据日志中记录的计划时间，核对每个已调度任务在窗口内的实际触发情况
+func schedulerHealth(window time.Duration) []fireReport {
+	now := time.Now()
+
+	taskMutex.Lock()
+	var scheduled []Task
+	for id, t := range tasks {
+		if _, ok := cronIDs[id]; ok {
+			scheduled = append(scheduled, *t)
+		}
+	}
+	taskMutex.Unlock()
+
+	reports := make([]fireReport, 0, len(scheduled))
+	for _, t := range scheduled {
+		schedule, err := cronParser.Parse(cronSpec(&t))
+		if err != nil {
+			continue
+		}
+
+		// 窗口起点不早于进程启动和任务创建的时间；
+		// 窗口终点留出一次执行 (含重试) 的最长耗时，避免把仍在执行中的触发算作漏触发
+		from := now.Add(-window)
+		if from.Before(startTime) {
+			from = startTime
+		}
+		if from.Before(t.CreatedAt) {
+			from = t.CreatedAt
+		}
+		if from.Before(t.scheduledSince) {
+			from = t.scheduledSince
+		}
+		maxRun := time.Duration(t.Timeout*(t.MaxRetries+1)) * time.Second
+		for attempt := 1; attempt <= t.MaxRetries; attempt++ {
+			maxRun += retryDelayFor(&t, attempt)
+		}
+		to := now.Add(-maxRun - lateThreshold)
+		if !to.After(from) {
+			reports = append(reports, fireReport{TaskID: t.ID, Name: t.Name})
+			continue
+		}
+
+		// trigger 是 MySQL 的保留字，使用结构体条件由 GORM 给列名加上引号
+		var logs []Log
+		readDB.Select("scheduled_at", "lag_ms").Where(&Log{TaskID: t.ID, Trigger: triggerSchedule}).
+			Where("scheduled_at >= ? AND scheduled_at <= ?", from, to).
+			Find(&logs)
+		lags := make(map[int64]int64, len(logs))
+		for _, l := range logs {
+			lags[l.ScheduledAt.Unix()] = l.LagMs
+		}
+
+		rep := fireReport{TaskID: t.ID, Name: t.Name}
+		for at := schedule.Next(from.Add(-time.Nanosecond)); !at.IsZero() && !at.After(to); at = schedule.Next(at) {
+			rep.Expected++
+			lagMs, ok := lags[at.Unix()]
+			switch {
+			case !ok:
+				rep.Missed++
+				rep.MissedAt = append(rep.MissedAt, at)
+			case time.Duration(lagMs)*time.Millisecond > lateThreshold:
+				rep.Late++
+			default:
+				rep.OnTime++
+			}
+			if lagMs > rep.MaxLagMs {
+				rep.MaxLagMs = lagMs
+			}
+		}
+		reports = append(reports, rep)
+	}
+	return reports
+}
+
+// systemEntries 记录调度器中的系统定时作业 (过期检查、日志清理等)，重建调度器时保留
+var systemEntries = make(map[cron.EntryID]bool)
+
+// addSystemJob 注册一个系统定时作业，只在启动时调用
+func addSystemJob(spec string, fn func()) {
+	id, err := c.AddFunc(spec, fn)
+	if err != nil {
+		fmt.Printf("注册系统作业 %s 失败: %v\n", spec, err)
+		return
+	}
+	systemEntries[id] = true
+}
+
+// rebuildScheduler 停止调度器 (等待正在执行的作业结束)，移除所有任务的调度条目，包括不再被 cronIDs 记录的残留条目，
+// 然后从数据库重新加载并注册任务，最后重新启动调度器。任务的运行状态 (失败计数、去重状态等) 不受影响。
+// 返回重新注册到调度中的任务数和移除的残留条目数。
+func rebuildScheduler() (registered, orphaned int) {
+	backupMutex.Lock()
+	defer backupMutex.Unlock()
+
+	<-c.Stop().Done()
+	defer c.Start()
+
+	taskMutex.Lock()
+	for id := range cronIDs {
+		unschedule(id)
+	}
+	for id := range intervalTimers {
+		unschedule(id)
+	}
+	for _, entry := range c.Entries() {
+		if !systemEntries[entry.ID] {
+			c.Remove(entry.ID)
+			orphaned++
+		}
+	}
+	tasks = make(map[int]*Task)
+	taskMutex.Unlock()
+
+	loadTasksFromDB()
+
+	taskMutex.Lock()
+	for id := range tasks {
+		if isScheduled(id) {
+			registered++
+		}
+	}
+	taskMutex.Unlock()
+	fmt.Printf("调度器已重建: 重新注册 %d 个任务，移除 %d 个残留条目\n", registered, orphaned)
+	return registered, orphaned
+}
+
+// checkSchedulerHealth 定期自检最近一段时间的触发情况，发现延迟或漏触发时输出诊断信息
+func checkSchedulerHealth() {
+	for _, rep := range schedulerHealth(10 * time.Minute) {
+		if rep.Late == 0 && rep.Missed == 0 {
+			continue
+		}
+		msg := fmt.Sprintf("最近10分钟: 应触发 %d 次，延迟 %d 次，漏触发 %d 次，最大延迟 %dms",
+			rep.Expected, rep.Late, rep.Missed, rep.MaxLagMs)
+		fmt.Printf("[调度自检] 任务 #%d (%s) %s\n", rep.TaskID, rep.Name, msg)
+
+		taskMutex.Lock()
+		t, ok := tasks[rep.TaskID]
+		taskMutex.Unlock()
+		if ok {
+			notify(t, severityWarning, "任务触发延迟或遗漏", msg)
+		}
+	}
+}
+
+// escapeLike 转义 LIKE 模式中的通配符，配合 ESCAPE '!' 使用，使搜索词按字面匹配
+func escapeLike(s string) string {
+	return strings.NewReplacer("!", "!!", "%", "!%", "_", "!_").Replace(s)
+}
+
+// parseWindow 解析时间窗口参数，在 time.ParseDuration 的基础上额外支持以 "d" 结尾的天数，例如 "7d"
+func parseWindow(s string) (time.Duration, error) {
+	if strings.HasSuffix(s, "d") {
+		days, err := strconv.Atoi(strings.TrimSuffix(s, "d"))
+		if err != nil || days <= 0 {
+			return 0, fmt.Errorf("无法解析天数 %q", s)
+		}
+		return time.Duration(days) * 24 * time.Hour, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, err
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("时间窗口必须大于0")
+	}
+	return d, nil
+}
+
+// percentile 使用最近秩 (nearest-rank) 法计算已升序排列数据的第 p 百分位数，数据为空时返回0
+func percentile(sorted []int64, p int) int64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := (p*len(sorted) + 99) / 100 // 向上取整
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+// isExpired 判断任务是否已超过其过期时间
+func (t *Task) isExpired(now time.Time) bool {
+	return !t.ExpireAt.IsZero() && !now.Before(t.ExpireAt)
+}
+
+// retireExpiredTasks 将已过期的任务从调度中移除，并写入一条日志作为通知。
+// 任务本身及其日志仍保留在数据库中，仍可手动执行。
+func retireExpiredTasks() {
+	now := time.Now()
+	var retired []*Task
+
+	taskMutex.Lock()
+	for id, t := range tasks {
+		if isScheduled(id) && t.isExpired(now) {
+			unschedule(id)
+			retired = append(retired, t)
+		}
+	}
+	taskMutex.Unlock()
+
+	for _, t := range retired {
+		fmt.Printf("任务 #%d (%s) 已于 %s 过期，已停止调度\n", t.ID, t.Name, t.ExpireAt.Format(time.DateTime))
+		appendLog(&Log{TaskID: t.ID, StatusText: "任务已过期，已停止调度"})
+		notify(t, severityInfo, "任务已过期", "任务已于 "+t.ExpireAt.Format(time.DateTime)+" 过期，已停止调度")
+	}
+}
+
+// loadTasksFromDB 从数据库加载所有任务并注册它们
+func loadTasksFromDB() {
+	var list []Task
+	db.Find(&list)
+	fmt.Printf("从数据库加载了 %d 个任务...\n", len(list))
+	now := time.Now()
+	for i := range list {
+		// 使用拷贝，避免闭包问题
+		taskCopy := list[i]
+		if taskCopy.isExpired(now) || !taskCopy.Enabled {
+			// 已过期或已禁用的任务不再调度，但仍保留以便手动执行
+			taskMutex.Lock()
+			tasks[taskCopy.ID] = &taskCopy
+			taskMutex.Unlock()
+			continue
+		}
+		registerTask(&taskCopy)
+	}
+}
+
+// envTheme 读取默认主题配置，只接受 light 和 dark
+func envTheme(name string) string {
+	switch v := os.Getenv(name); v {
+	case "", "light":
+		return "light"
+	case "dark":
+		return v
+	default:
+		fmt.Printf("环境变量 %s 只支持 light 或 dark，使用默认值 light\n", name)
+		return "light"
+	}
+}
+
+// indexPage 是填入默认主题后的首页内容
+var indexPage = []byte(strings.Replace(htmlPage, "__DEFAULT_THEME__", defaultTheme, 1))
+
+// htmlPage 定义了前端页面的内容
+const htmlPage = `
+<!DOCTYPE html>
 <html lang="zh-CN">
 <head>
 <meta charset="utf-8">
 <title>定时任务管理器</title>
 <script src="/js/vue.global.prod.js"></script>
 <script src="/js/axios.min.js"></script>
+<script>
+	// 在页面渲染前应用主题，避免闪烁；用户的选择优先于服务端配置的默认主题
+	document.documentElement.dataset.theme = localStorage.getItem('pipigo-theme') || '__DEFAULT_THEME__'
+</script>
 <style>
-	body { font-family: -apple-system, BlinkMacSystemFont, "Segoe UI", Roboto, "Helvetica Neue", Arial, sans-serif; padding: 20px; background-color: #f4f7f9; color: #333; }
+	:root { --bg: #f4f7f9; --text: #333; --heading: #2c3e50; --card-bg: #fff; --border: #e1e4e8; --input-border: #ccc; --muted: #555; --subtle-bg: #f6f8fa; --dash: #eee; --note-bg: #fffbea; }
+	[data-theme="dark"] { --bg: #161b22; --text: #c9d1d9; --heading: #e6edf3; --card-bg: #0d1117; --border: #30363d; --input-border: #30363d; --muted: #8b949e; --subtle-bg: #21262d; --dash: #30363d; --note-bg: #2d2a1e; color-scheme: dark; }
+	body { font-family: -apple-system, BlinkMacSystemFont, "Segoe UI", Roboto, "Helvetica Neue", Arial, sans-serif; padding: 20px; background-color: var(--bg); color: var(--text); }
 	#app { max-width: 900px; margin: 0 auto; }
-	h1, h2 { color: #2c3e50; }
-	.form-container { background: #fff; padding: 20px; border-radius: 8px; box-shadow: 0 2px 10px rgba(0,0,0,0.05); margin-bottom: 20px; }
+	h1, h2 { color: var(--heading); }
+	h1 { display: flex; justify-content: space-between; align-items: center; }
+	.btn-theme { background-color: var(--subtle-bg); color: var(--text); border: 1px solid var(--border); font-size: 13px; }
+	.form-container { background: var(--card-bg); padding: 20px; border-radius: 8px; box-shadow: 0 2px 10px rgba(0,0,0,0.05); margin-bottom: 20px; }
 	.form-grid { display: grid; grid-template-columns: repeat(2, 1fr); gap: 15px; }
 	.form-group { display: flex; flex-direction: column; }
     .full-width { grid-column: 1 / -1; }
-	input, select, textarea { padding: 10px; border: 1px solid #ccc; border-radius: 4px; font-size: 14px; margin-top: 5px; }
+	input, select, textarea { padding: 10px; border: 1px solid var(--input-border); background-color: var(--card-bg); color: var(--text); border-radius: 4px; font-size: 14px; margin-top: 5px; }
 	textarea { resize: vertical; min-height: 80px; font-family: monospace; }
 	button { padding: 10px 15px; border: none; border-radius: 4px; color: #fff; cursor: pointer; font-size: 14px; transition: background-color 0.2s; }
 	.btn-add { background-color: #28a745; margin-top: 10px; }
@@ -292,84 +2306,734 @@ const htmlPage = `
 	.btn-delete { background-color: #dc3545; }
 	.btn-delete:hover { background-color: #c82333; }
 	.task-list { margin-top: 20px; }
-	.task { background: #fff; border: 1px solid #e1e4e8; padding: 15px; margin-bottom: 15px; border-radius: 8px; box-shadow: 0 1px 5px rgba(0,0,0,0.03); }
+	.task { background: var(--card-bg); border: 1px solid var(--border); padding: 15px; margin-bottom: 15px; border-radius: 8px; box-shadow: 0 1px 5px rgba(0,0,0,0.03); }
 	.task-header { display: flex; justify-content: space-between; align-items: center; }
-	.task-details { font-size: 14px; color: #555; margin: 10px 0; word-break: break-all; }
+	.task-details { font-size: 14px; color: var(--muted); margin: 10px 0; word-break: break-all; }
 	.task-actions button { margin-left: 5px; }
 	.logs-container { margin-top: 10px; }
-	.log-entry { font-size: 13px; color: #555; border-top: 1px dashed #eee; padding-top: 10px; margin-top: 10px; }
+	.log-entry { font-size: 13px; color: var(--muted); border-top: 1px dashed var(--dash); padding-top: 10px; margin-top: 10px; }
 	.log-entry:first-child { border-top: none; padding-top: 0; margin-top: 0; }
-	.response-body { background-color: #f6f8fa; padding: 10px; border-radius: 4px; margin-top: 5px; white-space: pre-wrap; word-break: break-all; max-height: 200px; overflow-y: auto; font-family: monospace; }
+	.response-body { background-color: var(--subtle-bg); padding: 10px; border-radius: 4px; margin-top: 5px; white-space: pre-wrap; word-break: break-all; max-height: 200px; overflow-y: auto; font-family: monospace; }
 	.tag { background-color: #eef; color: #0366d6; padding: 2px 6px; border-radius: 4px; font-size: 12px; font-weight: bold; }
+	.channel { padding: 8px 0; border-bottom: 1px dashed var(--dash); font-size: 14px; }
+	.channel .task-actions { float: right; }
+	.notes-input { min-height: 50px; font-family: inherit; }
+	.task-description { color: var(--muted); font-size: 14px; margin-top: -5px; }
+	.task-notes { white-space: pre-wrap; background-color: var(--note-bg); border-left: 3px solid #f0c36d; padding: 6px 10px; margin-top: 5px; }
+	.inline-select { margin: 0 0 0 8px; padding: 2px 6px; font-size: 13px; }
+	.form-row { display: grid; grid-template-columns: 1fr 1fr auto; gap: 8px; margin-top: 5px; }
+	.form-row input { margin-top: 0; }
+	.form-row.validator-row { grid-template-columns: auto 1fr 1fr auto; }
+	.form-row select { margin-top: 0; }
+	.history-table { width: 100%; border-collapse: collapse; font-size: 13px; margin-top: 8px; }
+	.history-table th, .history-table td { border-bottom: 1px solid var(--dash); padding: 4px 6px; text-align: left; word-break: break-all; }
+	.cron-desc { color: #888; }
+	.tag-warn { background-color: #fff3cd; color: #856404; }
+	.log-failed { color: #dc3545; }
+	.tag-ok { background-color: #e6f4ea; color: #1e7e34; }
+	.tag-fail { background-color: #fdecea; color: #dc3545; }
+	.card-badges { display: flex; flex-wrap: wrap; align-items: center; gap: 4px; font-size: 12px; color: var(--muted); margin-top: 8px; }
+	.card-badges .badge-label { margin-left: 8px; }
+	.card-badges .badge-label:first-child { margin-left: 0; }
+	.project-add { display: flex; gap: 8px; margin-bottom: 10px; }
+	.project-add input { margin-top: 0; flex: 1; }
+	.project-header { display: flex; justify-content: space-between; align-items: center; border-bottom: 2px solid var(--border); padding-bottom: 5px; }
+	.project-toggle { cursor: pointer; user-select: none; }
+	.login-overlay { position: fixed; inset: 0; background: rgba(0,0,0,0.5); display: flex; align-items: center; justify-content: center; z-index: 10; }
+	.login-box { width: 320px; }
+	.palette-overlay { position: fixed; inset: 0; background: rgba(0,0,0,0.4); display: flex; justify-content: center; align-items: flex-start; padding-top: 15vh; z-index: 20; }
+	.palette { width: 560px; max-width: 90vw; background: var(--card-bg); border-radius: 8px; box-shadow: 0 8px 30px rgba(0,0,0,0.3); overflow: hidden; }
+	.palette input { margin: 0; border: none; border-bottom: 1px solid var(--border); border-radius: 0; font-size: 16px; padding: 14px; }
+	.palette ul { list-style: none; margin: 0; padding: 0; max-height: 50vh; overflow-y: auto; }
+	.palette li { padding: 8px 14px; cursor: pointer; display: flex; justify-content: space-between; gap: 10px; }
+	.palette li.active { background-color: var(--bg); }
+	.palette-hint { font-size: 12px; color: #888; padding: 6px 14px; border-top: 1px solid var(--border); }
+	.simulate-panel { margin-top: 10px; }
+	.input-extra { margin-top: 6px; }
+	.show-all { display: block; font-size: 14px; margin-bottom: 10px; }
+	.task-search { margin-bottom: 10px; }
+	.task-search input { width: 100%; box-sizing: border-box; }
+	.current-user { font-size: 14px; font-weight: normal; margin-right: 10px; }
+	.stats-bar { background-color: var(--card-bg); border: 1px solid var(--border); padding: 10px 15px; border-radius: 8px; margin-bottom: 20px; color: var(--muted); }
+	.stats-bar strong { color: var(--text); }
+	.banner-warn { background-color: #fff3cd; color: #856404; border: 1px solid #ffe69c; padding: 10px 15px; border-radius: 8px; margin-bottom: 20px; }
+	.btn-pin { background-color: #6c757d; }
+	.btn-pin:hover { background-color: #5a6268; }
+	.pin-mark { margin-right: 4px; }
+	.checkbox { width: auto; margin-right: 4px; }
+	.task-disabled { opacity: 0.55; }
+	.switch { position: relative; display: inline-block; width: 36px; height: 20px; vertical-align: middle; margin-right: 6px; }
+	.switch input { opacity: 0; width: 0; height: 0; }
+	.switch .slider { position: absolute; inset: 0; background-color: #adb5bd; border-radius: 20px; cursor: pointer; transition: background-color 0.2s; }
+	.switch .slider::before { content: ""; position: absolute; width: 14px; height: 14px; left: 3px; top: 3px; background-color: #fff; border-radius: 50%; transition: transform 0.2s; }
+	.switch input:checked + .slider { background-color: #28a745; }
+	.switch input:checked + .slider::before { transform: translateX(16px); }
+	.btn-link { background: none; color: #007bff; padding: 0; font-size: 13px; }
+	.btn-link:hover { text-decoration: underline; }
+	.latency-gauges { display: grid; grid-template-columns: repeat(4, 1fr); gap: 10px; font-size: 13px; margin-top: 8px; }
+	.latency-gauges meter { width: 100%; height: 12px; }
+	.schedule-preview { margin: 6px 0 0; padding-left: 24px; font-size: 13px; }
 </style>
 </head>
 <body>
 <div id="app">
-	<h1>定时任务管理器</h1>
-	<div class="form-container">
-		<h2>添加新任务</h2>
+	<h1>定时任务管理器
+		<span>
+			<span v-if="username" class="current-user">{{ username }}<span v-if="me && me.is_admin" class="tag">管理员</span> <button @click="logout" class="btn-link">退出登录</button></span>
+			<button @click="openPalette" class="btn-link" title="命令面板 (Ctrl+K)">⌘K</button>
+			<button @click="toggleTheme" class="btn-theme">{{ theme === 'dark' ? '☀️ 浅色模式' : '🌙 深色模式' }}</button>
+		</span>
+	</h1>
+	<div v-if="needLogin" class="login-overlay">
+		<div class="form-container login-box">
+			<h2>登录</h2>
+			<div class="form-group">
+				<label>用户名</label>
+				<input v-model.trim="loginForm.username" autocomplete="username">
+			</div>
+			<div class="form-group">
+				<label>密码</label>
+				<input v-model="loginForm.password" type="password" autocomplete="current-password" @keyup.enter="login">
+			</div>
+			<div v-if="loginNeedsCode" class="form-group">
+				<label>两步验证码</label>
+				<input v-model.trim="loginForm.code" inputmode="numeric" autocomplete="one-time-code" placeholder="验证器应用中的6位数字" @keyup.enter="login">
+			</div>
+			<button @click="login" class="btn-add">登录</button>
+		</div>
+	</div>
+	<div v-if="palette.open" class="palette-overlay" @click.self="closePalette">
+		<div class="palette" role="dialog" aria-modal="true" aria-label="命令面板">
+			<input ref="paletteInput" v-model="palette.query" @input="palette.index = 0" @keydown="paletteKeydown"
+				placeholder="搜索任务或命令…" role="combobox" aria-controls="palette-list" aria-expanded="true"
+				:aria-activedescendant="paletteItems.length > 0 ? 'palette-item-' + palette.index : null">
+			<ul id="palette-list" role="listbox">
+				<li v-for="(item, i) in paletteItems" :key="item.key" :id="'palette-item-' + i" role="option" :aria-selected="i === palette.index"
+					:class="{ active: i === palette.index }" @click="runPaletteItem(item)" @mousemove="palette.index = i">
+					<span>{{ item.label }}</span>
+					<span class="cron-desc">{{ item.hint }}</span>
+				</li>
+				<li v-if="paletteItems.length === 0" class="cron-desc">没有匹配的任务</li>
+			</ul>
+			<div class="palette-hint">↑↓ 选择，Enter 执行任务，Shift+Enter 定位到任务，Esc 关闭</div>
+		</div>
+	</div>
+	<div v-if="breaker && breaker.state !== 'closed'" class="banner-warn">
+		<strong>{{ breaker.state === 'open' ? '全局熔断中' : '熔断试探中' }}:</strong>
+		整体失败率过高，定时执行已暂停<span v-if="breaker.state === 'half_open'">，正在逐个试探</span>。
+		<button @click="resetBreaker" class="btn-link">解除熔断</button>
+	</div>
+	<div v-if="stats && stats.total.runs > 0" class="stats-bar">
+		最近24小时: 执行 <strong>{{ stats.total.runs }}</strong> 次，成功率 <strong>{{ (stats.total.success_rate * 100).toFixed(1) }}%</strong>，失败 <strong :class="{ 'log-failed': stats.total.failures > 0 }">{{ stats.total.failures }}</strong> 次<template v-if="stats.total.skipped">，跳过 {{ stats.total.skipped }} 次</template>，平均耗时 <strong>{{ Math.round(stats.total.avg_duration_ms) }}ms</strong>，最近执行于 {{ formatTime(stats.total.last_run) }}
+	</div>
+	<div id="add-task-form" class="form-container">
+		<h2>{{ editingTaskId ? '编辑任务 #' + editingTaskId : '添加新任务' }} <button v-if="editingTaskId" @click="cancelEdit" class="btn-link">取消编辑</button></h2>
+		<div class="form-grid">
+			<div class="form-group">
+				<label>任务名称*</label>
+				<input ref="newTaskName" v-model.trim="newTask.name" placeholder="例如：每日数据同步">
+			</div>
+			<div class="form-group">
+				<label>
+					执行计划*
+					<select v-model="scheduleMode" class="inline-select">
+						<option value="cron">Cron 表达式</option>
+						<option value="interval">间隔模式</option>
+					</select>
+				</label>
+				<template v-if="scheduleMode === 'cron'">
+					<input v-model.trim="newTask.cron" @input="describeNewCron" placeholder="例如: 0 30 1 * * * (每天1:30执行)">
+					<small v-if="cronDescription" class="cron-desc">{{ cronDescription }}</small>
+					<input v-model.trim="newTask.cron_template" placeholder="或使用 Cron 模板错开执行时间，例如: 0 {{mod .ID 60}} * * * *" class="input-extra">
+					<input v-model.trim="newTask.timezone" list="timezone-options" placeholder="时区 (可选，默认为服务器时区)，例如: Asia/Shanghai" class="input-extra">
+					<datalist id="timezone-options">
+						<option value="UTC"></option>
+						<option value="Asia/Shanghai"></option>
+						<option value="Asia/Tokyo"></option>
+						<option value="Europe/London"></option>
+						<option value="America/New_York"></option>
+						<option value="America/Los_Angeles"></option>
+					</datalist>
+				</template>
+				<template v-else>
+					<input type="number" v-model.number="newTask.interval_seconds" min="1" placeholder="上次执行完成后间隔的秒数，例如 300">
+					<small class="cron-desc">执行耗时较长时不会重叠，适合耗时不固定的任务</small>
+				</template>
+			</div>
+			<div class="form-group full-width">
+				<label>任务说明</label>
+				<input v-model.trim="newTask.description" placeholder="例如：同步订单数据到数据仓库">
+			</div>
+			<div class="form-group full-width">
+				<label>备注 (负责人、运行手册链接等)</label>
+				<textarea v-model="newTask.notes" class="notes-input" placeholder="负责人: 张三&#10;运行手册: https://wiki.example.com/runbook"></textarea>
+			</div>
+			<div class="form-group full-width">
+				<label>请求预处理脚本 (可选，每行 "请求头: 模板"，需服务端开启 PIPIGO_ALLOW_SCRIPTS)</label>
+				<textarea v-model="newTask.pre_request_script" placeholder="X-Timestamp: {{.Timestamp}}&#10;X-Signature: {{hmacSHA256 &quot;secret&quot; (printf &quot;%d.%s&quot; .Timestamp .Body)}}"></textarea>
+			</div>
+			<div class="form-group full-width">
+				<label><input type="checkbox" v-model="newTask.templated" class="checkbox"> 请求模板：URL、请求头和请求体在每次执行前按 Go 模板渲染，可用 <code v-pre>{{.Now}}</code>、<code v-pre>{{.Date "2006-01-02"}}</code>、<code v-pre>{{.Unix}}</code>、<code v-pre>{{.UnixMs}}</code>、<code v-pre>{{env "TOKEN"}}</code> (读取环境变量需服务端开启 PIPIGO_ALLOW_SCRIPTS)</label>
+			</div>
+			<div class="form-group full-width">
+				<label><input type="checkbox" v-model="newTask.insecure_skip_verify" class="checkbox"> 跳过 TLS 证书校验：仅用于使用自签名证书的可信内部服务，开启后无法防范中间人攻击</label>
+			</div>
+			<div class="form-group full-width">
+				<label><input type="checkbox" v-model="newTask.sample_failures" class="checkbox"> 失败采样：连续相同的失败只保存第一条的完整响应体，节省存储空间</label>
+			</div>
+			<div class="form-group full-width">
+				<label>请求地址 (URL)*</label>
+				<input v-model.trim="newTask.url" placeholder="https://api.example.com/data">
+			</div>
+			<div class="form-group full-width">
+				<label>其他地址 (可选，每行一个，每次执行会同时请求所有地址)</label>
+				<textarea v-model="newTask.urls_text" placeholder="https://eu.api.example.com/data&#10;https://us.api.example.com/data"></textarea>
+			</div>
+			<div class="form-group">
+				<label>请求方法</label>
+				<select v-model="newTask.method">
+					<option>POST</option>
+					<option>GET</option>
+					<option>PUT</option>
+					<option>PATCH</option>
+					<option>DELETE</option>
+					<option>HEAD</option>
+				</select>
+			</div>
+            <div class="form-group">
+				<label>超时时间 (秒)</label>
+				<input type="number" v-model.number="newTask.timeout" placeholder="默认10秒">
+			</div>
+			<div class="form-group">
+				<label>响应头超时 (秒，可选，连接后迟迟不返回响应头时尽快失败，需小于超时时间)</label>
+				<input type="number" v-model.number="newTask.response_header_timeout" min="0" placeholder="例如 3">
+			</div>
+			<div class="form-group">
+				<label>空闲连接超时 (秒，可选，空闲连接保留复用的时间，默认90秒)</label>
+				<input type="number" v-model.number="newTask.idle_conn_timeout" min="0" placeholder="例如 30">
+			</div>
+			<div class="form-group full-width">
+				<label><input type="checkbox" v-model="newTask.follow_redirects" class="checkbox"> 跟随重定向 (关闭后记录 3xx 状态码和 Location，不请求跳转后的地址)</label>
+			</div>
+			<div class="form-group" v-if="newTask.follow_redirects">
+				<label>最大重定向次数 (可选，默认10次)</label>
+				<input type="number" v-model.number="newTask.max_redirects" min="0" placeholder="例如 3">
+			</div>
+			<div class="form-group">
+				<label>合并窗口 (秒，可选，定时和手动执行在此时间内先后开始时只执行先开始的一次)</label>
+				<input type="number" v-model.number="newTask.coalesce_seconds" min="0" placeholder="例如 10">
+			</div>
+			<div class="form-group">
+				<label>响应时间异常检测 (标准差倍数，可选，耗时超过近期均值加该倍数的标准差时标记为异常)</label>
+				<input type="number" v-model.number="newTask.anomaly_k" min="0" step="0.5" placeholder="例如 3">
+			</div>
+			<div class="form-group full-width" v-if="newTask.anomaly_k > 0">
+				<label><input type="checkbox" v-model="newTask.anomaly_notify" class="checkbox"> 响应时间异常和恢复时发送通知</label>
+			</div>
+			<div class="form-group">
+				<label>失败重试次数 (连接失败、超时、5xx 和 429 时重试；POST、PATCH 默认只在请求未送达时重试)</label>
+				<input type="number" v-model.number="newTask.max_retries" placeholder="默认不重试">
+			</div>
+			<div class="form-group" v-if="['POST', 'PATCH'].includes((newTask.method || '').toUpperCase()) && newTask.max_retries > 0">
+				<label><input type="checkbox" v-model="newTask.idempotent_retry" class="checkbox"> 接口幂等，可安全重试 (收到 5xx、429 或等待响应超时时也重试)</label>
+			</div>
+			<div class="form-group">
+				<label>首次重试间隔 (毫秒，之后每次翻倍，0为默认1秒)</label>
+				<input type="number" v-model.number="newTask.retry_delay_ms" min="0" placeholder="1000">
+			</div>
+			<div class="form-group">
+				<label>重试预算 (每小时最多重试次数，0为不限)</label>
+				<input type="number" v-model.number="newTask.retry_budget" placeholder="0">
+			</div>
+			<div class="form-group">
+				<label>过期时间 (可选，到期后自动停止调度)</label>
+				<input type="datetime-local" v-model="newTask.expire_at">
+			</div>
+			<div class="form-group">
+				<label>所属项目</label>
+				<select v-model="newTask.project_id">
+					<option :value="null">未分组</option>
+					<option v-for="p in projects" :key="p.id" :value="p.id">{{ p.name }}</option>
+				</select>
+			</div>
+			<div class="form-group full-width">
+				<label>通知渠道 (可选，多个用逗号分隔)</label>
+				<input v-model.trim="newTask.channels" :placeholder="channels.length ? '可用渠道: ' + channels.map(ch => ch.name).join(', ') : '请先在下方添加通知渠道'">
+			</div>
+			<div class="form-group">
+				<label>持续失败时每隔多少分钟再通知 (0为不重复)</label>
+				<input type="number" v-model.number="newTask.notify_throttle_minutes" placeholder="0">
+			</div>
+			<div class="form-group">
+				<label>持续失败时每连续失败多少次再通知 (0为不重复)</label>
+				<input type="number" v-model.number="newTask.notify_failure_threshold" placeholder="0">
+			</div>
+			<div class="form-group">
+				<label>失败通知 webhook (可选，每次失败 POST 一次 JSON)</label>
+				<input v-model.trim="newTask.notify_webhook_url" placeholder="https://hooks.example.com/incidents">
+			</div>
+			<div class="form-group">
+				<label>成功回调地址 (可选)</label>
+				<input v-model.trim="newTask.on_success_url" placeholder="https://hc-ping.com/your-uuid">
+			</div>
+			<div class="form-group">
+				<label>失败回调地址 (可选)</label>
+				<input v-model.trim="newTask.on_failure_url" placeholder="https://hc-ping.com/your-uuid/fail">
+			</div>
+			<div class="form-group full-width">
+				<label>请求头 (Headers) - JSON格式</label>
+				<textarea v-model="newTask.headers" placeholder='{ "Authorization": "Bearer YOUR_TOKEN" }'></textarea>
+			</div>
+			<div class="form-group full-width" v-if="newTaskHasBody">
+				<label>
+					请求体 (Body)
+					<select v-model="newTask.body_type" class="inline-select">
+						<option value="json">JSON</option>
+						<option value="form">表单 (form)</option>
+						<option value="raw">原始文本 (raw)</option>
+					</select>
+					<button v-if="newTask.body_type === 'json'" @click="formatBody" class="btn-link" type="button">格式化</button>
+				</label>
+				<div v-if="newTask.body_type === 'form'">
+					<div v-for="(row, i) in formRows" :key="i" class="form-row">
+						<input v-model="row.key" placeholder="键">
+						<input v-model="row.value" placeholder="值">
+						<button @click="formRows.splice(i, 1)" class="btn-delete" type="button">移除</button>
+					</div>
+					<button @click="formRows.push({ key: '', value: '' })" class="btn-link" type="button">+ 添加字段</button>
+				</div>
+				<textarea v-else v-model="newTask.body" :placeholder="newTask.body_type === 'json' ? '{ &quot;key&quot;: &quot;value&quot;, &quot;id&quot;: 123 }' : '任意文本'"></textarea>
+				<input v-model.trim="newTask.body_url" placeholder="或填写请求体地址：每次执行前从该地址获取请求体，例如 https://config.example.com/payload.json" class="input-extra">
+			</div>
+		</div>
+		<div class="form-group full-width">
+			<label>OAuth2 客户端凭据 (可选，填写令牌地址后每次请求前自动获取访问令牌并设置 Authorization 请求头)</label>
+			<div class="form-row">
+				<input v-model.trim="newTask.oauth_token_url" placeholder="令牌地址，例如 https://auth.example.com/oauth/token">
+				<input v-model.trim="newTask.oauth_scopes" placeholder="授权范围，以空格分隔 (可选)">
+			</div>
+			<div class="form-row">
+				<input v-model.trim="newTask.oauth_client_id" placeholder="客户端ID">
+				<input v-model="newTask.oauth_client_secret" type="password" placeholder="客户端密钥" autocomplete="new-password">
+			</div>
+		</div>
+		<div class="form-group full-width">
+			<label>AWS SigV4 签名 (可选，填写访问密钥ID后每次请求按 AWS Signature Version 4 签名，不能与 OAuth2 同时使用)</label>
+			<div class="form-row">
+				<input v-model.trim="newTask.sigv4_access_key" placeholder="访问密钥ID，例如 AKIA...">
+				<input v-model="newTask.sigv4_secret_key" type="password" placeholder="私有访问密钥" autocomplete="new-password">
+			</div>
+			<div class="form-row">
+				<input v-model.trim="newTask.sigv4_region" placeholder="区域，例如 us-east-1">
+				<input v-model.trim="newTask.sigv4_service" placeholder="服务名称，例如 execute-api">
+			</div>
+		</div>
+		<div class="form-group full-width">
+			<label>功能开关 (可选，每次定时执行前请求该地址，开关关闭时跳过本次执行；不填字段路径时地址返回 2xx 即视为开启)</label>
+			<div class="form-row">
+				<input v-model.trim="newTask.guard_flag_url" placeholder="开关地址，例如 https://flags.example.com/api/flags/nightly-jobs">
+				<input v-model.trim="newTask.guard_flag_path" placeholder="字段路径 (可选)，例如 data.enabled">
+			</div>
+		</div>
+		<div v-if="holidayCalendars.length > 0" class="form-group full-width">
+			<label><input type="checkbox" v-model="newTask.skip_holidays" class="checkbox"> 节假日跳过：定时执行的当天在节假日日历中时跳过本次执行</label>
+			<select v-if="newTask.skip_holidays" v-model="newTask.holiday_calendar">
+				<option value="">默认日历</option>
+				<option v-for="cal in holidayCalendars" :key="cal.name" :value="cal.name">{{ cal.name }}<template v-if="cal.upcoming.length"> (下一个: {{ cal.upcoming[0] }})</template></option>
+			</select>
+		</div>
+		<div class="form-group full-width">
+			<label>成功状态码 (可选，默认只有 2xx 视为成功；包含 3xx 时不跟随重定向)</label>
+			<input v-model.trim="newTask.success_status_ranges" placeholder="例如 200-299,304,418">
+		</div>
+		<div class="form-group full-width">
+			<label>日志保留天数 (可选，超过的日志会被定期清理，默认使用服务端的全局设置)</label>
+			<input type="number" v-model.number="newTask.retention_days" min="0" placeholder="例如 90">
+		</div>
+		<div class="form-group full-width">
+			<label>响应体大小上限 (可选，字节，超出部分截断后保存，默认 1MB)</label>
+			<input type="number" v-model.number="newTask.max_body_bytes" min="0" placeholder="例如 65536">
+		</div>
+		<div class="form-group full-width">
+			<label>保存响应体的类型 (可选，Content-Type 前缀，逗号分隔，其他类型只记录类型和大小，* 表示全部保存，默认使用服务端的全局设置)</label>
+			<input v-model.trim="newTask.body_content_types" placeholder="例如 application/json,text/">
+		</div>
+		<div class="form-group full-width">
+			<label>响应断言 (可选，状态码不等于期望状态码或响应体不包含期望内容时记为失败)</label>
+			<div class="form-row">
+				<input type="number" v-model.number="newTask.expect_status" min="100" max="599" placeholder="期望状态码，例如 200">
+				<input v-model="newTask.expect_body_contains" placeholder="响应体包含的内容，例如 &quot;status&quot;:&quot;ok&quot;">
+			</div>
+		</div>
+		<div class="form-group full-width">
+			<label>期望响应头 (可选，状态码成功时还要求该响应头的值符合期望，期望值写成 /正则/ 时按正则匹配)</label>
+			<div class="form-row">
+				<input v-model.trim="newTask.expect_header" placeholder="响应头名称，例如 X-Health">
+				<input v-model="newTask.expect_header_value" placeholder="期望值，例如 ok 或 /^(ok|degraded)$/">
+			</div>
+		</div>
+		<div class="form-group full-width">
+			<label>校验规则 (可选，按顺序检查，全部通过才视为成功；期望值写成 /正则/ 时按正则匹配，留空表示只要求存在)</label>
+			<div v-for="(v, i) in newTask.validators" :key="i" class="form-row validator-row">
+				<select v-model="v.type">
+					<option value="status">状态码</option>
+					<option value="header">响应头</option>
+					<option value="body_contains">响应体包含</option>
+					<option value="body_regex">响应体正则</option>
+					<option value="json_path">JSON 字段</option>
+				</select>
+				<input v-model.trim="v.target" :disabled="!validatorHasTarget(v)" :placeholder="validatorPlaceholder(v).target">
+				<input v-model="v.value" :placeholder="validatorPlaceholder(v).value">
+				<button @click="newTask.validators.splice(i, 1)" class="btn-delete" type="button">移除</button>
+			</div>
+			<button @click="newTask.validators.push({ type: 'json_path', target: '', value: '' })" class="btn-link" type="button">+ 添加校验规则</button>
+		</div>
+		<div class="form-group full-width">
+			<label>提取字段 (可选，从 JSON 响应中提取，作为执行历史的列展示)</label>
+			<div v-for="(ex, i) in newTask.extractions" :key="i" class="form-row">
+				<input v-model.trim="ex.name" placeholder="列名，例如 count">
+				<input v-model.trim="ex.path" placeholder="路径，例如 data.items[0].count">
+				<button @click="newTask.extractions.splice(i, 1)" class="btn-delete" type="button">移除</button>
+			</div>
+			<button @click="newTask.extractions.push({ name: '', path: '' })" class="btn-link" type="button">+ 添加提取字段</button>
+		</div>
+		<div v-if="!editingTaskId" class="form-group full-width">
+			<label><input type="checkbox" v-model="runNow" class="checkbox"> 创建后立即执行一次，确认任务配置正确</label>
+		</div>
+		<button @click="addTask" class="btn-add">{{ editingTaskId ? '保存修改' : '添加任务' }}</button>
+	</div>
+
+	<div class="task-list">
+		<h2>任务列表 <button @click="validateAll" class="btn-link">校验全部 Cron 表达式</button> <button @click="smokeTestAll" class="btn-link" :disabled="smokeTesting">{{ smokeTesting ? '试运行中...' : '试运行全部任务' }}</button> <button @click="bulkUpdate" class="btn-link" :disabled="selectedIds.length === 0">批量修改所选 ({{ selectedIds.length }})</button> <button @click="bulkDelete" class="btn-link" :disabled="selectedIds.length === 0">删除所选</button> <button @click="exportScript" class="btn-link">导出为脚本</button> <button @click="$refs.postmanFile.click()" class="btn-link">从 Postman 导入</button> <button @click="exportPostman" class="btn-link">导出到 Postman</button><input ref="postmanFile" type="file" accept=".json,application/json" @change="importPostman" style="display: none"></h2>
+		<div class="task-search">
+			<input v-model="search" @input="searchTasks" type="search" placeholder="按名称或地址搜索任务">
+		</div>
+		<label v-if="authEnabled && me && me.is_admin" class="show-all">
+			<input type="checkbox" v-model="showAll" @change="loadTasks" class="checkbox"> 显示所有用户的任务
+		</label>
+		<div v-if="search.trim() && tasks.length === 0" class="cron-desc">没有名称或地址包含 "{{ search.trim() }}" 的任务</div>
+		<div class="project-add">
+			<input v-model.trim="newProjectName" placeholder="新项目名称" @keyup.enter="addProject">
+			<button @click="addProject" class="btn-action">添加项目</button>
+		</div>
+		<div v-for="group in taskGroups" :key="group.key">
+			<h3 v-if="projects.length > 0" class="project-header">
+				<span @click="collapsedProjects[group.key] = !collapsedProjects[group.key]" class="project-toggle">
+					{{ collapsedProjects[group.key] ? '▸' : '▾' }} {{ group.name }} <span class="cron-desc">({{ group.tasks.length }})</span>
+				</span>
+				<button v-if="group.project" @click="deleteProject(group.project)" class="btn-link">删除项目</button>
+			</h3>
+			<div v-for="task in group.tasks" v-show="!collapsedProjects[group.key]" :key="task.id" :id="'task-' + task.id" :class="['task', { 'task-disabled': !task.enabled }]">
+				<div class="task-header">
+					<h3><input type="checkbox" v-model="selectedIds" :value="task.id" title="选择任务以批量修改"> <span v-if="task.pinned" class="pin-mark" title="已置顶">📌</span>{{ task.name }} <span v-if="task.flapping" class="tag tag-warn" title="最近的执行结果频繁在成功和失败之间切换">状态不稳定</span> <span v-if="!task.enabled" class="tag">已禁用</span> <span v-if="task.source" class="tag" title="该任务由任务配置文件管理，需要修改配置文件来变更">配置文件: {{ task.source }}</span> <span v-if="task.insecure_skip_verify" class="tag tag-warn" title="该任务不校验 TLS 证书">跳过证书校验</span> <span v-if="running[task.id]" class="tag tag-warn" title="任务执行时间较长，仍在等待响应">执行中 {{ Math.round(running[task.id] / 1000) }} 秒</span></h3>
+					<div class="task-actions">
+						<label class="switch" :title="task.enabled ? '已启用，点击禁用 (保留配置和日志)' : '已禁用，点击启用'">
+							<input type="checkbox" :checked="task.enabled" :disabled="!!task.source" @change="toggleTask(task)"><span class="slider"></span>
+						</label>
+						<button @click="togglePin(task)" class="btn-pin">{{ task.pinned ? '取消置顶' : '置顶' }}</button>
+						<button @click="runTask(task.id)" class="btn-action">立即执行</button>
+						<button @click="runTaskWithTimeout(task)" class="btn-action" title="仅本次执行使用指定的超时时间">指定超时执行</button>
+						<button v-if="!task.source" @click="editTask(task)" class="btn-action">编辑</button>
+						<button @click="cloneTask(task.id)" class="btn-action">复制</button>
+						<button v-if="!task.source" @click="deleteTask(task.id)" class="btn-delete">删除</button>
+					</div>
+				</div>
+				<div v-if="task.description" class="task-description">{{ task.description }}</div>
+				<div class="card-badges">
+					<span class="badge-label">期望:</span>
+					<span v-for="b in expectedBadges(task)" :key="'e-' + b.text" :class="['tag', b.cls]" :title="b.title">{{ b.text }}</span>
+					<span class="badge-label">最近一次:</span>
+					<span v-for="b in actualBadges(task)" :key="'a-' + b.text" :class="['tag', b.cls]" :title="b.title">{{ b.text }}</span>
+				</div>
+				<div class="task-details">
+					<div><span class="tag">{{ task.method }}</span> {{ task.url }}</div>
+					<div v-if="task.interval_seconds"><strong>执行计划:</strong> 间隔模式，{{ task.cron_description }}</div>
+					<div v-else><strong>Cron:</strong> {{ task.cron }} <span v-if="task.cron_description && task.cron_description !== task.cron" class="cron-desc">({{ task.cron_description }})</span><span v-if="task.cron_template" class="cron-desc"> 由模板 <code>{{ task.cron_template }}</code> 计算</span><span v-if="task.timezone" class="cron-desc"> 时区 {{ task.timezone }}</span></div>
+					<div><strong>下次执行时间:</strong> {{ task.enabled ? formatTime(task.next_run) : '已禁用，不会定时执行' }}</div>
+					<div v-if="!isZeroTime(task.prev_run)" title="调度器记录的上一次触发的计划时间，触发后被跳过或仍在执行中时可能没有对应的日志">
+						<strong>调度器上次触发:</strong> {{ formatTime(task.prev_run) }}
+						<span v-if="!hasLogForTrigger(task)" class="tag tag-warn">未找到对应的执行日志</span>
+					</div>
+					<div v-if="task.notes" class="task-notes">{{ task.notes }}</div>
+					<div v-if="authEnabled && me && me.is_admin && users.length > 0"><strong>所有者:</strong>
+						<select :value="task.owner_id" @change="changeOwner(task, Number($event.target.value))" class="inline-select">
+							<option v-if="!users.some(u => u.id === task.owner_id)" :value="task.owner_id">(无)</option>
+							<option v-for="u in users" :key="u.id" :value="u.id">{{ u.username }}</option>
+						</select>
+					</div>
+					<div v-if="task.channels"><strong>通知渠道:</strong> {{ task.channels }}
+						<span v-if="task.notify_throttle_minutes || task.notify_failure_threshold" class="cron-desc">
+							(持续失败时<span v-if="task.notify_throttle_minutes">每 {{ task.notify_throttle_minutes }} 分钟</span><span v-if="task.notify_throttle_minutes && task.notify_failure_threshold">或</span><span v-if="task.notify_failure_threshold">每连续失败 {{ task.notify_failure_threshold }} 次</span>再次通知)
+						</span>
+					</div>
+					<div v-if="task.body_url"><strong>请求体地址:</strong> {{ task.body_url }}</div>
+					<div v-if="task.sigv4_access_key"><strong>SigV4 签名:</strong> {{ task.sigv4_access_key }} @ {{ task.sigv4_service }} ({{ task.sigv4_region }})</div>
+					<div v-if="task.oauth_token_url"><strong>OAuth2:</strong> {{ task.oauth_client_id }} @ {{ task.oauth_token_url }}<span v-if="task.oauth_scopes" class="cron-desc"> ({{ task.oauth_scopes }})</span></div>
+					<div v-if="task.skip_holidays"><strong>节假日跳过:</strong> {{ task.holiday_calendar || '默认日历' }}</div>
+					<div v-if="task.guard_flag_url"><strong>功能开关:</strong> {{ task.guard_flag_url }}<span v-if="task.guard_flag_path" class="cron-desc"> ({{ task.guard_flag_path }})</span></div>
+					<div v-if="task.success_status_ranges"><strong>成功状态码:</strong> {{ task.success_status_ranges }}</div>
+					<div v-if="task.retention_days"><strong>日志保留:</strong> {{ task.retention_days }} 天</div>
+					<div v-if="task.response_header_timeout || task.idle_conn_timeout"><strong>连接超时:</strong><template v-if="task.response_header_timeout"> 响应头 {{ task.response_header_timeout }}秒</template><template v-if="task.idle_conn_timeout"> 空闲连接 {{ task.idle_conn_timeout }}秒</template></div>
+					<div v-if="task.follow_redirects === false"><strong>重定向:</strong> 不跟随</div>
+					<div v-else-if="task.max_redirects"><strong>重定向:</strong> 最多跟随 {{ task.max_redirects }} 次</div>
+					<div v-if="task.coalesce_seconds"><strong>合并窗口:</strong> {{ task.coalesce_seconds }}秒 (定时和手动执行)</div>
+					<div v-if="task.anomaly_k"><strong>响应时间异常检测:</strong> 均值 + {{ task.anomaly_k }} 倍标准差<template v-if="task.anomaly_notify">，异常时通知</template></div>
+					<div v-if="task.max_body_bytes"><strong>响应体上限:</strong> {{ task.max_body_bytes }} 字节</div>
+					<div v-if="task.body_content_types"><strong>保存响应体的类型:</strong> {{ task.body_content_types }}</div>
+					<div v-if="task.expect_status || task.expect_body_contains"><strong>响应断言:</strong><template v-if="task.expect_status"> 状态码 {{ task.expect_status }}</template><template v-if="task.expect_body_contains"> 响应体包含 <code>{{ task.expect_body_contains }}</code></template></div>
+					<div v-if="task.expect_header"><strong>期望响应头:</strong> {{ task.expect_header }} = {{ task.expect_header_value }}</div>
+					<div v-if="task.validators && task.validators.length"><strong>校验规则:</strong> <span v-for="(v, i) in task.validators" :key="i" class="tag" style="margin-right: 4px">{{ v.type }}<template v-if="v.target"> {{ v.target }}</template><template v-if="v.value"> = {{ v.value }}</template></span></div>
+					<div v-if="task.on_success_url"><strong>成功回调:</strong> {{ task.on_success_url }}</div>
+					<div v-if="task.on_failure_url"><strong>失败回调:</strong> {{ task.on_failure_url }}</div>
+					<div v-if="task.notify_webhook_url"><strong>失败通知 webhook:</strong> {{ task.notify_webhook_url }}</div>
+					<div v-if="!isZeroTime(task.expire_at)">
+						<strong>过期时间:</strong> {{ formatTime(task.expire_at) }}
+						<span v-if="new Date(task.expire_at) <= new Date()" class="tag">已过期</span>
+					</div>
+				</div>
+				<div class="latency-container">
+					<button @click="toggleLatency(task.id)" class="btn-link">{{ latency[task.id] ? '收起耗时分位' : '查看耗时分位 (24h)' }}</button>
+					<div v-if="latency[task.id]">
+						<div v-if="latency[task.id].count === 0" class="task-details">窗口内暂无耗时数据</div>
+						<div v-else class="latency-gauges">
+							<div v-for="p in ['p50', 'p90', 'p95', 'p99']" :key="p">
+								<div>{{ p.toUpperCase() }}: {{ latency[task.id][p] }}ms</div>
+								<meter min="0" :max="task.timeout * 1000" :low="task.timeout * 500" :high="task.timeout * 800" :optimum="0" :value="latency[task.id][p]"></meter>
+							</div>
+						</div>
+					</div>
+				</div>
+				<div v-if="!task.interval_seconds" class="latency-container">
+					<button @click="toggleSchedulePreview(task.id)" class="btn-link">{{ schedulePreviews[task.id] ? '收起执行预览' : '预览下次执行' }}</button>
+					<div v-if="schedulePreviews[task.id]" class="task-details">
+						<div v-if="schedulePreviews[task.id].length === 0">该任务之后不会再执行 (可能已到过期时间)</div>
+						<ol v-else class="schedule-preview">
+							<li v-for="run in schedulePreviews[task.id]" :key="run">{{ formatTime(run) }}</li>
+						</ol>
+					</div>
+				</div>
+				<div v-if="task.anomaly_k" class="latency-container">
+					<button @click="toggleBaseline(task.id)" class="btn-link">{{ baselines[task.id] ? '收起响应时间基线' : '响应时间基线' }}</button>
+					<div v-if="baselines[task.id]" class="task-details">
+						<div v-for="b in baselines[task.id]" :key="b.url">
+							<template v-if="b.url"><code>{{ b.url }}</code>: </template>
+							<template v-if="b.samples === 0">还没有成功执行的记录</template>
+							<template v-else>均值 {{ b.mean_ms }}ms，标准差 {{ b.stddev_ms }}ms，异常阈值 {{ b.threshold_ms }}ms (样本 {{ b.samples }} 个<template v-if="!b.ready">，样本足够后开始判定</template>)</template>
+							<span v-if="b.anomalous" class="tag tag-warn">异常</span>
+						</div>
+					</div>
+				</div>
+				<div class="latency-container">
+					<button @click="toggleShares(task.id)" class="btn-link">{{ shares[task.id] ? '收起分享链接' : '分享链接 (只读)' }}</button>
+					<div v-if="shares[task.id]" class="task-details">
+						<button @click="createShare(task.id)" class="btn-link">创建分享链接</button>
+						<div v-if="shares[task.id].length === 0">还没有分享链接</div>
+						<div v-for="share in shares[task.id]" :key="share.id">
+							#{{ share.id }} {{ share.note }} 创建于 {{ formatTime(share.created_at) }}，{{ isZeroTime(share.expire_at) ? '永不过期' : '有效期至 ' + formatTime(share.expire_at) }}
+							<button @click="revokeShare(task.id, share.id)" class="btn-link">撤销</button>
+						</div>
+					</div>
+				</div>
+				<div class="latency-container">
+					<button @click="toggleSimulate(task.id)" class="btn-link">{{ simulations[task.id] ? '收起模拟执行' : '模拟执行 (用示例响应检验成功判断和提取字段)' }}</button>
+					<div v-if="simulations[task.id]" class="simulate-panel">
+						<div class="form-grid">
+							<div class="form-group">
+								<label>响应状态码</label>
+								<input type="number" v-model.number="simulations[task.id].status">
+							</div>
+							<div class="form-group full-width">
+								<label>响应体</label>
+								<textarea v-model="simulations[task.id].body" placeholder='{"data": {"count": 1}}'></textarea>
+							</div>
+						</div>
+						<button @click="simulateTask(task.id)" class="btn-action">模拟</button>
+						<div v-if="simulations[task.id].result" class="log-entry">
+							<div><strong>结果:</strong> <span :class="['tag', simulations[task.id].result.success ? '' : 'tag-warn']">{{ simulations[task.id].result.success ? '成功' : '失败' }}</span>
+								<span v-if="simulations[task.id].result.would_retry" class="cron-desc">(实际执行时会重试<span v-if="simulations[task.id].result.retry_after">，等待 {{ simulations[task.id].result.retry_after }}</span>)</span></div>
+							<div><strong>执行状态:</strong> {{ simulations[task.id].result.log.status_text }}</div>
+							<div v-for="ex in task.extractions || []" :key="ex.name"><strong>{{ ex.name }}:</strong> {{ formatExtracted(simulations[task.id].result.log.extracted, ex.name) }}</div>
+						</div>
+					</div>
+				</div>
+				<div v-if="task.urls && task.urls.length > 0" class="logs-container">
+					<h4>各地址最新结果:</h4>
+					<table class="history-table">
+						<tbody>
+							<tr v-for="item in latestByURL(task)" :key="item.url">
+								<td><code>{{ item.url }}</code></td>
+								<td>{{ item.log ? item.log.status_text : '暂无执行记录' }}</td>
+								<td>{{ item.log && !item.log.skipped ? item.log.duration_ms + 'ms' : '-' }}</td>
+								<td>{{ item.log ? formatTime(item.log.time) : '' }}</td>
+							</tr>
+						</tbody>
+					</table>
+				</div>
+				<div class="logs-container">
+					<h4>最新执行结果: <span v-if="task.logs && task.logs.length > 0 && task.logs[0].rate_limited" class="tag tag-warn">被限流</span><span v-if="task.logs && task.logs.length > 0 && task.logs[0].skipped" class="tag tag-warn">已跳过</span><span v-if="task.logs && task.logs.length > 0 && task.logs[0].timeout_kind" class="tag tag-warn">{{ timeoutKindLabel(task.logs[0].timeout_kind) }}</span><span v-if="task.logs && task.logs.length > 0 && task.logs[0].anomaly" class="tag tag-warn">响应时间异常</span></h4>
+					<div v-if="task.logs && task.logs.length > 0" class="log-entry">
+						<div><strong>执行时间:</strong> {{ formatTime(task.logs[0].time) }}</div>
+						<div v-if="task.urls && task.urls.length > 0 && task.logs[0].url"><strong>请求地址:</strong> {{ task.logs[0].url }}</div>
+						<div v-if="task.logs[0].final_url"><strong>重定向到:</strong> {{ task.logs[0].final_url }}</div>
+						<div><strong>执行状态:</strong> <span :class="{ 'log-failed': !task.logs[0].success && !task.logs[0].skipped }">{{ task.logs[0].status_text }}</span></div>
+						<div v-if="!task.logs[0].skipped"><strong>耗时:</strong> {{ task.logs[0].duration_ms }}ms</div>
+						<div v-if="task.logs[0].trigger"><strong>触发方式:</strong> {{ triggerLabel(task.logs[0].trigger) }}<span v-if="task.logs[0].trigger === 'schedule'"> (延迟 {{ task.logs[0].lag_ms }}ms)</span></div>
+						<div v-if="task.logs[0].timeout && task.logs[0].timeout !== task.timeout"><strong>超时时间:</strong> {{ task.logs[0].timeout }}秒 (本次临时指定)</div>
+						<div v-if="task.logs[0].request_bytes"><strong>请求体大小:</strong> {{ task.logs[0].request_bytes }} 字节</div>
+						<div v-if="task.logs[0].request_id"><strong>请求ID:</strong> <code>{{ task.logs[0].request_id }}</code></div>
+						<div v-if="task.logs[0].correlation_id"><strong>关联ID:</strong> <code>{{ task.logs[0].correlation_id }}</code></div>
+						<div v-if="task.logs[0].request_headers || task.logs[0].response_headers">
+							<button @click="toggleHeaders(task.logs[0].id)" class="btn-link">{{ shownHeaders[task.logs[0].id] ? '收起请求头和响应头' : '查看请求头和响应头' }}</button>
+							<template v-if="shownHeaders[task.logs[0].id]">
+								<div v-if="task.logs[0].request_headers"><strong>请求头:</strong></div>
+								<div v-if="task.logs[0].request_headers" class="response-body">{{ formatHeaders(task.logs[0].request_headers) }}</div>
+								<div v-if="task.logs[0].response_headers"><strong>响应头:</strong></div>
+								<div v-if="task.logs[0].response_headers" class="response-body">{{ formatHeaders(task.logs[0].response_headers) }}</div>
+							</template>
+						</div>
+						<div><strong>响应体 (Response Body):</strong></div>
+						<div v-if="task.logs[0].sample_of && !(task.logs[0].id in loadedBodies)" class="response-body">
+							(与日志 #{{ task.logs[0].sample_of }} 的失败相同，响应体已省略) <button @click="loadBody(task.logs[0].id)" class="btn-link">查看响应体</button>
+						</div>
+						<div v-else-if="isBodyRef(task.logs[0].response_body) && !(task.logs[0].id in loadedBodies)" class="response-body">
+							<span v-if="task.logs[0].response_body.startsWith('bodyref:hash:')">(与上一次的响应体相同，未重复保存)</span>
+							<span v-else>(响应体较大，已保存在外部存储中)</span>
+							<button @click="loadBody(task.logs[0].id)" class="btn-link">加载响应体</button>
+						</div>
+						<div v-else class="response-body">{{ (loadedBodies[task.logs[0].id] ?? inlineBody(task.logs[0].response_body)) || '(空)' }}</div>
+					</div>
+					<div v-else>暂无执行记录</div>
+				</div>
+				<div v-if="task.logs && task.logs.length > 1" class="logs-container">
+					<button @click="history[task.id] ? delete history[task.id] : loadHistory(task.id, 1)" class="btn-link">{{ history[task.id] ? '收起执行历史' : '查看执行历史' }}</button>
+					<table v-if="history[task.id]" class="history-table">
+						<thead>
+							<tr>
+								<th>执行时间</th>
+								<th v-if="task.urls && task.urls.length > 0">地址</th>
+								<th>触发方式</th>
+								<th>执行状态</th>
+								<th>耗时</th>
+								<th v-for="ex in task.extractions || []" :key="ex.name">{{ ex.name }}</th>
+							</tr>
+						</thead>
+						<tbody>
+							<tr v-for="log in history[task.id].logs" :key="log.id" :class="{ 'log-failed': !log.success && !log.skipped }">
+								<td>{{ formatTime(log.time) }}</td>
+								<td v-if="task.urls && task.urls.length > 0">{{ log.url }}</td>
+								<td>{{ triggerLabel(log.trigger) }} <span v-if="log.coalesced_with" class="tag" :title="'合并到关联ID为 ' + log.coalesced_with + ' 的执行'">已合并</span></td>
+								<td><span v-if="log.anomaly" class="tag tag-warn">响应时间异常</span> {{ log.status_text }}<span v-if="log.final_url" class="cron-desc"> (重定向到 {{ log.final_url }})</span></td>
+								<td>{{ log.skipped ? '-' : log.duration_ms + 'ms' }}</td>
+								<td v-for="ex in task.extractions || []" :key="ex.name">{{ formatExtracted(log.extracted, ex.name) }}</td>
+							</tr>
+						</tbody>
+					</table>
+					<div v-if="history[task.id] && history[task.id].total > history[task.id].size" class="cron-desc">
+						<button @click="loadHistory(task.id, history[task.id].page - 1)" :disabled="history[task.id].page <= 1" class="btn-link">上一页</button>
+						第 {{ history[task.id].page }} / {{ Math.ceil(history[task.id].total / history[task.id].size) }} 页，共 {{ history[task.id].total }} 条
+						<button @click="loadHistory(task.id, history[task.id].page + 1)" :disabled="history[task.id].page * history[task.id].size >= history[task.id].total" class="btn-link">下一页</button>
+					</div>
+				</div>
+			</div>
+		</div>
+	</div>
+
+	<div v-if="authEnabled && me && me.username" class="form-container">
+		<h2>两步验证</h2>
+		<div v-if="me.totp_enabled">
+			已开启，登录时需要输入验证器应用中的验证码。 <button @click="disableTOTP" class="btn-link">关闭两步验证</button>
+		</div>
+		<div v-else-if="totpEnroll">
+			<p>用验证器应用 (Google Authenticator、1Password 等) 扫描二维码，或手动输入密钥，然后输入显示的验证码完成绑定。</p>
+			<img :src="totpEnroll.qr" alt="两步验证二维码" width="200" height="200">
+			<div class="cron-desc">密钥: {{ totpEnroll.secret }}</div>
+			<div class="form-group">
+				<label>验证码</label>
+				<input v-model.trim="totpEnroll.code" inputmode="numeric" autocomplete="one-time-code" @keyup.enter="activateTOTP">
+			</div>
+			<button @click="activateTOTP" class="btn-add">确认开启</button> <button @click="totpEnroll = null" class="btn-link">取消</button>
+		</div>
+		<div v-else>
+			未开启。开启后登录除密码外还需要验证器应用中的验证码。 <button @click="enrollTOTP" class="btn-link">开启两步验证</button>
+		</div>
+	</div>
+
+	<div v-if="authEnabled && me && me.is_admin" class="form-container">
+		<h2>用户管理</h2>
+		<div v-for="u in users" :key="u.id" class="channel">
+			<strong>{{ u.username }}</strong> <span v-if="u.is_admin" class="tag">管理员</span> <span v-if="u.totp_enabled" class="tag">两步验证</span>
+			<span class="task-actions">
+				<button v-if="u.totp_enabled" @click="resetTOTP(u)" class="btn-action">重置两步验证</button>
+				<button @click="deleteUser(u)" class="btn-delete">删除</button>
+			</span>
+		</div>
 		<div class="form-grid">
 			<div class="form-group">
-				<label>任务名称*</label>
-				<input v-model.trim="newTask.name" placeholder="例如：每日数据同步">
+				<label>用户名*</label>
+				<input v-model.trim="newUser.username" autocomplete="off">
 			</div>
 			<div class="form-group">
-				<label>Cron 表达式*</label>
-				<input v-model.trim="newTask.cron" placeholder="例如: 0 30 1 * * * (每天1:30执行)">
+				<label>密码*</label>
+				<input v-model="newUser.password" type="password" autocomplete="new-password">
 			</div>
 			<div class="form-group full-width">
-				<label>请求地址 (URL)*</label>
-				<input v-model.trim="newTask.url" placeholder="https://api.example.com/data">
+				<label><input type="checkbox" v-model="newUser.is_admin" class="checkbox"> 管理员 (可以查看和管理所有用户的任务)</label>
 			</div>
+		</div>
+		<button @click="addUser" class="btn-add">添加用户</button>
+	</div>
+
+	<div v-if="me && me.is_admin" class="form-container">
+		<h2>数据库备份 <button @click="backupNow" class="btn-link">立即备份</button> <button @click="verifyRoundTrip" class="btn-link">校验导出/导入</button></h2>
+		<div v-if="backups.length === 0" class="task-details">暂无备份<span v-if="backupConfig.interval === '0s'">，可以通过 PIPIGO_BACKUP_INTERVAL 开启自动备份</span></div>
+		<div v-for="b in backups" :key="b.name" class="channel">
+			<strong>{{ b.name }}</strong> <span class="cron-desc">{{ formatTime(b.created_at) }}，{{ b.size }} 字节</span>
+			<span class="task-actions">
+				<button @click="restoreBackup(b.name)" class="btn-delete">恢复</button>
+			</span>
+		</div>
+	</div>
+
+	<div class="form-container">
+		<h2>通知渠道</h2>
+		<div v-for="ch in channels" :key="ch.id" class="channel">
+			<span class="tag">{{ ch.type }}</span> <strong>{{ ch.name }}</strong>
+			<span class="cron-desc">(不低于 {{ severityNames[ch.min_severity] }} 级别<template v-if="ch.template">，自定义消息模板</template>)</span>
+			<span v-if="me && me.is_admin" class="task-actions">
+				<button @click="testChannel(ch.id)" class="btn-action">发送测试</button>
+				<button @click="deleteChannel(ch.id)" class="btn-delete">删除</button>
+			</span>
+		</div>
+		<div v-if="channels.length === 0" class="task-details">暂无通知渠道</div>
+		<div v-if="me && me.is_admin" class="form-grid">
 			<div class="form-group">
-				<label>请求方法</label>
-				<select v-model="newTask.method">
-					<option>POST</option>
-					<option>GET</option>
+				<label>渠道名称*</label>
+				<input v-model.trim="newChannel.name" placeholder="例如：ops-slack">
+			</div>
+			<div class="form-group">
+				<label>渠道类型</label>
+				<select v-model="newChannel.type">
+					<option value="webhook">Webhook</option>
+					<option value="slack">Slack</option>
+					<option value="email">邮件 (SMTP)</option>
 				</select>
 			</div>
-            <div class="form-group">
-				<label>超时时间 (秒)</label>
-				<input type="number" v-model.number="newTask.timeout" placeholder="默认10秒">
+			<div class="form-group">
+				<label>最低事件级别</label>
+				<select v-model="newChannel.min_severity">
+					<option v-for="(label, value) in severityNames" :key="value" :value="value">{{ label }}</option>
+				</select>
 			</div>
 			<div class="form-group full-width">
-				<label>请求头 (Headers) - JSON格式</label>
-				<textarea v-model="newTask.headers" placeholder='{ "Authorization": "Bearer YOUR_TOKEN" }'></textarea>
+				<label>渠道配置 - JSON格式</label>
+				<textarea v-model="newChannel.config" :placeholder="channelConfigExamples[newChannel.type]"></textarea>
 			</div>
 			<div class="form-group full-width">
-				<label>请求体 (Body) - 仅POST</label>
-				<textarea v-model="newTask.body" placeholder='{ "key": "value", "id": 123 }'></textarea>
-			</div>
-		</div>
-		<button @click="addTask" class="btn-add">添加任务</button>
-	</div>
-
-	<div class="task-list">
-		<h2>任务列表</h2>
-		<div v-for="task in tasks" :key="task.id" class="task">
-			<div class="task-header">
-				<h3>{{ task.name }}</h3>
-				<div class="task-actions">
-					<button @click="runTask(task.id)" class="btn-action">立即执行</button>
-					<button @click="deleteTask(task.id)" class="btn-delete">删除</button>
-				</div>
-			</div>
-			<div class="task-details">
-				<div><span class="tag">{{ task.method }}</span> {{ task.url }}</div>
-				<div><strong>Cron:</strong> {{ task.cron }}</div>
-				<div><strong>下次执行时间:</strong> {{ formatTime(task.next_run) }}</div>
-			</div>
-			<div class="logs-container">
-				<h4>最新执行结果:</h4>
-				<div v-if="task.logs && task.logs.length > 0" class="log-entry">
-					<div><strong>执行时间:</strong> {{ formatTime(task.logs[0].time) }}</div>
-					<div><strong>执行状态:</strong> {{ task.logs[0].status_text }}</div>
-					<div><strong>响应体 (Response Body):</strong></div>
-					<div class="response-body">{{ task.logs[0].response_body || '(空)' }}</div>
-				</div>
-				<div v-else>暂无执行记录</div>
+				<label>消息模板 (可选，Go 模板语法，可使用 .TaskName .Title .Message .Status .StatusText .StatusCode .DurationMs .Response .Extracted 等字段，为空时使用默认格式)</label>
+				<textarea v-model="newChannel.template" :placeholder="channelTemplateExamples[newChannel.type]"></textarea>
 			</div>
 		</div>
+		<button v-if="me && me.is_admin" @click="addChannel" class="btn-add">添加渠道</button>
 	</div>
 </div>
 
@@ -381,36 +3045,589 @@ createApp({
 		return {
 			tasks: [],
 			newTask: this.getInitialNewTask(),
+			formRows: [{ key: '', value: '' }],
+			theme: document.documentElement.dataset.theme,
+			authEnabled: false,
+			me: null,
+			showAll: false,
+			search: '',
+			searchTimer: null,
+			users: [],
+			newUser: { username: '', password: '', is_admin: false },
+			needLogin: false,
+			username: '',
+			loginForm: { username: '', password: '', code: '' },
+			loginNeedsCode: false,
+			totpEnroll: null,
+			breaker: null,
+			stats: null,
+			smokeTesting: false,
+			selectedIds: [],
+			projects: [],
+			collapsedProjects: {},
+			newProjectName: '',
+			history: {},
+			simulations: {},
+			palette: { open: false, query: '', index: 0 },
+			backups: [],
+			backupConfig: {},
+			channels: [],
+			holidayCalendars: [],
+			loadedBodies: {},
+			newChannel: this.getInitialNewChannel(),
+			severityNames: { info: '信息', warning: '警告', critical: '严重' },
+			channelConfigExamples: {
+				webhook: '{ "url": "https://example.com/hook", "headers": { "Authorization": "Bearer TOKEN" } }',
+				slack: '{ "webhook_url": "https://hooks.slack.com/services/XXX" }',
+				email: '{ "host": "smtp.example.com", "port": 587, "username": "bot@example.com", "password": "secret", "from": "bot@example.com", "to": ["ops@example.com"] }'
+			},
+			channelTemplateExamples: {
+				webhook: '{"task": {{json .TaskName}}, "status": {{json .Status}}, "detail": {{json .Message}}}',
+				slack: '{"blocks": [{"type": "section", "text": {"type": "mrkdwn", "text": {{json (printf "*%s*: %s (%dms)" .Title .TaskName .DurationMs)}}}}]}',
+				email: '{{.Title}}: {{.TaskName}}\n{{.Message}}\n\n响应: {{truncate 200 .Response}}'
+			},
+			cronDescription: '',
+			scheduleMode: 'cron',
+			editingTaskId: null,
+			runNow: false,
+			describeTimer: null,
+			latency: {},
+			schedulePreviews: {},
+			shares: {},
+			baselines: {},
+			shownHeaders: {},
+			running: {},
+			eventStream: null,
 			intervalId: null
 		}
 	},
+	computed: {
+		// 只有 POST、PUT 和 PATCH 请求发送请求体
+		newTaskHasBody() {
+			return ['POST', 'PUT', 'PATCH'].includes(this.newTask.method)
+		},
+		// 命令面板的候选项：固定命令加上按模糊匹配得分排序的任务
+		paletteItems() {
+			const query = this.palette.query.trim()
+			const commands = [{
+				key: 'cmd-add', label: '➕ 添加新任务', hint: '跳转到添加表单', text: '添加新任务 add new task',
+				run: () => {
+					document.getElementById('add-task-form').scrollIntoView({ behavior: 'smooth' })
+					this.$nextTick(() => this.$refs.newTaskName.focus())
+				},
+			}]
+			const tasks = this.tasks.map(t => ({
+				key: 'task-' + t.id, label: '▶ ' + t.name, hint: '#' + t.id + ' ' + t.url, text: t.name + ' ' + t.url + ' #' + t.id,
+				run: locate => locate ? this.locateTask(t.id) : this.runTask(t.id),
+			}))
+			const items = [...commands, ...tasks]
+			if (!query) return items.slice(0, 50)
+			return items
+				.map(item => ({ item, score: this.fuzzyScore(item.text, query) }))
+				.filter(r => r.score >= 0)
+				.sort((a, b) => b.score - a.score)
+				.slice(0, 50)
+				.map(r => r.item)
+		},
+		// 按项目对任务分组，未分组的任务排在最后
+		taskGroups() {
+			const groups = this.projects.map(p => ({ key: p.id, project: p, name: p.name, tasks: [] }))
+			const ungrouped = { key: 'none', project: null, name: '未分组', tasks: [] }
+			for (const task of this.tasks) {
+				const group = groups.find(g => g.key === task.project_id)
+				;(group || ungrouped).tasks.push(task)
+			}
+			return groups.concat(ungrouped.tasks.length > 0 ? [ungrouped] : [])
+		}
+	},
 	mounted() {
-		this.loadTasks()
+		// 请求时带上登录令牌，令牌失效时显示登录框
+		axios.interceptors.request.use(config => {
+			const token = localStorage.getItem('pipigo-token')
+			if (token) config.headers.Authorization = 'Bearer ' + token
+			return config
+		})
+		axios.interceptors.response.use(res => res, err => {
+			if (err.response?.status === 401 && this.authEnabled && !err.config.url.endsWith('/api/login')) {
+				this.logout()
+			}
+			return Promise.reject(err)
+		})
+
+		axios.get('/api/auth')
+			.then(res => {
+				this.authEnabled = res.data.enabled
+				if (this.authEnabled) {
+					if (!localStorage.getItem('pipigo-token')) {
+						this.needLogin = true
+						return
+					}
+					this.refreshToken()
+				}
+				this.loadAll()
+			})
+			.catch(err => console.error("加载认证配置失败:", err))
+		// Ctrl+K (macOS 上为 Cmd+K) 打开命令面板
+		this.paletteShortcut = e => {
+			if ((e.ctrlKey || e.metaKey) && e.key.toLowerCase() === 'k') {
+				e.preventDefault()
+				this.palette.open ? this.closePalette() : this.openPalette()
+			}
+		}
+		window.addEventListener('keydown', this.paletteShortcut)
 		// 每10秒自动刷新一次列表
-		this.intervalId = setInterval(this.loadTasks, 10000)
+		this.intervalId = setInterval(() => { if (!this.needLogin) this.loadTasks() }, 10000)
 	},
 	beforeUnmount() {
+		window.removeEventListener('keydown', this.paletteShortcut)
 		clearInterval(this.intervalId)
+		clearTimeout(this.refreshTimer)
+		this.stopEvents()
 	},
 	methods: {
+		openPalette() {
+			if (this.needLogin) return
+			this.palette = { open: true, query: '', index: 0 }
+			this.paletteReturnFocus = document.activeElement
+			this.$nextTick(() => this.$refs.paletteInput.focus())
+		},
+		closePalette() {
+			this.palette.open = false
+			// 关闭后把焦点还给打开前的元素
+			if (this.paletteReturnFocus) this.paletteReturnFocus.focus()
+		},
+		paletteKeydown(e) {
+			const count = this.paletteItems.length
+			if (e.key === 'Escape') {
+				this.closePalette()
+			} else if (e.key === 'ArrowDown' && count > 0) {
+				e.preventDefault()
+				this.palette.index = (this.palette.index + 1) % count
+			} else if (e.key === 'ArrowUp' && count > 0) {
+				e.preventDefault()
+				this.palette.index = (this.palette.index - 1 + count) % count
+			} else if (e.key === 'Enter' && count > 0) {
+				e.preventDefault()
+				this.runPaletteItem(this.paletteItems[this.palette.index], e.shiftKey)
+			} else {
+				return
+			}
+			this.$nextTick(() => document.getElementById('palette-item-' + this.palette.index)?.scrollIntoView({ block: 'nearest' }))
+		},
+		runPaletteItem(item, locate) {
+			this.closePalette()
+			item.run(locate)
+		},
+		fuzzyScore(text, query) {
+			// 按顺序匹配查询中的每个字符，连续匹配和靠前的匹配得分更高，不匹配时返回 -1
+			text = text.toLowerCase()
+			let score = 0, pos = 0, prev = -2
+			for (const ch of query.toLowerCase()) {
+				if (ch === ' ') continue
+				const found = text.indexOf(ch, pos)
+				if (found < 0) return -1
+				score += found === prev + 1 ? 3 : 1
+				score -= found * 0.01
+				prev = found
+				pos = found + 1
+			}
+			return score
+		},
+		locateTask(id) {
+			const task = this.tasks.find(t => t.id === id)
+			if (task) {
+				const grouped = this.projects.some(p => p.id === task.project_id)
+				this.collapsedProjects[grouped ? task.project_id : 'none'] = false
+			}
+			this.$nextTick(() => document.getElementById('task-' + id)?.scrollIntoView({ behavior: 'smooth', block: 'start' }))
+		},
+		loadAll() {
+			this.loadTasks()
+			this.loadChannels()
+			this.loadHolidays()
+			this.loadProjects()
+			this.loadMe()
+			this.subscribeEvents()
+		},
+		subscribeEvents() {
+			// 接收长时间执行的任务的心跳。EventSource 无法带上登录令牌，因此用 fetch 读取事件流
+			this.stopEvents()
+			const controller = new AbortController()
+			this.eventStream = controller
+			const headers = {}
+			const token = localStorage.getItem('pipigo-token')
+			if (token) headers.Authorization = 'Bearer ' + token
+			fetch('/api/events', { headers, signal: controller.signal })
+				.then(async res => {
+					if (!res.ok) throw new Error('HTTP ' + res.status)
+					const reader = res.body.getReader()
+					const decoder = new TextDecoder()
+					let buffer = ''
+					for (;;) {
+						const { done, value } = await reader.read()
+						if (done) break
+						buffer += decoder.decode(value, { stream: true })
+						let end
+						while ((end = buffer.indexOf('\n\n')) >= 0) {
+							this.handleEvent(buffer.slice(0, end))
+							buffer = buffer.slice(end + 2)
+						}
+					}
+					throw new Error('连接已关闭')
+				})
+				.catch(err => {
+					if (controller.signal.aborted) return
+					console.error("事件流中断，稍后重连:", err)
+					this.running = {}
+					setTimeout(() => { if (this.eventStream === controller && !this.needLogin) this.subscribeEvents() }, 5000)
+				})
+		},
+		stopEvents() {
+			if (this.eventStream) this.eventStream.abort()
+			this.eventStream = null
+		},
+		handleEvent(block) {
+			let type = 'message', data = ''
+			for (const line of block.split('\n')) {
+				if (line.startsWith('event:')) type = line.slice(6).trim()
+				else if (line.startsWith('data:')) data += line.slice(5).trim()
+			}
+			if (type === 'heartbeat') {
+				const ev = JSON.parse(data)
+				this.running[ev.task_id] = ev.elapsed_ms
+			} else if (type === 'completed') {
+				const ev = JSON.parse(data)
+				delete this.running[ev.task_id]
+				this.loadTasks()
+			}
+		},
+		loadMe() {
+			axios.get('/api/me')
+				.then(res => {
+					this.me = res.data
+					if (this.authEnabled && this.me.is_admin) this.loadUsers()
+					if (this.me.is_admin) this.loadBackups()
+				})
+				.catch(err => console.error("加载当前用户失败:", err))
+		},
+		loadUsers() {
+			axios.get('/api/users')
+				.then(res => { this.users = res.data || []; })
+				.catch(err => console.error("加载用户失败:", err))
+		},
+		addUser() {
+			if (!this.newUser.username || !this.newUser.password) {
+				return alert("请填写用户名和密码")
+			}
+			axios.post('/api/users', this.newUser)
+				.then(() => {
+					this.newUser = { username: '', password: '', is_admin: false }
+					this.loadUsers()
+				})
+				.catch(err => alert("添加用户失败: " + (err.response?.data?.error || err.message)))
+		},
+		enrollTOTP() {
+			axios.post('/api/me/totp/enroll')
+				.then(res => { this.totpEnroll = { ...res.data, code: '' } })
+				.catch(err => alert("生成两步验证密钥失败: " + (err.response?.data?.error || err.message)))
+		},
+		activateTOTP() {
+			axios.post('/api/me/totp/activate', { code: this.totpEnroll.code })
+				.then(res => {
+					this.totpEnroll = null
+					alert(res.data.message)
+					this.loadMe()
+				})
+				.catch(err => alert("开启两步验证失败: " + (err.response?.data?.error || err.message)))
+		},
+		disableTOTP() {
+			const password = prompt("请输入密码:")
+			if (!password) {
+				return
+			}
+			const code = prompt("请输入两步验证码:")
+			if (!code) {
+				return
+			}
+			axios.post('/api/me/totp/disable', { password: password, code: code })
+				.then(res => {
+					alert(res.data.message)
+					this.loadMe()
+				})
+				.catch(err => alert("关闭两步验证失败: " + (err.response?.data?.error || err.message)))
+		},
+		resetTOTP(user) {
+			if (confirm("确定要重置用户「" + user.username + "」的两步验证吗？重置后该用户只需密码即可登录。")) {
+				axios.delete('/api/users/' + user.id + '/totp')
+					.then(() => { this.loadUsers() })
+					.catch(err => alert("重置失败: " + (err.response?.data?.error || err.message)))
+			}
+		},
+		deleteUser(user) {
+			if (confirm("确定要删除用户「" + user.username + "」吗？")) {
+				axios.delete('/api/users/' + user.id)
+					.then(() => { this.loadUsers() })
+					.catch(err => alert("删除失败: " + (err.response?.data?.error || err.message)))
+			}
+		},
+		changeOwner(task, ownerId) {
+			axios.put('/api/tasks/' + task.id + '/owner', { owner_id: ownerId })
+				.then(() => { this.loadTasks() })
+				.catch(err => alert("转移任务失败: " + (err.response?.data?.error || err.message)))
+		},
+		login() {
+			axios.post('/api/login', this.loginForm)
+				.then(res => {
+					this.saveToken(res.data)
+					this.loginForm.password = ''
+					this.loginForm.code = ''
+					this.loginNeedsCode = false
+					this.needLogin = false
+					this.loadAll()
+				})
+				.catch(err => {
+					// 开启了两步验证的用户第一次只提交密码时，显示验证码输入框，不提示错误
+					if (err.response?.data?.totp_required && !this.loginNeedsCode) {
+						this.loginNeedsCode = true
+						return
+					}
+					this.loginForm.code = ''
+					alert("登录失败: " + (err.response?.data?.error || err.message))
+				})
+		},
+		logout() {
+			localStorage.removeItem('pipigo-token')
+			clearTimeout(this.refreshTimer)
+			this.stopEvents()
+			this.username = ''
+			this.needLogin = true
+		},
+		refreshToken() {
+			axios.post('/api/token/refresh')
+				.then(res => this.saveToken(res.data))
+				.catch(err => console.error("刷新令牌失败:", err))
+		},
+		saveToken(data) {
+			localStorage.setItem('pipigo-token', data.token)
+			this.username = data.username
+			// 在令牌有效期过半时自动续期
+			clearTimeout(this.refreshTimer)
+			this.refreshTimer = setTimeout(this.refreshToken, data.ttl_seconds * 500)
+		},
+		exportScript() {
+			axios.get('/api/tasks/export.sh', { responseType: 'blob' })
+				.then(res => {
+					const link = document.createElement('a')
+					link.href = URL.createObjectURL(res.data)
+					link.download = 'pipigo-tasks.sh'
+					link.click()
+					URL.revokeObjectURL(link.href)
+				})
+				.catch(err => alert("导出失败: " + err.message))
+		},
+		backupNow() {
+			axios.post('/api/admin/backup')
+				.then(res => {
+					alert("已备份数据库: " + res.data.name + " (" + res.data.size + " 字节)")
+					this.loadBackups()
+				})
+				.catch(err => alert("备份失败: " + (err.response?.data?.error || err.message)))
+		},
+		verifyRoundTrip() {
+			axios.post('/api/admin/verify-roundtrip')
+				.then(res => {
+					const lines = res.data.issues.map(i => "#" + i.task_id + " " + i.name + ": " +
+						(i.error || i.field + " 原为 " + JSON.stringify(i.original) + "，导入后为 " + JSON.stringify(i.imported)))
+					if (res.data.ok) {
+						alert("全部 " + res.data.total + " 个任务导出后再导入均与原任务一致" + (lines.length ? "，以下差异是预期的:\n" + lines.join("\n") : ""))
+						return
+					}
+					alert("发现 " + res.data.issues.filter(i => !i.expected).length + " 处差异:\n" + lines.join("\n"))
+				})
+				.catch(err => alert("校验失败: " + (err.response?.data?.error || err.message)))
+		},
+		loadBackups() {
+			axios.get('/api/admin/backups')
+				.then(res => {
+					this.backups = [...res.data.backups].reverse()
+					this.backupConfig = res.data
+				})
+				.catch(err => console.error("加载备份失败:", err))
+		},
+		restoreBackup(name) {
+			const input = prompt("恢复会用备份「" + name + "」覆盖当前的所有任务和日志 (恢复前会自动备份当前数据)。\n请输入 RESTORE 确认:")
+			if (input !== 'RESTORE') return
+			const form = new URLSearchParams({ name: name, confirm: input })
+			axios.post('/api/admin/restore', form)
+				.then(res => {
+					alert("已恢复，共加载 " + res.data.tasks + " 个任务。恢复前的数据已备份为 " + res.data.safety_backup)
+					this.loadAll()
+				})
+				.catch(err => alert("恢复失败: " + (err.response?.data?.error || err.message)))
+		},
+		exportPostman() {
+			axios.get('/api/tasks/export/postman', { responseType: 'blob' })
+				.then(res => {
+					const link = document.createElement('a')
+					link.href = URL.createObjectURL(res.data)
+					link.download = 'pipigo-tasks.postman_collection.json'
+					link.click()
+					URL.revokeObjectURL(link.href)
+				})
+				.catch(err => alert("导出失败: " + err.message))
+		},
+		importPostman(event) {
+			const file = event.target.files[0]
+			event.target.value = ''
+			if (!file) return
+			const cron = prompt("导入的任务使用的 Cron 表达式 (从 pipiGo 导出的请求会沿用原来的表达式):", "0 */5 * * * *")
+			if (!cron) return
+			file.text()
+				.then(text => axios.post('/api/tasks/import/postman', { collection: JSON.parse(text), cron: cron }))
+				.then(res => {
+					const { imported, failed } = res.data
+					let msg = "已导入 " + imported.length + " 个任务"
+					const vars = [...new Set(imported.flatMap(t => t.variables || []))]
+					if (vars.length > 0) {
+						msg += "\n以下变量占位符需要手动替换: " + vars.join(", ")
+					}
+					if (failed.length > 0) {
+						msg += "\n\n" + failed.length + " 个请求无法转换:\n" + failed.map(f => f.path + ": " + f.reason).join("\n")
+					}
+					alert(msg)
+					this.loadTasks()
+				})
+				.catch(err => alert("导入失败: " + (err.response?.data?.error || err.message)))
+		},
 		getInitialNewTask() {
 			return {
 				name: '',
+				description: '',
+				notes: '',
 				cron: '',
+				cron_template: '',
+				timezone: '',
+				interval_seconds: null,
 				url: '',
+				urls_text: '',
+				body_url: '',
+				oauth_token_url: '',
+				oauth_client_id: '',
+				oauth_client_secret: '',
+				oauth_scopes: '',
+				sigv4_access_key: '',
+				sigv4_secret_key: '',
+				sigv4_region: '',
+				sigv4_service: '',
+				guard_flag_url: '',
+				skip_holidays: false,
+				holiday_calendar: '',
+				guard_flag_path: '',
+				success_status_ranges: '',
+				max_body_bytes: null,
+				response_header_timeout: null,
+				idle_conn_timeout: null,
+				follow_redirects: true,
+				max_redirects: null,
+				coalesce_seconds: null,
+				anomaly_k: null,
+				anomaly_notify: false,
+				body_content_types: '',
+				retention_days: null,
+				expect_header: '',
+				expect_header_value: '',
+				expect_status: null,
+				expect_body_contains: '',
 				method: 'POST',
 				headers: '{}',
 				body: '{}',
-				timeout: 10
+				body_type: 'json',
+				timeout: 10,
+				expire_at: '',
+				on_success_url: '',
+				on_failure_url: '',
+				notify_webhook_url: '',
+				max_retries: 0,
+				idempotent_retry: false,
+				retry_delay_ms: 0,
+				retry_budget: 0,
+				channels: '',
+				notify_throttle_minutes: 0,
+				notify_failure_threshold: 0,
+				sample_failures: false,
+				insecure_skip_verify: false,
+				templated: false,
+				pre_request_script: '',
+				extractions: [],
+				validators: [],
+				project_id: null
+			}
+		},
+		getInitialNewChannel() {
+			return { name: '', type: 'webhook', min_severity: 'info', config: '', template: '' }
+		},
+		loadHolidays() {
+			axios.get('/api/holidays')
+				.then(res => { this.holidayCalendars = res.data || []; })
+				.catch(err => console.error("加载节假日日历失败:", err))
+		},
+		loadChannels() {
+			axios.get('/api/channels')
+				.then(res => { this.channels = res.data || []; })
+				.catch(err => console.error("加载通知渠道失败:", err))
+		},
+		addChannel() {
+			if (!this.newChannel.name) {
+				return alert("请填写渠道名称")
+			}
+			try {
+				JSON.parse(this.newChannel.config)
+			} catch (e) {
+				return alert("渠道配置不是有效的JSON格式！")
+			}
+			axios.post('/api/channels', this.newChannel)
+				.then(() => {
+					this.newChannel = this.getInitialNewChannel()
+					this.loadChannels()
+				})
+				.catch(err => alert("添加通知渠道失败: " + (err.response?.data?.error || err.message)))
+		},
+		deleteChannel(id) {
+			if (confirm("确定要删除这个通知渠道吗？")) {
+				axios.delete('/api/channels/' + id)
+					.then(() => { this.loadChannels() })
+					.catch(err => alert("删除失败: " + (err.response?.data?.error || err.message)))
 			}
 		},
+		testChannel(id) {
+			axios.post('/api/channels/' + id + '/test')
+				.then(res => alert(res.data.message))
+				.catch(err => alert(err.response?.data?.error || err.message))
+		},
 		loadTasks() {
-			axios.get('/api/tasks')
+			axios.get('/api/tasks', { params: { all: this.showAll || undefined, search: this.search.trim() || undefined } })
 				.then(res => { this.tasks = res.data || []; })
 				.catch(err => console.error("加载任务失败:", err))
+			axios.get('/api/breaker')
+				.then(res => { this.breaker = res.data })
+				.catch(err => console.error("加载熔断状态失败:", err))
+			axios.get('/api/stats', { params: { since: '24h' } })
+				.then(res => { this.stats = res.data })
+				.catch(err => console.error("加载执行统计失败:", err))
+		},
+		searchTasks() {
+			// 输入停顿后再请求，避免每输入一个字符都重新加载任务列表
+			clearTimeout(this.searchTimer)
+			this.searchTimer = setTimeout(() => this.loadTasks(), 300)
+		},
+		resetBreaker() {
+			axios.post('/api/breaker/reset')
+				.then(res => { this.breaker = res.data })
+				.catch(err => alert("操作失败: " + err.message))
 		},
 		addTask() {
-			if (!this.newTask.name || !this.newTask.cron || !this.newTask.url) {
+			const hasSchedule = this.scheduleMode === 'interval' ? this.newTask.interval_seconds > 0 : (this.newTask.cron || this.newTask.cron_template)
+			if (!this.newTask.name || !hasSchedule || !this.newTask.url) {
 				return alert("请填写所有必填项 (*)")
 			}
 			// 校验 Headers 和 Body 是否为合法JSON
@@ -419,7 +3636,7 @@ createApp({
 			} catch (e) {
 				return alert("请求头 (Headers) 不是有效的JSON格式！")
 			}
-			if (this.newTask.method === 'POST') {
+			if (this.newTaskHasBody && this.newTask.body_type === 'json' && !this.newTask.body_url) {
 				try {
 					JSON.parse(this.newTask.body)
 				} catch (e) {
@@ -427,22 +3644,271 @@ createApp({
 				}
 			}
 
-			axios.post('/api/tasks', this.newTask)
-				.then(() => {
-					this.newTask = this.getInitialNewTask()
+			const payload = { ...this.newTask, expire_at: this.newTask.expire_at ? new Date(this.newTask.expire_at).toISOString() : null }
+			payload.extractions = this.newTask.extractions.filter(ex => ex.name || ex.path)
+			payload.validators = this.newTask.validators.map(v => this.validatorHasTarget(v) ? v : { ...v, target: '' })
+			payload.urls = this.newTask.urls_text.split('\n').map(u => u.trim()).filter(u => u)
+			delete payload.urls_text
+			payload.max_body_bytes = this.newTask.max_body_bytes || 0
+			payload.expect_status = this.newTask.expect_status || 0
+			payload.response_header_timeout = this.newTask.response_header_timeout || 0
+			payload.idle_conn_timeout = this.newTask.idle_conn_timeout || 0
+			payload.max_redirects = this.newTask.follow_redirects ? (this.newTask.max_redirects || 0) : 0
+			payload.coalesce_seconds = this.newTask.coalesce_seconds || 0
+			payload.anomaly_k = this.newTask.anomaly_k || 0
+			payload.retention_days = this.newTask.retention_days || 0
+			if (this.scheduleMode === 'interval') {
+				payload.cron = ''
+				payload.cron_template = ''
+				payload.timezone = ''
+			} else {
+				payload.interval_seconds = 0
+			}
+			if (this.newTaskHasBody && this.newTask.body_type === 'form') {
+				// 表单模式下将键值对序列化为 application/x-www-form-urlencoded
+				const params = new URLSearchParams()
+				this.formRows.filter(row => row.key).forEach(row => params.append(row.key, row.value))
+				payload.body = params.toString()
+			}
+			const request = this.editingTaskId ? axios.put('/api/tasks/' + this.editingTaskId, payload) : axios.post('/api/tasks', payload, { params: this.runNow ? { run_now: true } : {} })
+			request
+				.then(res => {
+					if (res.data.log) {
+						alert("任务已创建，首次执行" + (res.data.log.skipped ? "被跳过" : "结果") + ": " + res.data.log.status_text)
+					}
+					this.resetTaskForm()
 					this.loadTasks()
+					this.loadProjects()
 				})
 				.catch(err => {
-					alert("添加任务失败: " + (err.response?.data?.error || err.message))
+					alert((this.editingTaskId ? "保存任务失败: " : "添加任务失败: ") + (err.response?.data?.error || err.message))
+				})
+		},
+		resetTaskForm() {
+			this.newTask = this.getInitialNewTask()
+			this.formRows = [{ key: '', value: '' }]
+			this.cronDescription = ''
+			this.scheduleMode = 'cron'
+			this.editingTaskId = null
+		},
+		editTask(task) {
+			// 用任务的当前设置填充表单，保存时提交修改
+			const form = this.getInitialNewTask()
+			Object.keys(form).forEach(key => {
+				if (task[key] !== undefined && task[key] !== null) form[key] = task[key]
+			})
+			form.urls_text = (task.urls || []).join('\n')
+			form.extractions = (task.extractions || []).map(ex => ({ ...ex }))
+			form.validators = (task.validators || []).map(v => ({ target: '', value: '', ...v }))
+			form.interval_seconds = task.interval_seconds || null
+			form.max_body_bytes = task.max_body_bytes || null
+			form.expect_status = task.expect_status || null
+			form.response_header_timeout = task.response_header_timeout || null
+			form.idle_conn_timeout = task.idle_conn_timeout || null
+			form.follow_redirects = task.follow_redirects !== false
+			form.max_redirects = task.max_redirects || null
+			form.coalesce_seconds = task.coalesce_seconds || null
+			form.anomaly_k = task.anomaly_k || null
+			form.retention_days = task.retention_days || null
+			form.expire_at = ''
+			if (!this.isZeroTime(task.expire_at)) {
+				const d = new Date(task.expire_at)
+				form.expire_at = new Date(d.getTime() - d.getTimezoneOffset() * 60000).toISOString().slice(0, 16)
+			}
+			this.formRows = [{ key: '', value: '' }]
+			if (task.body_type === 'form' && task.body) {
+				this.formRows = [...new URLSearchParams(task.body)].map(([key, value]) => ({ key, value }))
+			}
+			this.newTask = form
+			this.scheduleMode = task.interval_seconds > 0 ? 'interval' : 'cron'
+			this.editingTaskId = task.id
+			this.describeNewCron()
+			document.getElementById('add-task-form').scrollIntoView({ behavior: 'smooth' })
+		},
+		cancelEdit() {
+			this.resetTaskForm()
+		},
+		loadProjects() {
+			axios.get('/api/projects')
+				.then(res => { this.projects = res.data || []; })
+				.catch(err => console.error("加载项目失败:", err))
+		},
+		addProject() {
+			if (!this.newProjectName) {
+				return alert("请填写项目名称")
+			}
+			axios.post('/api/projects', { name: this.newProjectName })
+				.then(() => {
+					this.newProjectName = ''
+					this.loadProjects()
+				})
+				.catch(err => alert("添加项目失败: " + (err.response?.data?.error || err.message)))
+		},
+		deleteProject(project) {
+			let cascade = false
+			if (project.task_count > 0) {
+				if (!confirm("项目「" + project.name + "」下还有 " + project.task_count + " 个任务，确定要连同这些任务一起删除吗？")) return
+				cascade = true
+			} else if (!confirm("确定要删除项目「" + project.name + "」吗？")) {
+				return
+			}
+			axios.delete('/api/projects/' + project.id, { params: { cascade } })
+				.then(() => {
+					this.loadProjects()
+					this.loadTasks()
+				})
+				.catch(err => alert("删除失败: " + (err.response?.data?.error || err.message)))
+		},
+		cloneTask(id) {
+			axios.post('/api/tasks/' + id + '/clone')
+				.then(res => {
+					this.loadTasks()
+					this.loadProjects()
+					this.editTask(res.data)
 				})
+				.catch(err => alert("复制失败: " + (err.response?.data?.error || err.message)))
 		},
 		deleteTask(id) {
 			if (confirm("确定要删除这个任务吗？")) {
 				axios.delete('/api/tasks/' + id)
-					.then(() => { this.loadTasks() })
+					.then(() => {
+						this.loadTasks()
+						this.loadProjects()
+					})
 					.catch(err => alert("删除失败: " + err.message))
 			}
 		},
+		toggleTheme() {
+			this.theme = this.theme === 'dark' ? 'light' : 'dark'
+			document.documentElement.dataset.theme = this.theme
+			localStorage.setItem('pipigo-theme', this.theme)
+		},
+		isBodyRef(body) {
+			return typeof body === 'string' && body.startsWith('bodyref:') && !body.startsWith('bodyref:inline:')
+		},
+		inlineBody(body) {
+			return typeof body === 'string' && body.startsWith('bodyref:inline:') ? body.slice('bodyref:inline:'.length) : body
+		},
+		loadBody(logId) {
+			axios.get('/api/logs/' + logId + '/body', { responseType: 'text', transformResponse: r => r })
+				.then(res => { this.loadedBodies[logId] = res.data })
+				.catch(err => alert("加载响应体失败: " + (err.response?.data || err.message)))
+		},
+		validatorHasTarget(v) {
+			return v.type === 'header' || v.type === 'json_path'
+		},
+		validatorPlaceholder(v) {
+			return {
+				status: { target: '-', value: '状态码范围，例如 200-299,304' },
+				header: { target: '响应头名称，例如 X-Health', value: '期望值，例如 ok' },
+				body_contains: { target: '-', value: '要包含的内容，例如 "ok":true' },
+				body_regex: { target: '-', value: '正则表达式，例如 ^OK' },
+				json_path: { target: '字段路径，例如 data.status', value: '期望值，例如 healthy 或 /^(ok|degraded)$/' },
+			}[v.type] || {}
+		},
+		loadHistory(taskId, page) {
+			axios.get('/api/tasks/' + taskId + '/logs', { params: { page, size: 20 } })
+				.then(res => { this.history[taskId] = res.data })
+				.catch(err => alert("加载执行历史失败: " + (err.response?.data?.error || err.message)))
+		},
+		latestByURL(task) {
+			// 每个地址取最近的一条日志 (日志已按时间倒序排列)
+			return [task.url, ...task.urls].map(url => ({ url, log: (task.logs || []).find(log => log.url === url) }))
+		},
+		validateAll() {
+			axios.get('/api/tasks/validate-all')
+				.then(res => {
+					const { total, problems } = res.data
+					if (problems.length === 0) {
+						return alert("全部 " + total + " 个任务的 Cron 表达式均有效")
+					}
+					alert("共 " + total + " 个任务，发现 " + problems.length + " 个问题:\n" +
+						problems.map(p => "#" + p.task_id + " " + p.name + " (" + p.cron + "): " + p.error).join("\n"))
+				})
+				.catch(err => alert("校验失败: " + err.message))
+		},
+		timeoutKindLabel(kind) {
+			return { connect: '连接超时', tls_handshake: 'TLS 握手超时', response_header: '响应头超时', total: '总超时' }[kind] || '超时'
+		},
+		triggerLabel(trigger) {
+			return { manual: '手动', schedule: '定时', smoke: '试运行' }[trigger] || trigger
+		},
+		smokeTestAll() {
+			if (!confirm("将所有已启用的任务立即执行一次 (不影响定时调度)，确定继续吗？")) {
+				return
+			}
+			const saveLogs = confirm("是否将本次试运行的结果写入日志？")
+			this.smokeTesting = true
+			axios.post('/api/tasks/smoke-test' + (saveLogs ? '?save_logs=true' : ''))
+				.then(res => {
+					const { total, passed, failed, results } = res.data
+					if (saveLogs) {
+						this.loadTasks()
+					}
+					if (failed === 0) {
+						return alert("全部 " + total + " 个任务试运行成功")
+					}
+					const lines = results.filter(r => !r.success).map(r => "#" + r.task_id + " " + r.name + ": " +
+						r.targets.filter(x => !x.success).map(x => x.status_text).join("; "))
+					alert("共 " + total + " 个任务，成功 " + passed + " 个，失败 " + failed + " 个:\n" + lines.join("\n"))
+				})
+				.catch(err => alert("试运行失败: " + (err.response?.data?.error || err.message)))
+				.finally(() => { this.smokeTesting = false })
+		},
+		bulkUpdate() {
+			const input = prompt("输入要修改的字段 (JSON)，例如 {\"timeout\": 30}。set_headers 中的请求头会合并到每个任务已有的请求头，值为空表示删除:", '{"timeout": 30}')
+			if (!input) {
+				return
+			}
+			let fields
+			try {
+				fields = JSON.parse(input)
+			} catch (e) {
+				return alert("不是有效的 JSON: " + e.message)
+			}
+			const setHeaders = fields.set_headers
+			delete fields.set_headers
+			axios.post('/api/tasks/bulk-update', { ids: this.selectedIds, fields: fields, set_headers: setHeaders })
+				.then(res => {
+					alert("已修改 " + res.data.updated + " 个任务")
+					this.selectedIds = []
+					this.loadTasks()
+				})
+				.catch(err => {
+					const results = err.response?.data?.results || []
+					const lines = results.filter(r => r.error).map(r => "#" + r.id + ": " + r.error)
+					alert("批量修改失败: " + (err.response?.data?.error || err.message) + (lines.length ? "\n" + lines.join("\n") : ""))
+				})
+		},
+		bulkDelete() {
+			if (!confirm("确定要删除所选的 " + this.selectedIds.length + " 个任务及其所有日志吗？此操作无法撤销。")) {
+				return
+			}
+			axios.post('/api/tasks/bulk-delete', { ids: this.selectedIds })
+				.then(res => {
+					const notFound = res.data.not_found
+					alert("已删除 " + res.data.deleted + " 个任务" + (notFound.length ? "，以下任务不存在: #" + notFound.join(", #") : ""))
+					this.selectedIds = []
+					this.loadTasks()
+				})
+				.catch(err => alert("批量删除失败: " + (err.response?.data?.error || err.message)))
+		},
+		toggleTask(task) {
+			axios.post('/api/tasks/' + task.id + '/toggle')
+				.then(res => {
+					task.enabled = res.data.enabled
+					this.loadTasks()
+				})
+				.catch(err => {
+					alert("操作失败: " + (err.response?.data?.error || err.message))
+					this.loadTasks()
+				})
+		},
+		togglePin(task) {
+			axios.post('/api/tasks/' + task.id + '/pin', { pinned: !task.pinned })
+				.then(() => { this.loadTasks() })
+				.catch(err => alert("操作失败: " + (err.response?.data?.error || err.message)))
+		},
 		runTask(id) {
 			axios.post('/api/tasks/' + id + '/run')
 				.then(() => {
@@ -452,8 +3918,190 @@ createApp({
 				})
 				.catch(err => alert("执行失败: " + err.message))
 		},
+		runTaskWithTimeout(task) {
+			const input = prompt("本次执行使用的超时时间 (秒)，任务设置为 " + task.timeout + " 秒:", task.timeout * 2)
+			if (input === null) return
+			axios.post('/api/tasks/' + task.id + '/run', null, { params: { timeout: input } })
+				.then(() => {
+					alert("任务已提交执行，请稍后查看最新结果。")
+					setTimeout(() => this.loadTasks(), Number(input) * 1000 + 1000)
+				})
+				.catch(err => alert("执行失败: " + (err.response?.data?.error || err.message)))
+		},
+		describeNewCron() {
+			// 输入停顿后再请求描述，避免每次按键都请求
+			clearTimeout(this.describeTimer)
+			this.describeTimer = setTimeout(() => {
+				if (!this.newTask.cron) {
+					this.cronDescription = ''
+					return
+				}
+				axios.get('/api/cron/describe', { params: { expr: this.newTask.cron } })
+					.then(res => { this.cronDescription = res.data.description })
+					.catch(err => { this.cronDescription = err.response?.data?.error || '' })
+			}, 300)
+		},
+		formatBody() {
+			try {
+				this.newTask.body = JSON.stringify(JSON.parse(this.newTask.body), null, 2)
+			} catch (e) {
+				alert("请求体 (Body) 不是有效的JSON格式: " + e.message)
+			}
+		},
+		toggleSimulate(id) {
+			if (this.simulations[id]) {
+				delete this.simulations[id]
+				return
+			}
+			this.simulations[id] = { status: 200, body: '', result: null }
+		},
+		simulateTask(id) {
+			const sim = this.simulations[id]
+			axios.post('/api/tasks/' + id + '/simulate', { status: sim.status, body: sim.body })
+				.then(res => { sim.result = res.data })
+				.catch(err => alert("模拟执行失败: " + (err.response?.data?.error || err.message)))
+		},
+		toggleSchedulePreview(id) {
+			if (this.schedulePreviews[id]) {
+				delete this.schedulePreviews[id]
+				return
+			}
+			axios.get('/api/tasks/' + id + '/schedule', { params: { count: 10 } })
+				.then(res => { this.schedulePreviews[id] = res.data.runs })
+				.catch(err => alert("加载执行预览失败: " + (err.response?.data?.error || err.message)))
+		},
+		toggleHeaders(logId) {
+			if (this.shownHeaders[logId]) {
+				delete this.shownHeaders[logId]
+			} else {
+				this.shownHeaders[logId] = true
+			}
+		},
+		formatHeaders(raw) {
+			try {
+				return Object.entries(JSON.parse(raw)).map(([name, value]) => name + ': ' + value).join('\n')
+			} catch (e) {
+				return raw
+			}
+		},
+		toggleBaseline(id) {
+			if (this.baselines[id]) {
+				delete this.baselines[id]
+				return
+			}
+			axios.get('/api/tasks/' + id + '/latency-baseline')
+				.then(res => { this.baselines[id] = res.data.baselines })
+				.catch(err => alert("加载响应时间基线失败: " + (err.response?.data?.error || err.message)))
+		},
+		toggleShares(id) {
+			if (this.shares[id]) {
+				delete this.shares[id]
+				return
+			}
+			this.loadShares(id)
+		},
+		loadShares(id) {
+			axios.get('/api/tasks/' + id + '/shares')
+				.then(res => { this.shares[id] = res.data })
+				.catch(err => alert("加载分享链接失败: " + (err.response?.data?.error || err.message)))
+		},
+		createShare(id) {
+			const hours = prompt("有效期 (小时)，留空或0表示永不过期:", '72')
+			if (hours === null) {
+				return
+			}
+			const note = prompt("备注 (可选，例如分享对象):", '') || ''
+			axios.post('/api/tasks/' + id + '/shares', { note: note, expires_in_hours: parseInt(hours) || 0 })
+				.then(res => {
+					prompt("分享链接已创建，链接只显示这一次，请复制保存:", location.origin + res.data.url)
+					this.loadShares(id)
+				})
+				.catch(err => alert("创建分享链接失败: " + (err.response?.data?.error || err.message)))
+		},
+		revokeShare(id, shareId) {
+			if (!confirm("撤销后该链接将无法再访问，确定吗？")) {
+				return
+			}
+			axios.delete('/api/tasks/' + id + '/shares/' + shareId)
+				.then(() => this.loadShares(id))
+				.catch(err => alert("撤销分享链接失败: " + (err.response?.data?.error || err.message)))
+		},
+		toggleLatency(id) {
+			if (this.latency[id]) {
+				delete this.latency[id]
+				return
+			}
+			axios.get('/api/tasks/' + id + '/latency', { params: { window: '24h' } })
+				.then(res => { this.latency[id] = res.data })
+				.catch(err => alert("加载耗时分位失败: " + (err.response?.data?.error || err.message)))
+		},
+		hasLogForTrigger(task) {
+			// 定时执行的日志记录了计划时间，与调度器的上次触发时间相同即为这次触发的日志 (跳过也会记录日志)
+			const prev = new Date(task.prev_run).getTime()
+			return (task.logs || []).some(log => new Date(log.scheduled_at).getTime() === prev)
+		},
+		statusRanges(task) {
+			// 视为成功的状态码范围：校验规则中的 status 规则优先，其次是期望状态码和成功状态码设置
+			const rule = (task.validators || []).find(v => v.type === 'status')
+			return rule ? rule.value : (task.expect_status ? String(task.expect_status) : (task.success_status_ranges || '200-299'))
+		},
+		inStatusRanges(ranges, code) {
+			return ranges.split(',').some(r => {
+				const [lo, hi] = r.split('-').map(Number)
+				return code >= lo && code <= (hi || lo)
+			})
+		},
+		expectedBadges(task) {
+			// 任务配置的成功条件：状态码、耗时上限 (超时时间) 以及其他校验规则
+			const badges = [
+				{ text: '状态 ' + this.statusRanges(task).replace('200-299', '2xx'), title: '视为成功的状态码' },
+				{ text: '耗时 < ' + task.timeout + 's', title: '超过超时时间的请求视为失败' },
+			]
+			if (task.expect_body_contains) {
+				badges.push({ text: '响应体包含', title: task.expect_body_contains })
+			}
+			if (task.expect_header) {
+				badges.push({ text: '响应头 ' + task.expect_header, title: task.expect_header + (task.expect_header_value ? ' = ' + task.expect_header_value : ' 存在') })
+			}
+			const rules = (task.validators || []).filter(v => v.type !== 'status')
+			if (rules.length > 0) {
+				badges.push({ text: '校验规则 ' + rules.length + ' 条', title: rules.map(v => v.type + (v.target ? ' ' + v.target : '') + (v.value ? ' = ' + v.value : '')).join('\n') })
+			}
+			return badges
+		},
+		actualBadges(task) {
+			// 最近一次实际执行 (不含跳过) 的结果，与期望对照
+			const log = (task.logs || []).find(l => !l.skipped)
+			if (!log) {
+				return [{ text: '暂无执行记录', cls: '' }]
+			}
+			const badges = [{ text: log.success ? '成功' : '失败', cls: log.success ? 'tag-ok' : 'tag-fail', title: log.status_text }]
+			const match = /状态: (\d+)/.exec(log.status_text)
+			if (match) {
+				const code = Number(match[1])
+				badges.push({ text: 'HTTP ' + code, cls: this.inStatusRanges(this.statusRanges(task), code) ? 'tag-ok' : 'tag-fail', title: log.status_text })
+			}
+			if (match || log.duration_ms > 0) {
+				const budget = (log.timeout || task.timeout) * 1000
+				badges.push({ text: log.duration_ms + 'ms', cls: log.duration_ms > budget * 0.8 ? 'tag-warn' : (match ? 'tag-ok' : ''), title: '超时时间 ' + budget + 'ms' })
+			}
+			const validations = (log.validations || []).filter(v => v.type !== 'status')
+			if (validations.length > 0) {
+				const failed = validations.filter(v => !v.passed)
+				badges.push({ text: '校验 ' + (validations.length - failed.length) + '/' + validations.length, cls: failed.length ? 'tag-fail' : 'tag-ok', title: failed.map(v => v.message).join('\n') || '全部通过' })
+			}
+			return badges
+		},
+		formatExtracted(extracted, name) {
+			const value = extracted ? extracted[name] : undefined
+			if (value === undefined || value === null) return '-'
+			return typeof value === 'object' ? JSON.stringify(value) : String(value)
+		},
+		isZeroTime(timeStr) {
+			return !timeStr || timeStr.startsWith("0001-01-01")
+		},
 		formatTime(timeStr) {
-			if (!timeStr || timeStr.startsWith("0001-01-01")) return "N/A"
+			if (this.isZeroTime(timeStr)) return "N/A"
 			return new Date(timeStr).toLocaleString()
 		}
 	}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRequestContentLength(t *testing.T) {
+	type received struct {
+		contentLength int64
+		body          string
+	}
+	got := make(chan received, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		got <- received{r.ContentLength, string(body)}
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name    string
+		body    string
+		headers string
+	}{
+		{"ASCII", `{"ok":true}`, ""},
+		{"多字节 UTF-8", `{"msg":"你好，世界 🚀"}`, ""},
+		{"忽略请求头中的 Content-Length", "数据", `{"Content-Length":"1"}`},
+		{"空请求体", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			task := Task{Method: "POST", URL: server.URL, Body: tt.body, Headers: tt.headers, Timeout: 5}
+			entry, ok := doRequest(&task, newRequestID())
+			if !ok {
+				t.Fatalf("请求失败: %s", entry.StatusText)
+			}
+			r := <-got
+			if r.body != tt.body {
+				t.Errorf("请求体为 %q，期望 %q", r.body, tt.body)
+			}
+			if r.contentLength != int64(len(tt.body)) {
+				t.Errorf("Content-Length 为 %d，实际请求体为 %d 字节", r.contentLength, len(tt.body))
+			}
+			if entry.RequestBytes != len(tt.body) {
+				t.Errorf("记录的请求体大小为 %d，期望 %d", entry.RequestBytes, len(tt.body))
+			}
+		})
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	tests := []struct {
+		name  string
+		value string
+		want  time.Duration
+		ok    bool
+	}{
+		{"秒数", "120", 2 * time.Minute, true},
+		{"秒数带空格", " 5 ", 5 * time.Second, true},
+		{"零秒", "0", 0, true},
+		{"负数", "-1", 0, false},
+		{"HTTP 日期", now.Add(90 * time.Second).Format(http.TimeFormat), 90 * time.Second, true},
+		{"过去的 HTTP 日期", now.Add(-time.Hour).Format(http.TimeFormat), 0, true},
+		{"空值", "", 0, false},
+		{"无效值", "soon", 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := parseRetryAfter(tt.value, now)
+			if got != tt.want || ok != tt.ok {
+				t.Errorf("parseRetryAfter(%q) = %v, %v，期望 %v, %v", tt.value, got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+// blockingStore 是写入时阻塞到 release 被关闭的外部存储，模拟很慢的上传
+type blockingStore struct {
+	started chan struct{}
+	release chan struct{}
+}
+
+func (s *blockingStore) Put(key string, body []byte) error {
+	close(s.started)
+	<-s.release
+	return nil
+}
+func (s *blockingStore) Get(key string) ([]byte, error) { return nil, nil }
+func (s *blockingStore) Delete(key string) error        { return nil }
+func (s *blockingStore) Name() string                   { return "blocking" }
+
+func TestAppendLogDoesNotWaitForOtherTasks(t *testing.T) {
+	setupTestDB(t)
+	store := &blockingStore{started: make(chan struct{}), release: make(chan struct{})}
+	oldBackend, oldThreshold := bodyBackend, bodyStoreThreshold
+	bodyBackend, bodyStoreThreshold = store, 16
+	defer func() { bodyBackend, bodyStoreThreshold = oldBackend, oldThreshold }()
+
+	// 任务 1 的大响应体上传到外部存储时阻塞
+	slow := make(chan struct{})
+	go func() {
+		defer close(slow)
+		appendLog(&Log{TaskID: 1, ResponseBody: strings.Repeat("x", 64)})
+	}()
+	<-store.started
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		appendLog(&Log{TaskID: 2, ResponseBody: "ok"})
+	}()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("任务 2 的日志写入在等待任务 1 的上传")
+	}
+	close(store.release)
+	<-slow
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Prometheus 指标，启动时注册一次。每个地址的每次请求 (含重试后的最终结果) 计为一次执行，
+// 排队时被清除或因开关、节假日、熔断跳过的执行不计入。按任务ID区分，任务名称作为附加标签，
+// 任务删除或改名时清除它原有的指标
+var (
+	taskRunsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "pipigo_task_runs_total",
+		Help: "任务执行次数，按任务和结果 (success/failure) 区分",
+	}, []string{"task_id", "task", "status"})
+	taskDurationSeconds = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "pipigo_task_duration_seconds",
+		Help:    "任务请求的耗时 (秒)",
+		Buckets: []float64{0.01, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60},
+	}, []string{"task_id", "task"})
+	tasksRegistered = prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "pipigo_tasks_registered",
+		Help: "当前加载的任务数量",
+	}, func() float64 {
+		taskMutex.Lock()
+		defer taskMutex.Unlock()
+		return float64(len(tasks))
+	})
+)
+
+func init() {
+	prometheus.MustRegister(taskRunsTotal, taskDurationSeconds, tasksRegistered)
+}
+
+// recordRunMetrics 记录一次请求的结果和耗时
+func recordRunMetrics(t *Task, entry *Log) {
+	status := "failure"
+	if entry.Success {
+		status = "success"
+	}
+	id := strconv.Itoa(t.ID)
+	taskRunsTotal.WithLabelValues(id, t.Name, status).Inc()
+	taskDurationSeconds.WithLabelValues(id, t.Name).Observe(float64(entry.DurationMs) / 1000)
+}
+
+// clearTaskMetrics 删除任务的全部指标
+func clearTaskMetrics(id int) {
+	labels := prometheus.Labels{"task_id": strconv.Itoa(id)}
+	taskRunsTotal.DeletePartialMatch(labels)
+	taskDurationSeconds.DeletePartialMatch(labels)
+}
+
+// registerMetricsRoutes 注册 Prometheus 抓取接口 GET /metrics
+func registerMetricsRoutes(r gin.IRoutes) {
+	r.GET("/metrics", gin.WrapH(promhttp.Handler()))
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestDeleteTasksClearsMetrics(t *testing.T) {
+	setupTestDB(t)
+	taskRunsTotal.Reset()
+	taskDurationSeconds.Reset()
+
+	// 两个同名任务的指标互不影响
+	a := &Task{Name: "同名", URL: "http://example.com", CronExpr: "@every 1h"}
+	b := &Task{Name: "同名", URL: "http://example.com", CronExpr: "@every 1h"}
+	addTestTask(t, a)
+	addTestTask(t, b)
+	recordRunMetrics(a, &Log{Success: true})
+	recordRunMetrics(b, &Log{Success: false})
+	if n := testutil.CollectAndCount(taskRunsTotal); n != 2 {
+		t.Fatalf("执行次数有 %d 个序列，期望 2 个", n)
+	}
+
+	deleteTasks([]int{a.ID})
+	if n := testutil.CollectAndCount(taskRunsTotal); n != 1 {
+		t.Errorf("删除任务后执行次数还有 %d 个序列，期望 1 个", n)
+	}
+	if n := testutil.CollectAndCount(taskDurationSeconds); n != 1 {
+		t.Errorf("删除任务后耗时还有 %d 个序列，期望 1 个", n)
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// schemaVersion 是当前程序对应的数据库结构版本。表结构的变化需要迁移数据或不兼容旧版本时递增，
+// 数据库记录的版本高于该值时说明数据库已被更新版本的程序升级过，拒绝启动
+const schemaVersion = 1
+
+// schemaMeta 记录数据库结构的版本，表中只有一行
+type schemaMeta struct {
+	ID        int `gorm:"primaryKey"`
+	Version   int
+	UpdatedAt time.Time
+}
+
+func (schemaMeta) TableName() string { return "schema_meta" }
+
+// migrationStep 是迁移一张表的步骤。required 的表迁移失败时无法启动，
+// 其余的表迁移失败时只影响相关功能，输出警告后继续启动
+type migrationStep struct {
+	name     string
+	model    any
+	required bool
+}
+
+var migrationSteps = []migrationStep{
+	{"任务表 (tasks)", &Task{}, true},
+	{"日志表 (logs)", &Log{}, true},
+	{"用户表 (users)", &User{}, true},
+	{"通知渠道表 (notification_channels)", &NotificationChannel{}, false},
+	{"项目表 (projects)", &Project{}, false},
+	{"分享链接表 (share_links)", &ShareLink{}, false},
+}
+
+// migrateDatabase 检查数据库结构版本，逐张表自动迁移并确认迁移后的列完整
+func migrateDatabase() error {
+	fresh := !db.Migrator().HasTable(&Task{})
+	if err := db.AutoMigrate(&schemaMeta{}); err != nil {
+		return fmt.Errorf("创建结构版本表失败: %v", err)
+	}
+	var meta schemaMeta
+	if err := db.Limit(1).Find(&meta).Error; err != nil {
+		return fmt.Errorf("读取数据库结构版本失败: %v", err)
+	}
+	if meta.Version > schemaVersion {
+		return fmt.Errorf("数据库结构版本为 %d，高于当前程序支持的版本 %d，请使用更新版本的 pipiGo，或从备份恢复升级前的数据库",
+			meta.Version, schemaVersion)
+	}
+
+	backfillSuccess := db.Migrator().HasTable(&Log{}) && !db.Migrator().HasColumn(&Log{}, "success")
+	for _, step := range migrationSteps {
+		err := db.AutoMigrate(step.model)
+		if err == nil {
+			err = verifyColumns(step.model)
+		}
+		if err == nil {
+			continue
+		}
+		if step.required {
+			return fmt.Errorf("迁移%s失败: %v", step.name, err)
+		}
+		fmt.Printf("迁移%s失败，相关功能可能无法使用: %v\n", step.name, err)
+	}
+	// 旧日志没有记录是否成功，按当时的判断方式 (只有 2xx 视为成功) 从状态文本推断
+	if backfillSuccess {
+		if err := db.Exec("UPDATE logs SET success = (COALESCE(skipped, 0) = 0 AND status_text GLOB ?)", "状态: 2[0-9][0-9]").Error; err != nil {
+			fmt.Printf("推断旧日志的执行结果失败: %v\n", err)
+		}
+	}
+
+	if meta.Version != schemaVersion {
+		from := meta.Version
+		meta.ID, meta.Version = 1, schemaVersion
+		if err := db.Save(&meta).Error; err != nil {
+			return fmt.Errorf("保存数据库结构版本失败: %v", err)
+		}
+		if !fresh {
+			fmt.Printf("数据库结构已从版本 %d 升级到版本 %d\n", from, schemaVersion)
+		}
+	}
+	return nil
+}
+
+// verifyColumns 确认模型的每个字段在表中都有对应的列，避免迁移只完成了一部分
+func verifyColumns(model any) error {
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(model); err != nil {
+		return err
+	}
+	var missing []string
+	for _, field := range stmt.Schema.Fields {
+		if field.DBName == "" || field.IgnoreMigration {
+			continue
+		}
+		if !db.Migrator().HasColumn(model, field.DBName) {
+			missing = append(missing, field.DBName)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("缺少列 %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// checkBackupVersion 在恢复备份前确认备份的结构版本不高于当前程序支持的版本
+func checkBackupVersion(path string) error {
+	backup, err := gorm.Open(sqlite.Open("file:"+path+"?mode=ro"), &gorm.Config{})
+	if err != nil {
+		return fmt.Errorf("打开备份失败: %v", err)
+	}
+	if sqlDB, err := backup.DB(); err == nil {
+		defer sqlDB.Close()
+	}
+	if !backup.Migrator().HasTable(&schemaMeta{}) {
+		return nil
+	}
+	var meta schemaMeta
+	backup.Limit(1).Find(&meta)
+	if meta.Version > schemaVersion {
+		return fmt.Errorf("备份的数据库结构版本为 %d，高于当前程序支持的版本 %d，无法恢复", meta.Version, schemaVersion)
+	}
+	return nil
+}
@@ -0,0 +1,532 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// NotificationChannel 定义了一个通知渠道，任务通过名称订阅
+type NotificationChannel struct {
+	ID          int    `json:"id" gorm:"primaryKey"`
+	Name        string `json:"name" gorm:"uniqueIndex;size:191"`
+	Type        string `json:"type"`                    // 渠道类型: webhook、slack 或 email
+	Config      string `json:"config" gorm:"type:text"` // 渠道配置 (JSON string)，字段取决于类型
+	MinSeverity string `json:"min_severity"`            // 只发送不低于该级别的事件: info、warning 或 critical
+	// 自定义消息模板 (Go text/template)，为空时使用默认格式。webhook 渠道的渲染结果作为请求体发送；
+	// slack 渠道的渲染结果是 JSON 对象时直接作为消息发送 (例如 blocks)，否则作为消息文本；email 渠道作为邮件正文
+	Template string `json:"template" gorm:"type:text"`
+}
+
+// 通知渠道类型
+const (
+	channelWebhook = "webhook"
+	channelSlack   = "slack"
+	channelEmail   = "email"
+)
+
+// 事件级别，数值越大越严重
+const (
+	severityInfo     = "info"
+	severityWarning  = "warning"
+	severityCritical = "critical"
+)
+
+var severityLevels = map[string]int{severityInfo: 0, severityWarning: 1, severityCritical: 2}
+
+// webhookConfig 是 webhook 渠道的配置，事件以 JSON 格式 POST 到 URL
+type webhookConfig struct {
+	URL     string            `json:"url"`
+	Headers map[string]string `json:"headers"`
+}
+
+// slackConfig 是 slack 渠道的配置，使用 Incoming Webhook 发送文本消息
+type slackConfig struct {
+	WebhookURL string `json:"webhook_url"`
+}
+
+// emailConfig 是 email 渠道的配置，通过 SMTP 发送邮件
+type emailConfig struct {
+	Host     string   `json:"host"`
+	Port     int      `json:"port"`
+	Username string   `json:"username"`
+	Password string   `json:"password"`
+	From     string   `json:"from"`
+	To       []string `json:"to"`
+}
+
+// notifyEvent 是一次需要通知的事件，也是消息模板中可以访问的数据
+type notifyEvent struct {
+	TaskID   int       `json:"task_id"`
+	TaskName string    `json:"task_name"`
+	Severity string    `json:"severity"`
+	Title    string    `json:"title"`
+	Message  string    `json:"message"`
+	Time     time.Time `json:"time"`
+	// 由执行结果触发的事件 (失败、持续失败和恢复) 附带的执行详情，其他事件为空
+	URL        string         `json:"url,omitempty"`
+	Status     string         `json:"status,omitempty"` // success 或 failure
+	StatusText string         `json:"status_text,omitempty"`
+	StatusCode int            `json:"status_code,omitempty"` // 没有收到响应时为0
+	DurationMs int64          `json:"duration_ms,omitempty"`
+	Response   string         `json:"response,omitempty"` // 响应体的开头部分
+	Extracted  map[string]any `json:"extracted,omitempty"`
+}
+
+// notifyClient 用于发送通知，使用独立的短超时，避免通知渠道异常拖慢任务
+var notifyClient = &http.Client{Timeout: 10 * time.Second}
+
+// notifyState 记录任务当前的连续失败情况，用于只在状态变化时通知，并对持续失败的重复通知进行节流
+type notifyState struct {
+	failures       int       // 当前连续失败次数，0 表示上一次执行成功
+	lastNotified   time.Time // 本轮失败中最近一次发送失败通知的时间
+	notifiedAtFail int       // 最近一次发送失败通知时的连续失败次数
+}
+
+var (
+	notifyStates = make(map[int]*notifyState)
+	notifyMutex  sync.Mutex
+)
+
+// notifyOutcome 根据本次执行结果决定是否通知：首次失败时发送失败通知，之后按任务的节流配置重复提醒，
+// 从失败中恢复时总是发送恢复通知。任务处于抖动状态时不发送逐次的状态变化通知，由抖动检测统一提醒。
+func notifyOutcome(t *Task, success bool, entry *Log) {
+	notifyMutex.Lock()
+	st, ok := notifyStates[t.ID]
+	if !ok {
+		st = &notifyState{}
+		notifyStates[t.ID] = st
+	}
+	wasFailures := st.failures
+	var repeat bool
+	if success {
+		st.failures = 0
+	} else {
+		st.failures++
+		now := time.Now()
+		switch {
+		case st.failures == 1:
+			st.lastNotified, st.notifiedAtFail = now, 1
+		case shouldRepeatFailure(t, st, now):
+			st.lastNotified, st.notifiedAtFail = now, st.failures
+			repeat = true
+		}
+	}
+	failures := st.failures
+	notifyMutex.Unlock()
+
+	if isFlapping(t.ID) {
+		return
+	}
+	switch {
+	case !success && failures == 1:
+		notifyRun(t, severityCritical, "任务执行失败", entry.StatusText, entry)
+	case repeat:
+		notifyRun(t, severityCritical, "任务持续失败", fmt.Sprintf("已连续失败 %d 次，最近一次: %s", failures, entry.StatusText), entry)
+	case success && wasFailures > 0:
+		notifyRun(t, severityInfo, "任务已恢复", fmt.Sprintf("连续失败 %d 次后恢复: %s", wasFailures, entry.StatusText), entry)
+	}
+}
+
+// failureWebhookPayload 是发送到任务失败通知 webhook 的内容
+type failureWebhookPayload struct {
+	Task   string    `json:"task"`
+	URL    string    `json:"url"`
+	Status int       `json:"status"` // 响应状态码，没有收到响应 (连接错误、超时) 时为0
+	Error  string    `json:"error"`
+	Time   time.Time `json:"time"`
+}
+
+// notifyFailureWebhook 将一次失败的执行发送到任务配置的 webhook。每次执行只发送一次 (重试之后的最终结果)，
+// 使用通知的短超时，失败只打印日志
+func notifyFailureWebhook(t *Task, entry *Log) {
+	if t.NotifyWebhookURL == "" {
+		return
+	}
+	payload, _ := json.Marshal(failureWebhookPayload{
+		Task:   t.Name,
+		URL:    entry.URL,
+		Status: entry.statusCode,
+		Error:  entry.StatusText,
+		Time:   entry.Time,
+	})
+	if err := postJSON(t.NotifyWebhookURL, nil, payload); err != nil {
+		fmt.Printf("任务 #%d 发送失败通知到 %s 失败: %v\n", t.ID, t.NotifyWebhookURL, err)
+	}
+}
+
+// shouldRepeatFailure 判断持续失败的任务是否已越过节流限制，需要再次通知
+func shouldRepeatFailure(t *Task, st *notifyState, now time.Time) bool {
+	if t.NotifyThrottleMinutes > 0 && now.Sub(st.lastNotified) >= time.Duration(t.NotifyThrottleMinutes)*time.Minute {
+		return true
+	}
+	return t.NotifyFailureThreshold > 0 && st.failures-st.notifiedAtFail >= t.NotifyFailureThreshold
+}
+
+// clearNotifyState 清除任务的通知状态，在任务被删除时调用
+func clearNotifyState(id int) {
+	notifyMutex.Lock()
+	delete(notifyStates, id)
+	notifyMutex.Unlock()
+}
+
+// notify 将事件发送到任务订阅的所有渠道，跳过级别低于渠道要求的事件。发送在后台进行，失败只打印日志。
+func notify(t *Task, severity, title, message string) {
+	notifyRun(t, severity, title, message, nil)
+}
+
+// notifyRun 与 notify 相同，entry 不为空时事件附带该次执行的详情
+func notifyRun(t *Task, severity, title, message string, entry *Log) {
+	names := splitChannels(t.Channels)
+	if len(names) == 0 {
+		return
+	}
+	var channels []NotificationChannel
+	if err := db.Where("name IN ?", names).Find(&channels).Error; err != nil {
+		fmt.Printf("任务 #%d 加载通知渠道失败: %v\n", t.ID, err)
+		return
+	}
+
+	ev := notifyEvent{
+		TaskID:   t.ID,
+		TaskName: t.Name,
+		Severity: severity,
+		Title:    title,
+		Message:  message,
+		Time:     time.Now(),
+	}
+	if entry != nil {
+		ev.runDetails(entry)
+	}
+	for _, ch := range channels {
+		if severityLevels[severity] < severityLevels[ch.MinSeverity] {
+			continue
+		}
+		go func(ch NotificationChannel) {
+			if err := sendNotification(ch, ev); err != nil {
+				fmt.Printf("任务 #%d 发送通知到渠道 %s 失败: %v\n", t.ID, ch.Name, err)
+			}
+		}(ch)
+	}
+}
+
+// sendNotification 按渠道类型发送一条通知。渠道的消息模板渲染失败时使用默认格式发送
+func sendNotification(ch NotificationChannel, ev notifyEvent) error {
+	text := fmt.Sprintf("[%s] %s: 任务 #%d (%s)\n%s", ev.Severity, ev.Title, ev.TaskID, ev.TaskName, ev.Message)
+	custom := ""
+	if ch.Template != "" {
+		rendered, err := renderNotifyTemplate(ch, ev)
+		if err != nil {
+			fmt.Printf("渠道 %s 的消息模板渲染失败，使用默认格式: %v\n", ch.Name, err)
+		} else {
+			custom = rendered
+		}
+	}
+
+	switch ch.Type {
+	case channelWebhook:
+		var cfg webhookConfig
+		if err := json.Unmarshal([]byte(ch.Config), &cfg); err != nil {
+			return err
+		}
+		payload, _ := json.Marshal(ev)
+		if custom != "" {
+			payload = []byte(custom)
+		}
+		return postJSON(cfg.URL, cfg.Headers, payload)
+	case channelSlack:
+		var cfg slackConfig
+		if err := json.Unmarshal([]byte(ch.Config), &cfg); err != nil {
+			return err
+		}
+		if custom != "" {
+			text = custom
+		}
+		var message map[string]any
+		if json.Unmarshal([]byte(custom), &message) != nil {
+			message = map[string]any{"text": text}
+		}
+		payload, _ := json.Marshal(message)
+		return postJSON(cfg.WebhookURL, nil, payload)
+	case channelEmail:
+		var cfg emailConfig
+		if err := json.Unmarshal([]byte(ch.Config), &cfg); err != nil {
+			return err
+		}
+		if custom != "" {
+			text = custom
+		}
+		return sendEmail(cfg, ev.Title+": "+ev.TaskName, text)
+	default:
+		return fmt.Errorf("未知的渠道类型: %s", ch.Type)
+	}
+}
+
+// postJSON 以 POST 方式发送 JSON 数据，非 2xx 响应视为失败
+func postJSON(url string, headers map[string]string, payload []byte) error {
+	req, err := http.NewRequest("POST", url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+	resp, err := notifyClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("返回状态: %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// sendEmail 通过 SMTP 发送纯文本邮件
+func sendEmail(cfg emailConfig, subject, body string) error {
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", cfg.From)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(cfg.To, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=UTF-8\r\n\r\n")
+	msg.WriteString(strings.ReplaceAll(body, "\n", "\r\n"))
+
+	var auth smtp.Auth
+	if cfg.Username != "" {
+		auth = smtp.PlainAuth("", cfg.Username, cfg.Password, cfg.Host)
+	}
+	addr := cfg.Host + ":" + strconv.Itoa(cfg.Port)
+	return smtp.SendMail(addr, auth, cfg.From, cfg.To, msg.Bytes())
+}
+
+// splitChannels 解析任务订阅的渠道名称列表
+func splitChannels(s string) []string {
+	var names []string
+	for _, name := range strings.Split(s, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// validateChannels 检查任务订阅的渠道是否都存在，并规范化渠道列表的写法
+func validateChannels(t *Task) error {
+	names := splitChannels(t.Channels)
+	t.Channels = strings.Join(names, ",")
+	if len(names) == 0 {
+		return nil
+	}
+	var found []string
+	db.Model(&NotificationChannel{}).Where("name IN ?", names).Pluck("name", &found)
+	for _, name := range names {
+		if !containsString(found, name) {
+			return fmt.Errorf("通知渠道不存在: %s", name)
+		}
+	}
+	return nil
+}
+
+// containsString 判断切片中是否包含指定字符串
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// validateChannel 校验通知渠道配置并填充默认值
+func validateChannel(ch *NotificationChannel) error {
+	ch.Name = strings.TrimSpace(ch.Name)
+	if ch.Name == "" {
+		return errors.New("渠道名称是必填项")
+	}
+	if strings.Contains(ch.Name, ",") {
+		return errors.New("渠道名称不能包含逗号")
+	}
+	if ch.MinSeverity == "" {
+		ch.MinSeverity = severityInfo
+	}
+	if _, ok := severityLevels[ch.MinSeverity]; !ok {
+		return fmt.Errorf("不支持的事件级别: %s", ch.MinSeverity)
+	}
+
+	switch ch.Type {
+	case channelWebhook:
+		var cfg webhookConfig
+		if err := json.Unmarshal([]byte(ch.Config), &cfg); err != nil {
+			return fmt.Errorf("渠道配置不是有效的JSON: %v", err)
+		}
+		if cfg.URL == "" {
+			return errors.New("webhook 渠道需要配置 url")
+		}
+	case channelSlack:
+		var cfg slackConfig
+		if err := json.Unmarshal([]byte(ch.Config), &cfg); err != nil {
+			return fmt.Errorf("渠道配置不是有效的JSON: %v", err)
+		}
+		if cfg.WebhookURL == "" {
+			return errors.New("slack 渠道需要配置 webhook_url")
+		}
+	case channelEmail:
+		var cfg emailConfig
+		if err := json.Unmarshal([]byte(ch.Config), &cfg); err != nil {
+			return fmt.Errorf("渠道配置不是有效的JSON: %v", err)
+		}
+		if cfg.Host == "" || cfg.Port == 0 || cfg.From == "" || len(cfg.To) == 0 {
+			return errors.New("email 渠道需要配置 host、port、from 和 to")
+		}
+	default:
+		return fmt.Errorf("不支持的渠道类型: %s", ch.Type)
+	}
+	return validateNotifyTemplate(ch)
+}
+
+// maskedPassword 用于在接口中代替邮件渠道的真实密码
+const maskedPassword = "******"
+
+// maskChannel 隐藏渠道配置中的密码后返回
+func maskChannel(ch NotificationChannel) NotificationChannel {
+	if ch.Type != channelEmail {
+		return ch
+	}
+	var cfg emailConfig
+	if json.Unmarshal([]byte(ch.Config), &cfg) == nil && cfg.Password != "" {
+		cfg.Password = maskedPassword
+		b, _ := json.Marshal(cfg)
+		ch.Config = string(b)
+	}
+	return ch
+}
+
+// keepMaskedPassword 在更新渠道时，如果提交的是被隐藏的密码，则沿用原来的密码
+func keepMaskedPassword(updated *NotificationChannel, old NotificationChannel) {
+	if updated.Type != channelEmail || old.Type != channelEmail {
+		return
+	}
+	var cfg, oldCfg emailConfig
+	if json.Unmarshal([]byte(updated.Config), &cfg) != nil || json.Unmarshal([]byte(old.Config), &oldCfg) != nil {
+		return
+	}
+	if cfg.Password == maskedPassword {
+		cfg.Password = oldCfg.Password
+		b, _ := json.Marshal(cfg)
+		updated.Config = string(b)
+	}
+}
+
+// registerChannelRoutes 注册通知渠道的增删改查接口。渠道由所有用户的任务共用，只有管理员可以管理，
+// 普通用户只能看到渠道的名称和类型，用于在任务中订阅
+func registerChannelRoutes(r gin.IRoutes) {
+	// 获取所有通知渠道
+	r.GET("/api/channels", func(ctx *gin.Context) {
+		var list []NotificationChannel
+		db.Order("id").Find(&list)
+		admin := isAdmin(ctx)
+		for i, ch := range list {
+			if admin {
+				list[i] = maskChannel(ch)
+			} else {
+				list[i] = NotificationChannel{ID: ch.ID, Name: ch.Name, Type: ch.Type, MinSeverity: ch.MinSeverity}
+			}
+		}
+		ctx.JSON(http.StatusOK, list)
+	})
+
+	// 添加通知渠道
+	r.POST("/api/channels", requireAdmin, func(ctx *gin.Context) {
+		var req NotificationChannel
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		req.ID = 0
+		if err := validateChannel(&req); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err := db.Create(&req).Error; err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "保存通知渠道失败，名称可能已存在: " + err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusOK, maskChannel(req))
+	})
+
+	// 修改通知渠道，名称不可修改，以免订阅它的任务失效
+	r.PUT("/api/channels/:id", requireAdmin, func(ctx *gin.Context) {
+		var old NotificationChannel
+		if err := db.First(&old, ctx.Param("id")).Error; err != nil {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "通知渠道不存在"})
+			return
+		}
+		var req NotificationChannel
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		req.ID = old.ID
+		req.Name = old.Name
+		keepMaskedPassword(&req, old)
+		if err := validateChannel(&req); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err := db.Save(&req).Error; err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusOK, maskChannel(req))
+	})
+
+	// 删除通知渠道，仍被任务订阅时拒绝删除
+	r.DELETE("/api/channels/:id", requireAdmin, func(ctx *gin.Context) {
+		var ch NotificationChannel
+		if err := db.First(&ch, ctx.Param("id")).Error; err != nil {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "通知渠道不存在"})
+			return
+		}
+		var subscribers []Task
+		db.Select("id", "channels").Where("channels LIKE ?", "%"+ch.Name+"%").Find(&subscribers)
+		count := 0
+		for _, t := range subscribers {
+			if containsString(splitChannels(t.Channels), ch.Name) {
+				count++
+			}
+		}
+		if count > 0 {
+			ctx.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("通知渠道仍被 %d 个任务订阅，无法删除", count)})
+			return
+		}
+		db.Delete(&ch)
+		ctx.JSON(http.StatusOK, gin.H{"message": "通知渠道已删除"})
+	})
+
+	// 发送一条测试通知，用于验证渠道配置
+	r.POST("/api/channels/:id/test", requireAdmin, func(ctx *gin.Context) {
+		var ch NotificationChannel
+		if err := db.First(&ch, ctx.Param("id")).Error; err != nil {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "通知渠道不存在"})
+			return
+		}
+		ev := notifyEvent{Severity: severityInfo, Title: "测试通知", Message: "这是一条来自 pipiGo 的测试通知", Time: time.Now()}
+		if err := sendNotification(ch, ev); err != nil {
+			ctx.JSON(http.StatusBadGateway, gin.H{"error": "发送测试通知失败: " + err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusOK, gin.H{"message": "测试通知已发送"})
+	})
+}
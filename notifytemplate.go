@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// notifySnippetLimit 是通知中附带的响应体片段的最大字符数
+const notifySnippetLimit = 500
+
+// notifyFuncs 是通知模板中可以使用的函数
+var notifyFuncs = template.FuncMap{
+	// json 将值编码为 JSON，用于在 JSON 模板中安全地嵌入字符串，例如 {"text": {{json .Message}}}
+	"json": func(v any) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+	// truncate 截取字符串的前 n 个字符
+	"truncate": truncateRunes,
+	"upper":    strings.ToUpper,
+	"lower":    strings.ToLower,
+}
+
+// parseNotifyTemplate 解析渠道的消息模板，模板使用 Go text/template 语法，可以访问 notifyEvent 的所有字段，例如
+//
+//	{"text": {{json (printf "*%s* %s\n%s" .Title .TaskName .Message)}}}
+func parseNotifyTemplate(ch NotificationChannel) (*template.Template, error) {
+	return template.New(ch.Name).Funcs(notifyFuncs).Parse(ch.Template)
+}
+
+// renderNotifyTemplate 用事件渲染渠道的消息模板
+func renderNotifyTemplate(ch NotificationChannel, ev notifyEvent) (string, error) {
+	tmpl, err := parseNotifyTemplate(ch)
+	if err != nil {
+		return "", err
+	}
+	var b bytes.Buffer
+	if err := tmpl.Execute(&b, ev); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// validateNotifyTemplate 检查渠道的消息模板：语法正确，用示例事件能够渲染，webhook 渠道渲染的结果必须是 JSON
+func validateNotifyTemplate(ch *NotificationChannel) error {
+	if strings.TrimSpace(ch.Template) == "" {
+		ch.Template = ""
+		return nil
+	}
+	sample := notifyEvent{
+		TaskID: 1, TaskName: "示例任务", Severity: severityCritical, Title: "任务执行失败", Message: "状态: 500",
+		Time: time.Now(), URL: "https://example.com/health", Status: "failure", StatusText: "状态: 500",
+		StatusCode: 500, DurationMs: 120, Response: `{"error": "internal"}`, Extracted: map[string]any{"count": 1.0},
+	}
+	text, err := renderNotifyTemplate(*ch, sample)
+	if err != nil {
+		return fmt.Errorf("消息模板错误: %v", err)
+	}
+	if ch.Type == channelWebhook && !json.Valid([]byte(text)) {
+		return errors.New("webhook 渠道的消息模板渲染结果必须是 JSON，字符串可以用 {{json .Message}} 的写法嵌入")
+	}
+	return nil
+}
+
+// runDetails 将一次执行的结果填入事件，供消息模板使用。外部存储的响应体不附带
+func (ev *notifyEvent) runDetails(entry *Log) {
+	ev.URL = entry.URL
+	ev.Status = "failure"
+	if entry.Success {
+		ev.Status = "success"
+	}
+	ev.StatusText = entry.StatusText
+	ev.StatusCode = entry.statusCode
+	ev.DurationMs = entry.DurationMs
+	ev.Extracted = entry.Extracted
+	if body, ok := inlineBody(entry.ResponseBody); ok && entry.SampleOfID == 0 {
+		ev.Response = truncateRunes(notifySnippetLimit, body)
+	}
+}
+
+// truncateRunes 截取字符串的前 n 个字符，截断时末尾加上省略号
+func truncateRunes(n int, s string) string {
+	if r := []rune(s); len(r) > n {
+		return string(r[:n]) + "..."
+	}
+	return s
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/clientcredentials"
+)
+
+// oauthTokenTimeout 是获取 OAuth2 令牌的超时时间
+const oauthTokenTimeout = 10 * time.Second
+
+// oauthSource 是任务缓存的令牌来源，key 记录创建时的配置，配置变化后重新创建
+type oauthSource struct {
+	key string
+	src oauth2.TokenSource
+}
+
+var (
+	oauthSources = make(map[int]*oauthSource)
+	oauthMutex   sync.Mutex
+)
+
+// oauthScopes 将以空格或逗号分隔的授权范围拆分为列表
+func oauthScopes(scopes string) []string {
+	return strings.FieldsFunc(scopes, func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\t' || r == '\n'
+	})
+}
+
+// validateOAuth 校验任务的 OAuth2 配置，未配置令牌地址时清空其他字段
+func validateOAuth(t *Task) error {
+	t.OAuthTokenURL = strings.TrimSpace(t.OAuthTokenURL)
+	t.OAuthClientID = strings.TrimSpace(t.OAuthClientID)
+	if t.OAuthTokenURL == "" {
+		t.OAuthClientID, t.OAuthClientSecret, t.OAuthScopes = "", "", ""
+		return nil
+	}
+	if u, err := url.Parse(t.OAuthTokenURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("OAuth2 令牌地址必须是 http 或 https 地址")
+	}
+	if t.OAuthClientID == "" {
+		return fmt.Errorf("使用 OAuth2 时客户端ID不能为空")
+	}
+	t.OAuthScopes = strings.Join(oauthScopes(t.OAuthScopes), " ")
+	return nil
+}
+
+// oauthAuthorization 按任务的 OAuth2 客户端凭据配置获取访问令牌，返回 Authorization 请求头的值。
+// 令牌按任务缓存，过期前一直复用，过期后自动重新获取。未配置 OAuth2 时返回空字符串。
+func oauthAuthorization(t *Task) (string, error) {
+	if t.OAuthTokenURL == "" {
+		return "", nil
+	}
+	key := strings.Join([]string{t.OAuthTokenURL, t.OAuthClientID, t.OAuthClientSecret, t.OAuthScopes}, "\x00")
+
+	oauthMutex.Lock()
+	s, ok := oauthSources[t.ID]
+	if !ok || s.key != key {
+		cfg := clientcredentials.Config{
+			ClientID:     t.OAuthClientID,
+			ClientSecret: t.OAuthClientSecret,
+			TokenURL:     t.OAuthTokenURL,
+			Scopes:       oauthScopes(t.OAuthScopes),
+		}
+		ctx := context.WithValue(context.Background(), oauth2.HTTPClient, &http.Client{Timeout: oauthTokenTimeout})
+		s = &oauthSource{key: key, src: cfg.TokenSource(ctx)}
+		oauthSources[t.ID] = s
+	}
+	oauthMutex.Unlock()
+
+	token, err := s.src.Token()
+	if err != nil {
+		return "", err
+	}
+	return token.Type() + " " + token.AccessToken, nil
+}
+
+// clearOAuthToken 丢弃任务缓存的令牌，下次执行时重新获取
+func clearOAuthToken(id int) {
+	oauthMutex.Lock()
+	delete(oauthSources, id)
+	oauthMutex.Unlock()
+}
+
+// maskTask 隐藏任务中的 OAuth2 客户端密钥和 SigV4 私有访问密钥后返回，用于接口响应和导出
+func maskTask(t Task) Task {
+	if t.OAuthClientSecret != "" {
+		t.OAuthClientSecret = maskedPassword
+	}
+	if t.SigV4SecretKey != "" {
+		t.SigV4SecretKey = maskedPassword
+	}
+	return t
+}
+
+// keepMaskedSecrets 提交的密钥是隐藏后的占位符时沿用原来的密钥
+func keepMaskedSecrets(t *Task, old Task) {
+	if t.OAuthClientSecret == maskedPassword {
+		t.OAuthClientSecret = old.OAuthClientSecret
+	}
+	if t.SigV4SecretKey == maskedPassword {
+		t.SigV4SecretKey = old.SigV4SecretKey
+	}
+}
@@ -0,0 +1,463 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// postmanSchema 是导出的集合声明的格式版本
+const postmanSchema = "https://schema.getpostman.com/json/collection/v2.1.0/collection.json"
+
+// postmanCollection 是 Postman Collection v2.1 中导入和导出任务需要用到的部分
+type postmanCollection struct {
+	Info struct {
+		Name        string `json:"name"`
+		Description string `json:"description,omitempty"`
+		Schema      string `json:"schema,omitempty"`
+	} `json:"info"`
+	Item     []postmanItem     `json:"item"`
+	Variable []postmanKeyValue `json:"variable,omitempty"`
+	Auth     *postmanAuth      `json:"auth,omitempty"`
+}
+
+// postmanItem 是集合中的一项，带 item 的是文件夹，带 request 的是请求
+type postmanItem struct {
+	Name        string          `json:"name"`
+	Description json.RawMessage `json:"description,omitempty"`
+	Item        []postmanItem   `json:"item,omitempty"`
+	Request     *postmanRequest `json:"request,omitempty"`
+	Auth        *postmanAuth    `json:"auth,omitempty"`
+}
+
+// postmanRequest 是一个请求的定义，url 和 description 既可能是字符串也可能是对象
+type postmanRequest struct {
+	Method      string            `json:"method"`
+	URL         json.RawMessage   `json:"url"`
+	Header      []postmanKeyValue `json:"header"`
+	Body        *postmanBody      `json:"body,omitempty"`
+	Auth        *postmanAuth      `json:"auth,omitempty"`
+	Description json.RawMessage   `json:"description,omitempty"`
+}
+
+// UnmarshalJSON 兼容直接写成URL字符串的请求
+func (r *postmanRequest) UnmarshalJSON(data []byte) error {
+	var s string
+	if json.Unmarshal(data, &s) == nil {
+		*r = postmanRequest{Method: "GET", URL: data}
+		return nil
+	}
+	type plain postmanRequest
+	return json.Unmarshal(data, (*plain)(r))
+}
+
+// postmanBody 是请求体，mode 决定使用哪个字段
+type postmanBody struct {
+	Mode       string            `json:"mode"`
+	Raw        string            `json:"raw,omitempty"`
+	URLEncoded []postmanKeyValue `json:"urlencoded,omitempty"`
+	GraphQL    *struct {
+		Query     string `json:"query"`
+		Variables string `json:"variables"`
+	} `json:"graphql,omitempty"`
+	Options *postmanBodyOptions `json:"options,omitempty"`
+}
+
+// postmanBodyOptions 是请求体的附加选项，raw 模式下用 language 标明内容格式
+type postmanBodyOptions struct {
+	Raw struct {
+		Language string `json:"language"`
+	} `json:"raw"`
+}
+
+// postmanKeyValue 是请求头、表单字段和变量共用的键值对
+type postmanKeyValue struct {
+	Key      string `json:"key"`
+	Value    string `json:"value"`
+	Disabled bool   `json:"disabled,omitempty"`
+}
+
+// postmanAuth 是认证配置，目前只转换 bearer 和 basic 两种
+type postmanAuth struct {
+	Type   string            `json:"type"`
+	Bearer []postmanKeyValue `json:"bearer,omitempty"`
+	Basic  []postmanKeyValue `json:"basic,omitempty"`
+}
+
+// postmanVariable 匹配 Postman 变量占位符，例如 {{baseUrl}}
+var postmanVariable = regexp.MustCompile(`\{\{\s*([^{}]+?)\s*\}\}`)
+
+// postmanCronLine 匹配导出时写在请求说明第一行的 Cron 表达式，导入时据此还原执行计划
+var postmanCronLine = regexp.MustCompile("^Cron: `([^`]+)`[^\n]*\n*")
+
+// postmanImported 是一个成功导入的请求
+type postmanImported struct {
+	ID        int      `json:"id"`
+	Name      string   `json:"name"`
+	Path      string   `json:"path"`
+	Cron      string   `json:"cron"`
+	Variables []string `json:"variables,omitempty"` // 任务中保留的变量占位符，需要手动替换为实际值
+	Warnings  []string `json:"warnings,omitempty"`
+}
+
+// postmanFailed 是一个无法转换的请求及原因
+type postmanFailed struct {
+	Path   string `json:"path"`
+	Reason string `json:"reason"`
+}
+
+// postmanText 读取既可能是字符串也可能是 {"content": ...} 对象的字段
+func postmanText(raw json.RawMessage) string {
+	if len(raw) == 0 {
+		return ""
+	}
+	var s string
+	if json.Unmarshal(raw, &s) == nil {
+		return s
+	}
+	var obj struct {
+		Content string `json:"content"`
+		Raw     string `json:"raw"`
+	}
+	json.Unmarshal(raw, &obj)
+	if obj.Content != "" {
+		return obj.Content
+	}
+	return obj.Raw
+}
+
+// postmanAuthValue 取认证配置中指定键的值
+func postmanAuthValue(list []postmanKeyValue, key string) string {
+	for _, kv := range list {
+		if kv.Key == key {
+			return kv.Value
+		}
+	}
+	return ""
+}
+
+// postmanAuthHeader 将认证配置转换为 Authorization 请求头，不支持的认证方式返回错误
+func postmanAuthHeader(auth *postmanAuth) (string, error) {
+	switch auth.Type {
+	case "", "noauth":
+		return "", nil
+	case "bearer":
+		return "Bearer " + postmanAuthValue(auth.Bearer, "token"), nil
+	case "basic":
+		cred := postmanAuthValue(auth.Basic, "username") + ":" + postmanAuthValue(auth.Basic, "password")
+		return "Basic " + base64.StdEncoding.EncodeToString([]byte(cred)), nil
+	default:
+		return "", fmt.Errorf("不支持的认证方式: %s", auth.Type)
+	}
+}
+
+// postmanFormEncode 将表单字段编码为 a=1&b=2，变量占位符保持原样不转义
+func postmanFormEncode(fields []postmanKeyValue) string {
+	var parts []string
+	for _, f := range fields {
+		if f.Disabled {
+			continue
+		}
+		parts = append(parts, url.QueryEscape(f.Key)+"="+url.QueryEscape(f.Value))
+	}
+	s := strings.Join(parts, "&")
+	return strings.NewReplacer("%7B%7B", "{{", "%7D%7D", "}}").Replace(s)
+}
+
+// convertPostmanRequest 将一个 Postman 请求转换为任务，auth 为从文件夹和集合继承的认证配置
+func convertPostmanRequest(item postmanItem, auth *postmanAuth) (Task, []string, error) {
+	req := item.Request
+	t := Task{Name: item.Name, Description: postmanText(req.Description)}
+	if t.Description == "" {
+		t.Description = postmanText(item.Description)
+	}
+	if m := postmanCronLine.FindStringSubmatch(t.Description); m != nil {
+		t.CronExpr = m[1]
+		t.Description = t.Description[len(m[0]):]
+	}
+	var warnings []string
+
+	t.Method = strings.ToUpper(req.Method)
+	if t.Method == "" {
+		t.Method = "GET"
+	}
+	if !slices.Contains(supportedMethods, t.Method) {
+		return t, nil, fmt.Errorf("不支持的请求方法: %s (支持 %s)", t.Method, strings.Join(supportedMethods, "、"))
+	}
+
+	t.URL = strings.TrimSpace(postmanText(req.URL))
+	if t.URL == "" {
+		return t, nil, errors.New("缺少请求地址")
+	}
+
+	headers := make(map[string]string)
+	for _, h := range req.Header {
+		if !h.Disabled && h.Key != "" {
+			headers[h.Key] = h.Value
+		}
+	}
+	if req.Auth != nil {
+		auth = req.Auth
+	}
+	if auth != nil {
+		value, err := postmanAuthHeader(auth)
+		if err != nil {
+			return t, nil, err
+		}
+		if value != "" {
+			headers["Authorization"] = value
+		}
+	}
+	if len(headers) > 0 {
+		b, _ := json.Marshal(headers)
+		t.Headers = string(b)
+	}
+
+	if body := req.Body; body != nil && body.Mode != "" {
+		switch body.Mode {
+		case "raw":
+			t.Body = body.Raw
+			t.BodyType = bodyTypeRaw
+			if body.Options == nil || body.Options.Raw.Language == "" || body.Options.Raw.Language == "json" {
+				t.BodyType = bodyTypeJSON
+			}
+		case "urlencoded":
+			t.Body = postmanFormEncode(body.URLEncoded)
+			t.BodyType = bodyTypeForm
+		case "graphql":
+			payload := map[string]any{"query": ""}
+			if body.GraphQL != nil {
+				payload["query"] = body.GraphQL.Query
+				if strings.TrimSpace(body.GraphQL.Variables) != "" {
+					payload["variables"] = json.RawMessage(body.GraphQL.Variables)
+				}
+			}
+			b, err := json.Marshal(payload)
+			if err != nil {
+				return t, nil, fmt.Errorf("GraphQL 变量不是有效的 JSON: %v", err)
+			}
+			t.Body = string(b)
+			t.BodyType = bodyTypeJSON
+		default:
+			return t, nil, fmt.Errorf("不支持的请求体类型: %s", body.Mode)
+		}
+		if !methodHasBody(t.Method) && t.Body != "" {
+			warnings = append(warnings, t.Method+" 请求不会发送请求体，已忽略")
+			t.Body = ""
+		}
+	}
+	return t, warnings, nil
+}
+
+// postmanPlaceholders 返回任务中出现的变量名 (去重)
+func postmanPlaceholders(t *Task) []string {
+	seen := make(map[string]bool)
+	var names []string
+	for _, s := range []string{t.URL, t.Headers, t.Body} {
+		for _, m := range postmanVariable.FindAllStringSubmatch(s, -1) {
+			if !seen[m[1]] {
+				seen[m[1]] = true
+				names = append(names, m[1])
+			}
+		}
+	}
+	return names
+}
+
+// registerPostmanRoutes 注册与 Postman 集合互相转换的接口
+func registerPostmanRoutes(r gin.IRoutes) {
+	// 从 Postman 集合 (v2.1) 导入任务。变量占位符 (例如 {{baseUrl}}) 原样保留，需要在任务中手动替换。
+	// cron 为默认的 Cron 表达式，crons 可以按请求路径 (文件夹/请求名称) 单独指定，
+	// 由本服务导出的集合会在请求说明中带上原来的 Cron 表达式。
+	r.POST("/api/tasks/import/postman", func(ctx *gin.Context) {
+		var req struct {
+			Collection postmanCollection `json:"collection"`
+			Cron       string            `json:"cron"`
+			Crons      map[string]string `json:"crons"`
+			ProjectID  *int              `json:"project_id"`
+		}
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "集合格式错误: " + err.Error()})
+			return
+		}
+		if len(req.Collection.Item) == 0 {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "集合中没有任何请求"})
+			return
+		}
+		ownerID := 0
+		if user := currentUser(ctx); user != nil {
+			ownerID = user.ID
+		}
+
+		imported := []postmanImported{}
+		failed := []postmanFailed{}
+		var walk func(items []postmanItem, prefix string, auth *postmanAuth)
+		walk = func(items []postmanItem, prefix string, auth *postmanAuth) {
+			for _, item := range items {
+				path := prefix + item.Name
+				if item.Request == nil {
+					inherited := auth
+					if item.Auth != nil {
+						inherited = item.Auth
+					}
+					walk(item.Item, path+"/", inherited)
+					continue
+				}
+				t, warnings, err := convertPostmanRequest(item, auth)
+				if err != nil {
+					failed = append(failed, postmanFailed{Path: path, Reason: err.Error()})
+					continue
+				}
+				// 单独指定的优先，其次是导出时写在说明中的，最后使用默认值
+				if expr := req.Crons[path]; expr != "" {
+					t.CronExpr = expr
+				} else if t.CronExpr == "" {
+					t.CronExpr = req.Cron
+				}
+				if t.CronExpr == "" {
+					failed = append(failed, postmanFailed{Path: path, Reason: "未指定 Cron 表达式"})
+					continue
+				}
+				t.ProjectID = req.ProjectID
+				if err := validateTask(&t); err != nil {
+					failed = append(failed, postmanFailed{Path: path, Reason: err.Error()})
+					continue
+				}
+				t.OwnerID = ownerID
+				t.Enabled = true
+				if err := insertTask(db, &t); err != nil {
+					failed = append(failed, postmanFailed{Path: path, Reason: "保存任务失败: " + err.Error()})
+					continue
+				}
+				registerTask(&t)
+				imported = append(imported, postmanImported{
+					ID: t.ID, Name: t.Name, Path: path, Cron: t.CronExpr,
+					Variables: postmanPlaceholders(&t), Warnings: warnings,
+				})
+			}
+		}
+		walk(req.Collection.Item, "", req.Collection.Auth)
+
+		variables := make(map[string]string)
+		for _, v := range req.Collection.Variable {
+			variables[v.Key] = v.Value
+		}
+		ctx.JSON(http.StatusOK, gin.H{
+			"collection": req.Collection.Info.Name,
+			"imported":   imported,
+			"failed":     failed,
+			"variables":  variables, // 集合中定义的变量及其默认值，供替换占位符时参考
+		})
+	})
+	// 将任务导出为 Postman 集合 (v2.1)，有项目的任务放在与项目同名的文件夹中
+	r.GET("/api/tasks/export/postman", func(ctx *gin.Context) {
+		var list []Task
+		readDB.Scopes(ownedTasks(ctx)).Order("id").Find(&list)
+		var projects []Project
+		readDB.Find(&projects)
+		ctx.Header("Content-Disposition", `attachment; filename="pipigo-tasks.postman_collection.json"`)
+		ctx.JSON(http.StatusOK, exportPostmanCollection(list, projects))
+	})
+}
+
+// exportPostmanCollection 将任务转换为 Postman 集合
+func exportPostmanCollection(list []Task, projects []Project) postmanCollection {
+	var coll postmanCollection
+	coll.Info.Name = "pipiGo"
+	coll.Info.Description = fmt.Sprintf("由 pipiGo 导出于 %s，共 %d 个任务", time.Now().Format(time.DateTime), len(list))
+	coll.Info.Schema = postmanSchema
+	coll.Item = []postmanItem{}
+
+	names := make(map[int]string)
+	for _, p := range projects {
+		names[p.ID] = p.Name
+	}
+	folders := make(map[int]int) // 项目ID -> 文件夹在 coll.Item 中的下标
+	for _, t := range list {
+		item := postmanTaskItem(t)
+		if t.ProjectID == nil || names[*t.ProjectID] == "" {
+			coll.Item = append(coll.Item, item)
+			continue
+		}
+		i, ok := folders[*t.ProjectID]
+		if !ok {
+			coll.Item = append(coll.Item, postmanItem{Name: names[*t.ProjectID]})
+			i = len(coll.Item) - 1
+			folders[*t.ProjectID] = i
+		}
+		coll.Item[i].Item = append(coll.Item[i].Item, item)
+	}
+	return coll
+}
+
+// postmanTaskItem 将一个任务转换为集合中的请求，执行计划写在请求说明的第一行
+func postmanTaskItem(t Task) postmanItem {
+	desc := describeSchedule(&t)
+	if t.CronExpr != "" {
+		desc = fmt.Sprintf("Cron: `%s` (%s)", t.CronExpr, desc)
+	}
+	if t.Description != "" {
+		desc += "\n\n" + t.Description
+	}
+	rawURL, _ := json.Marshal(t.URL)
+	rawDesc, _ := json.Marshal(desc)
+	req := &postmanRequest{Method: t.Method, URL: rawURL, Header: []postmanKeyValue{}}
+	if req.Method == "" {
+		req.Method = "GET"
+	}
+
+	var headers map[string]string
+	if json.Unmarshal([]byte(t.Headers), &headers) == nil {
+		keys := make([]string, 0, len(headers))
+		for k := range headers {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			req.Header = append(req.Header, postmanKeyValue{Key: k, Value: headers[k]})
+		}
+	}
+
+	if methodHasBody(req.Method) && t.Body != "" {
+		switch t.BodyType {
+		case bodyTypeForm:
+			req.Body = &postmanBody{Mode: "urlencoded", URLEncoded: postmanFormDecode(t.Body)}
+		case bodyTypeRaw:
+			req.Body = &postmanBody{Mode: "raw", Raw: t.Body, Options: &postmanBodyOptions{}}
+			req.Body.Options.Raw.Language = "text"
+		default:
+			req.Body = &postmanBody{Mode: "raw", Raw: t.Body, Options: &postmanBodyOptions{}}
+			req.Body.Options.Raw.Language = "json"
+		}
+	}
+	return postmanItem{Name: t.Name, Request: req, Description: rawDesc}
+}
+
+// postmanFormDecode 将 a=1&b=2 形式的表单请求体拆分为字段，保留原有顺序
+func postmanFormDecode(body string) []postmanKeyValue {
+	var fields []postmanKeyValue
+	for _, pair := range strings.Split(body, "&") {
+		if pair == "" {
+			continue
+		}
+		key, value, _ := strings.Cut(pair, "=")
+		if k, err := url.QueryUnescape(key); err == nil {
+			key = k
+		}
+		if v, err := url.QueryUnescape(value); err == nil {
+			value = v
+		}
+		fields = append(fields, postmanKeyValue{Key: key, Value: value})
+	}
+	return fields
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Project 定义了一个项目，用于对任务分组
+type Project struct {
+	ID          int       `json:"id" gorm:"primaryKey"`
+	Name        string    `json:"name" gorm:"uniqueIndex;size:191"`
+	Description string    `json:"description"`
+	CreatedAt   time.Time `json:"created_at"`
+	TaskCount   int64     `json:"task_count" gorm:"-"` // 项目下的任务数量，仅用于展示
+}
+
+// validateProject 校验项目名称
+func validateProject(p *Project) error {
+	p.Name = strings.TrimSpace(p.Name)
+	if p.Name == "" {
+		return errors.New("项目名称是必填项")
+	}
+	return nil
+}
+
+// validateTaskProject 检查任务所属的项目是否存在
+func validateTaskProject(t *Task) error {
+	if t.ProjectID == nil {
+		return nil
+	}
+	var count int64
+	db.Model(&Project{}).Where("id = ?", *t.ProjectID).Count(&count)
+	if count == 0 {
+		return fmt.Errorf("项目不存在: #%d", *t.ProjectID)
+	}
+	return nil
+}
+
+// registerProjectRoutes 注册项目的增删改查接口
+func registerProjectRoutes(r gin.IRoutes) {
+	// 获取所有项目及其任务数量
+	r.GET("/api/projects", func(ctx *gin.Context) {
+		var list []Project
+		readDB.Order("name").Find(&list)
+		for i := range list {
+			readDB.Model(&Task{}).Where("project_id = ?", list[i].ID).Count(&list[i].TaskCount)
+		}
+		ctx.JSON(http.StatusOK, list)
+	})
+
+	// 添加项目
+	r.POST("/api/projects", func(ctx *gin.Context) {
+		var req Project
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		req.ID = 0
+		if err := validateProject(&req); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err := db.Create(&req).Error; err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "保存项目失败，名称可能已存在: " + err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusOK, req)
+	})
+
+	// 修改项目名称和说明
+	r.PUT("/api/projects/:id", func(ctx *gin.Context) {
+		var project Project
+		if err := db.First(&project, ctx.Param("id")).Error; err != nil {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "项目不存在"})
+			return
+		}
+		var req Project
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err := validateProject(&req); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		project.Name, project.Description = req.Name, req.Description
+		if err := db.Save(&project).Error; err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "保存项目失败，名称可能已存在: " + err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusOK, project)
+	})
+
+	// 删除项目。项目下还有任务时默认拒绝删除，指定 cascade=true 时连同任务一起删除
+	r.DELETE("/api/projects/:id", func(ctx *gin.Context) {
+		var project Project
+		if err := db.First(&project, ctx.Param("id")).Error; err != nil {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "项目不存在"})
+			return
+		}
+		var list []Task
+		db.Where("project_id = ?", project.ID).Find(&list)
+		if len(list) > 0 && ctx.Query("cascade") != "true" {
+			ctx.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("项目下还有 %d 个任务，请先移除任务或使用 cascade=true 一并删除", len(list))})
+			return
+		}
+		for _, t := range list {
+			if !canAccess(ctx, &t) {
+				ctx.JSON(http.StatusForbidden, gin.H{"error": "项目下有其他用户的任务，只有管理员可以一并删除"})
+				return
+			}
+		}
+		for _, t := range list {
+			deleteTask(t)
+		}
+		db.Delete(&project)
+		ctx.JSON(http.StatusOK, gin.H{"message": "项目已删除", "deleted_tasks": len(list)})
+	})
+
+	// 获取项目下的任务
+	r.GET("/api/projects/:id/tasks", func(ctx *gin.Context) {
+		var project Project
+		if err := readDB.First(&project, ctx.Param("id")).Error; err != nil {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "项目不存在"})
+			return
+		}
+		var list []Task
+		readDB.Scopes(ownedTasks(ctx)).Where("project_id = ?", project.ID).Order("pinned DESC").Order("id DESC").Find(&list)
+		for i := range list {
+			list[i].CronDescription = describeSchedule(&list[i])
+			list[i] = maskTask(list[i])
+		}
+		ctx.JSON(http.StatusOK, list)
+	})
+}
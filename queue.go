@@ -0,0 +1,112 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// queuedRun 是一个因达到全局并发上限 (PIPIGO_MAX_CONCURRENCY) 而在内存中排队等待的请求
+type queuedRun struct {
+	ID         string    `json:"id"`
+	TaskID     int       `json:"task_id"`
+	Name       string    `json:"name"`
+	URL        string    `json:"url"`
+	Reason     string    `json:"reason"`
+	EnqueuedAt time.Time `json:"enqueued_at"`
+
+	ownerID   int
+	cancelled chan struct{} // 被清除时关闭，等待中的请求放弃执行
+}
+
+var (
+	runQueue      = make(map[string]*queuedRun)
+	runQueueMutex sync.Mutex
+)
+
+// acquireSlot 获取一个并发名额，没有空闲名额时加入等待队列，直到获得名额或被清除。
+// 返回 false 表示排队期间被清除，调用方不应发出请求。
+func acquireSlot(t *Task) bool {
+	select {
+	case requestSlots <- struct{}{}:
+		return true
+	default:
+	}
+
+	q := &queuedRun{
+		ID:         newRequestID(),
+		TaskID:     t.ID,
+		Name:       t.Name,
+		URL:        t.URL,
+		Reason:     "等待并发名额",
+		EnqueuedAt: time.Now(),
+		ownerID:    t.OwnerID,
+		cancelled:  make(chan struct{}),
+	}
+	runQueueMutex.Lock()
+	runQueue[q.ID] = q
+	runQueueMutex.Unlock()
+	defer func() {
+		runQueueMutex.Lock()
+		delete(runQueue, q.ID)
+		runQueueMutex.Unlock()
+	}()
+
+	select {
+	case requestSlots <- struct{}{}:
+		return true
+	case <-q.cancelled:
+		return false
+	}
+}
+
+// queuedRuns 返回当前排队中的请求，按入队时间排序
+func queuedRuns() []*queuedRun {
+	runQueueMutex.Lock()
+	defer runQueueMutex.Unlock()
+	list := make([]*queuedRun, 0, len(runQueue))
+	for _, q := range runQueue {
+		list = append(list, q)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].EnqueuedAt.Before(list[j].EnqueuedAt) })
+	return list
+}
+
+// clearQueue 清除所有排队中的请求，返回清除的数量。被清除的请求不再发出，本次执行记录为跳过。
+func clearQueue() int {
+	runQueueMutex.Lock()
+	defer runQueueMutex.Unlock()
+	n := len(runQueue)
+	for id, q := range runQueue {
+		close(q.cancelled)
+		delete(runQueue, id)
+	}
+	return n
+}
+
+// registerQueueRoutes 注册排队请求的查看和清除接口
+func registerQueueRoutes(r gin.IRoutes) {
+	// 查看排队中的请求，普通用户只能看到自己的任务
+	r.GET("/api/queue", func(ctx *gin.Context) {
+		user := currentUser(ctx)
+		list := []*queuedRun{}
+		for _, q := range queuedRuns() {
+			if user == nil || user.IsAdmin || q.ownerID == user.ID {
+				list = append(list, q)
+			}
+		}
+		ctx.JSON(http.StatusOK, gin.H{
+			"max_concurrency": maxConcurrency,
+			"running":         len(requestSlots),
+			"queued":          list,
+		})
+	})
+
+	// 放弃所有排队中的请求，例如并发名额长时间被慢请求占满时清理积压
+	r.DELETE("/api/queue", requireAdmin, func(ctx *gin.Context) {
+		ctx.JSON(http.StatusOK, gin.H{"cleared": clearQueue()})
+	})
+}
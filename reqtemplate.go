@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// requestTemplateData 是请求模板中可以访问的数据，同一次执行的所有地址和重试使用相同的时间
+type requestTemplateData struct {
+	TaskID   int
+	TaskName string
+	Now      time.Time
+}
+
+// Date 按 Go 的时间格式输出执行时间，例如 {{.Date "2006-01-02"}}
+func (d requestTemplateData) Date(layout string) string {
+	return d.Now.Format(layout)
+}
+
+// Unix 返回秒级 Unix 时间戳
+func (d requestTemplateData) Unix() int64 {
+	return d.Now.Unix()
+}
+
+// UnixMs 返回毫秒级 Unix 时间戳
+func (d requestTemplateData) UnixMs() int64 {
+	return d.Now.UnixMilli()
+}
+
+// requestTemplateFuncs 是请求模板中可以使用的函数
+var requestTemplateFuncs = template.FuncMap{
+	// env 读取服务端的环境变量，用于避免把令牌等凭据保存在任务中。需要开启 PIPIGO_ALLOW_SCRIPTS，
+	// 且不能读取 pipiGo 自身的配置 (PIPIGO_ 开头的变量)
+	"env": func(name string) (string, error) {
+		if !allowScripts {
+			return "", errors.New("服务端未开启 PIPIGO_ALLOW_SCRIPTS，不能读取环境变量")
+		}
+		if strings.HasPrefix(name, "PIPIGO_") {
+			return "", fmt.Errorf("不能读取 pipiGo 的配置变量 %s", name)
+		}
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			return "", fmt.Errorf("环境变量 %s 未设置", name)
+		}
+		return value, nil
+	},
+	"upper": strings.ToUpper,
+	"lower": strings.ToLower,
+}
+
+// renderRequestTemplate 渲染一个请求模板，不含 {{ 的文本原样返回
+func renderRequestTemplate(name, text string, data requestTemplateData) (string, error) {
+	if !strings.Contains(text, "{{") {
+		return text, nil
+	}
+	tmpl, err := template.New(name).Funcs(requestTemplateFuncs).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", err
+	}
+	var b bytes.Buffer
+	if err := tmpl.Execute(&b, data); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// renderRequest 返回渲染了地址、请求头和请求体模板的任务副本，未启用请求模板的任务原样返回。
+// 请求头逐个渲染值，避免渲染结果中的引号破坏 JSON
+func renderRequest(t *Task, now time.Time) (*Task, error) {
+	if !t.Templated {
+		return t, nil
+	}
+	// 去掉单调时钟读数，{{.Now}} 只输出墙上时间
+	data := requestTemplateData{TaskID: t.ID, TaskName: t.Name, Now: now.Round(0)}
+	override := *t
+	var err error
+	if override.URL, err = renderRequestTemplate("URL", t.URL, data); err != nil {
+		return nil, fmt.Errorf("渲染 URL 失败: %v", err)
+	}
+	override.URLs = make([]string, len(t.URLs))
+	for i, u := range t.URLs {
+		if override.URLs[i], err = renderRequestTemplate("URL", u, data); err != nil {
+			return nil, fmt.Errorf("渲染地址 %s 失败: %v", u, err)
+		}
+	}
+	if override.Body, err = renderRequestTemplate("Body", t.Body, data); err != nil {
+		return nil, fmt.Errorf("渲染请求体失败: %v", err)
+	}
+	if t.Headers != "" {
+		var headers map[string]string
+		if err := json.Unmarshal([]byte(t.Headers), &headers); err != nil {
+			return nil, fmt.Errorf("请求头不是有效的 JSON: %v", err)
+		}
+		for key, value := range headers {
+			if headers[key], err = renderRequestTemplate(key, value, data); err != nil {
+				return nil, fmt.Errorf("渲染请求头 %s 失败: %v", key, err)
+			}
+		}
+		b, _ := json.Marshal(headers)
+		override.Headers = string(b)
+	}
+	return &override, nil
+}
+
+// validateRequestTemplates 用当前时间试渲染任务的请求模板，在保存时发现语法错误和无法读取的环境变量
+func validateRequestTemplates(t *Task) error {
+	if !t.Templated {
+		return nil
+	}
+	if _, err := renderRequest(t, time.Now()); err != nil {
+		return fmt.Errorf("请求模板错误: %v", err)
+	}
+	return nil
+}
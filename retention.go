@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// 日志清理配置。logRetentionDays 是日志的默认保留天数，任务可以通过 RetentionDays 单独设置；
+// logMaxPerTask 是每个任务最多保留的日志条数。设置为0表示不限制。清理每 logPruneInterval 执行一次，默认每天一次
+var (
+	logRetentionDays = envInt("PIPIGO_LOG_RETENTION_DAYS", 0)
+	logMaxPerTask    = envInt("PIPIGO_LOG_MAX_PER_TASK", 0)
+	logPruneInterval = envDuration("PIPIGO_LOG_PRUNE_INTERVAL", 24*time.Hour)
+)
+
+// retentionDays 返回任务日志实际使用的保留天数，为0表示永久保留
+func retentionDays(t *Task) int {
+	if t.RetentionDays > 0 {
+		return t.RetentionDays
+	}
+	return logRetentionDays
+}
+
+// pruneLogs 按每个任务的保留天数和保留条数删除过期的日志
+func pruneLogs() {
+	var list []Task
+	db.Select("id", "name", "retention_days").Find(&list)
+	now := time.Now()
+	var total int64
+	for i := range list {
+		t := &list[i]
+		cutoff := pruneCutoff(t, now)
+		if cutoff.IsZero() {
+			continue
+		}
+		n, err := pruneTaskLogs(t.ID, cutoff)
+		if err != nil {
+			fmt.Printf("清理任务 #%d (%s) 的过期日志失败: %v\n", t.ID, t.Name, err)
+			continue
+		}
+		total += n
+	}
+	if total > 0 {
+		fmt.Printf("日志清理完成，共删除 %d 条日志\n", total)
+	}
+}
+
+// pruneCutoff 返回任务日志的清理时间点，早于该时间的日志会被删除，返回零值表示不需要清理。
+// 超过保留条数时，时间点为最近第 logMaxPerTask 条日志的时间 (与其同一时间的日志也会保留)。
+func pruneCutoff(t *Task, now time.Time) time.Time {
+	var cutoff time.Time
+	if days := retentionDays(t); days > 0 {
+		cutoff = now.AddDate(0, 0, -days)
+	}
+	if logMaxPerTask > 0 {
+		var nth Log
+		if db.Select("time").Where("task_id = ?", t.ID).Order("time DESC, id DESC").
+			Offset(logMaxPerTask-1).Take(&nth).Error == nil && nth.Time.After(cutoff) {
+			cutoff = nth.Time
+		}
+	}
+	return cutoff
+}
+
+// pruneTaskLogs 删除任务在 cutoff 之前的日志，返回删除的数量。
+// 保留的日志通过哈希引用或失败采样引用了被删除日志的响应体时，先把响应体转移到最早的引用日志上，保证仍可查看。
+func pruneTaskLogs(taskID int, cutoff time.Time) (int64, error) {
+	// 只有保存在外部存储中的响应体需要逐条删除，其余日志直接按条件批量删除
+	var old []Log
+	if bodyBackend != nil {
+		if err := db.Select("id", "response_body").
+			Where("task_id = ? AND time < ? AND response_body LIKE ? AND response_body NOT LIKE ?",
+				taskID, cutoff, bodyRefPrefix+"%", hashRefPrefix+"%").Find(&old).Error; err != nil {
+			return 0, err
+		}
+	}
+	moved := make(map[int]bool) // 响应体已转移给保留日志的被删除日志，其外部存储不删除
+
+	// 失败采样：引用被删除样本的保留日志中，最早的一条接管样本的响应体 (可能是哈希引用，随后一并处理)，其余改为引用它
+	var samples []int
+	db.Model(&Log{}).Distinct("sample_of_id").
+		Where("task_id = ? AND time >= ? AND sample_of_id IN (?)", taskID, cutoff,
+			db.Model(&Log{}).Select("id").Where("task_id = ? AND time < ?", taskID, cutoff)).
+		Pluck("sample_of_id", &samples)
+	for _, sampleID := range samples {
+		var sample, heir Log
+		if db.First(&sample, sampleID).Error != nil ||
+			db.Where("task_id = ? AND time >= ? AND sample_of_id = ?", taskID, cutoff, sampleID).Order("id").First(&heir).Error != nil {
+			continue
+		}
+		db.Model(&heir).Updates(map[string]any{"response_body": sample.ResponseBody, "body_hash": sample.BodyHash, "sample_of_id": 0})
+		db.Model(&Log{}).Where("task_id = ? AND time >= ? AND sample_of_id = ?", taskID, cutoff, sampleID).Update("sample_of_id", heir.ID)
+		replaceFailureSample(taskID, sampleID, heir.ID)
+		moved[sampleID] = true
+	}
+
+	// 哈希引用：保留的日志中不再有该哈希的完整响应体时，把被删除的最新一份转移过来
+	var hashes []string
+	db.Model(&Log{}).Distinct("body_hash").
+		Where("task_id = ? AND time >= ? AND response_body LIKE ?", taskID, cutoff, hashRefPrefix+"%").
+		Pluck("body_hash", &hashes)
+	for _, hash := range hashes {
+		var kept int64
+		db.Model(&Log{}).Where("task_id = ? AND time >= ? AND body_hash = ? AND response_body NOT LIKE ?",
+			taskID, cutoff, hash, hashRefPrefix+"%").Count(&kept)
+		if kept > 0 {
+			continue
+		}
+		var original, ref Log
+		if db.Where("task_id = ? AND time < ? AND body_hash = ? AND response_body NOT LIKE ?",
+			taskID, cutoff, hash, hashRefPrefix+"%").Order("id DESC").First(&original).Error != nil {
+			continue
+		}
+		db.Where("task_id = ? AND time >= ? AND body_hash = ?", taskID, cutoff, hash).Order("id").First(&ref)
+		db.Model(&ref).Update("response_body", original.ResponseBody)
+		moved[original.ID] = true
+	}
+
+	var stored []Log
+	for _, l := range old {
+		if !moved[l.ID] {
+			stored = append(stored, l)
+		}
+	}
+	deleteBodies(stored)
+	result := db.Where("task_id = ? AND time < ?", taskID, cutoff).Delete(&Log{})
+	return result.RowsAffected, result.Error
+}
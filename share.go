@@ -0,0 +1,238 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ShareLink 是任务的只读分享链接，持有链接的人无需登录即可查看任务状态和最近的日志。
+// 令牌只在创建时返回一次，数据库中只保存令牌的 SHA-256，删除记录即撤销链接
+type ShareLink struct {
+	ID        int       `json:"id" gorm:"primaryKey"`
+	TaskID    int       `json:"task_id" gorm:"index"`
+	TokenHash string    `json:"-" gorm:"uniqueIndex;size:64"`
+	Note      string    `json:"note"`      // 分享对象等备注，仅用于管理链接
+	ExpireAt  time.Time `json:"expire_at"` // 过期时间，零值表示永不过期
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// sharedTask 是分享页面中展示的任务信息，不包含地址、请求头、请求体等可能带有凭据的配置
+type sharedTask struct {
+	Name            string    `json:"name"`
+	Description     string    `json:"description"`
+	Enabled         bool      `json:"enabled"`
+	CronExpr        string    `json:"cron,omitempty"`
+	CronDescription string    `json:"cron_description,omitempty"`
+	IntervalSeconds int       `json:"interval_seconds,omitempty"`
+	Timezone        string    `json:"timezone,omitempty"`
+	NextRun         time.Time `json:"next_run"`
+}
+
+// sharedLog 是分享页面中展示的一条日志，不包含响应体，状态说明中的地址会被隐藏
+type sharedLog struct {
+	Time       time.Time `json:"time"`
+	Success    bool      `json:"success"`
+	Skipped    bool      `json:"skipped"`
+	StatusText string    `json:"status_text"`
+	DurationMs int64     `json:"duration_ms"`
+	Trigger    string    `json:"trigger"`
+}
+
+// statusURLPattern 匹配状态说明中的完整地址，例如请求错误中带引号的请求地址和重定向的 Location
+var statusURLPattern = regexp.MustCompile(`[a-zA-Z][a-zA-Z0-9+.-]*://[^\s"'<>]+`)
+
+// redactURLs 隐藏状态说明中的地址，地址的查询参数中可能带有令牌等凭据
+func redactURLs(s string) string {
+	return statusURLPattern.ReplaceAllString(s, "(地址已隐藏)")
+}
+
+// hashShareToken 返回令牌的 SHA-256，用于保存和查找分享链接
+func hashShareToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// findShareLink 查找令牌对应的未过期分享链接
+func findShareLink(token string) (ShareLink, bool) {
+	var link ShareLink
+	if token == "" || readDB.Where("token_hash = ?", hashShareToken(token)).Limit(1).Find(&link).RowsAffected == 0 {
+		return link, false
+	}
+	if !link.ExpireAt.IsZero() && time.Now().After(link.ExpireAt) {
+		return link, false
+	}
+	return link, true
+}
+
+// deleteShareLinks 撤销任务的所有分享链接，在任务被删除时调用
+func deleteShareLinks(taskIDs []int) {
+	db.Where("task_id IN ?", taskIDs).Delete(&ShareLink{})
+}
+
+// registerSharedViewRoutes 注册分享链接的只读页面和接口，需要在 Basic Auth 之前注册，持有链接即可访问
+func registerSharedViewRoutes(r gin.IRoutes) {
+	r.GET("/shared/:token", func(ctx *gin.Context) {
+		ctx.Data(http.StatusOK, "text/html; charset=utf-8", []byte(sharedPage))
+	})
+
+	// 获取分享的任务状态和最近的日志
+	r.GET("/api/shared/:token", func(ctx *gin.Context) {
+		link, ok := findShareLink(ctx.Param("token"))
+		if !ok {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "分享链接不存在、已撤销或已过期"})
+			return
+		}
+		var t Task
+		if readDB.Limit(1).Find(&t, link.TaskID).RowsAffected == 0 {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "分享链接不存在、已撤销或已过期"})
+			return
+		}
+		task := sharedTask{
+			Name:            t.Name,
+			Description:     t.Description,
+			Enabled:         t.Enabled,
+			CronExpr:        t.CronExpr,
+			IntervalSeconds: t.IntervalSeconds,
+			Timezone:        t.Timezone,
+		}
+		taskMutex.Lock()
+		task.NextRun = inTaskZone(&t, nextRun(t.ID))
+		taskMutex.Unlock()
+		if t.IntervalSeconds == 0 {
+			task.CronDescription = describeCron(t.CronExpr)
+		}
+		logs := []sharedLog{}
+		readDB.Model(&Log{}).Where("task_id = ?", t.ID).Order("time DESC").Limit(recentLogLimit).Find(&logs)
+		for i := range logs {
+			logs[i].StatusText = redactURLs(logs[i].StatusText)
+		}
+		ctx.JSON(http.StatusOK, gin.H{"task": task, "logs": logs, "expire_at": link.ExpireAt})
+	})
+}
+
+// registerShareRoutes 注册分享链接的管理接口
+func registerShareRoutes(r gin.IRoutes) {
+	// 列出任务的分享链接 (不包含令牌)
+	r.GET("/api/tasks/:id/shares", func(ctx *gin.Context) {
+		task, ok := findTask(ctx)
+		if !ok {
+			return
+		}
+		list := []ShareLink{}
+		readDB.Where("task_id = ?", task.ID).Order("id DESC").Find(&list)
+		ctx.JSON(http.StatusOK, list)
+	})
+
+	// 创建分享链接，expires_in_hours 为0表示永不过期。令牌和链接只在此时返回
+	r.POST("/api/tasks/:id/shares", func(ctx *gin.Context) {
+		task, ok := findTask(ctx)
+		if !ok {
+			return
+		}
+		var req struct {
+			Note           string `json:"note"`
+			ExpiresInHours int    `json:"expires_in_hours"`
+		}
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if req.ExpiresInHours < 0 {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "有效期不能为负数"})
+			return
+		}
+		b := make([]byte, 32)
+		if _, err := rand.Read(b); err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		token := hex.EncodeToString(b)
+		link := ShareLink{TaskID: task.ID, TokenHash: hashShareToken(token), Note: req.Note}
+		if req.ExpiresInHours > 0 {
+			link.ExpireAt = time.Now().Add(time.Duration(req.ExpiresInHours) * time.Hour)
+		}
+		if err := db.Create(&link).Error; err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusOK, gin.H{"share": link, "token": token, "url": "/shared/" + token})
+	})
+
+	// 撤销分享链接
+	r.DELETE("/api/tasks/:id/shares/:shareId", func(ctx *gin.Context) {
+		task, ok := findTask(ctx)
+		if !ok {
+			return
+		}
+		shareID, _ := strconv.Atoi(ctx.Param("shareId"))
+		if db.Where("id = ? AND task_id = ?", shareID, task.ID).Delete(&ShareLink{}).RowsAffected == 0 {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "分享链接不存在"})
+			return
+		}
+		ctx.JSON(http.StatusOK, gin.H{"message": "分享链接已撤销"})
+	})
+}
+
+// sharedPage 是分享链接的只读页面，不依赖主页面的脚本和登录状态
+const sharedPage = `<!DOCTYPE html>
+<html lang="zh-CN">
+<head>
+<meta charset="UTF-8">
+<meta name="viewport" content="width=device-width, initial-scale=1.0">
+<title>pipiGo - 任务状态</title>
+<style>
+	body { font-family: -apple-system, BlinkMacSystemFont, "Segoe UI", Roboto, sans-serif; max-width: 860px; margin: 0 auto; padding: 20px; color: #333; background: #f5f7fa; }
+	.card { background: #fff; border-radius: 8px; padding: 20px; margin-bottom: 16px; box-shadow: 0 1px 3px rgba(0,0,0,0.08); }
+	h1 { font-size: 22px; margin: 0 0 8px; }
+	.muted { color: #888; font-size: 13px; }
+	.ok { color: #2e7d32; }
+	.fail { color: #c62828; }
+	table { width: 100%; border-collapse: collapse; font-size: 14px; }
+	th, td { text-align: left; padding: 6px 8px; border-bottom: 1px solid #eee; }
+</style>
+</head>
+<body>
+<div id="app"><div class="card">加载中...</div></div>
+<script>
+	const token = location.pathname.split('/').pop()
+	const app = document.getElementById('app')
+	const esc = s => String(s ?? '').replace(/[&<>"']/g, c => ({ '&': '&amp;', '<': '&lt;', '>': '&gt;', '"': '&quot;', "'": '&#39;' }[c]))
+	const fmt = t => !t || t.startsWith('0001-') ? '-' : new Date(t).toLocaleString()
+	fetch('/api/shared/' + encodeURIComponent(token))
+		.then(res => res.json().then(data => ({ ok: res.ok, data })))
+		.then(({ ok, data }) => {
+			if (!ok) {
+				app.innerHTML = '<div class="card fail">' + esc(data.error) + '</div>'
+				return
+			}
+			const t = data.task
+			const last = data.logs[0]
+			const schedule = t.interval_seconds ? '上次执行完成后 ' + t.interval_seconds + ' 秒' : esc(t.cron) + (t.cron_description ? ' (' + esc(t.cron_description) + ')' : '')
+			let html = '<div class="card"><h1>' + esc(t.name) + '</h1>'
+			if (t.description) {
+				html += '<p>' + esc(t.description) + '</p>'
+			}
+			html += '<div>当前状态: ' + (last ? (last.success ? '<strong class="ok">正常</strong>' : '<strong class="fail">失败</strong>') : '暂无执行记录') + (t.enabled ? '' : ' (已禁用)') + '</div>'
+			html += '<div>执行计划: ' + schedule + (t.timezone ? ' [' + esc(t.timezone) + ']' : '') + '</div>'
+			html += '<div>下次执行: ' + fmt(t.next_run) + '</div>'
+			html += '<div class="muted">链接有效期至: ' + (data.expire_at.startsWith('0001-') ? '永久' : fmt(data.expire_at)) + '</div></div>'
+			html += '<div class="card"><table><tr><th>时间</th><th>结果</th><th>状态</th><th>耗时</th></tr>'
+			for (const log of data.logs) {
+				const result = log.skipped ? '跳过' : (log.success ? '<span class="ok">成功</span>' : '<span class="fail">失败</span>')
+				html += '<tr><td>' + fmt(log.time) + '</td><td>' + result + '</td><td>' + esc(log.status_text) + '</td><td>' + log.duration_ms + ' ms</td></tr>'
+			}
+			html += '</table></div>'
+			app.innerHTML = html
+		})
+		.catch(err => { app.innerHTML = '<div class="card fail">加载失败: ' + esc(err.message) + '</div>' })
+</script>
+</body>
+</html>
+`
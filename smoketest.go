@@ -0,0 +1,102 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// smokeTestParallel 是试运行时同时执行的任务数。请求本身仍受 PIPIGO_MAX_CONCURRENCY 的全局并发上限约束
+const smokeTestParallel = 8
+
+// smokeTarget 是试运行中一个地址的结果
+type smokeTarget struct {
+	URL        string `json:"url"`
+	Success    bool   `json:"success"`
+	StatusText string `json:"status_text"`
+	DurationMs int64  `json:"duration_ms"`
+}
+
+// smokeResult 是试运行中一个任务的结果，任一地址失败即视为失败
+type smokeResult struct {
+	TaskID  int           `json:"task_id"`
+	Name    string        `json:"name"`
+	Success bool          `json:"success"`
+	Targets []smokeTarget `json:"targets"`
+}
+
+// smokeTest 将每个任务执行一次并汇总结果，不影响任务的调度、失败计数、熔断和通知。
+// saveLogs 为 true 时把结果写入日志 (触发方式为 smoke)，所有日志使用同一个关联ID
+func smokeTest(list []*Task, correlationID string, saveLogs bool) []smokeResult {
+	results := make([]smokeResult, len(list))
+	slots := make(chan struct{}, smokeTestParallel)
+	var wg sync.WaitGroup
+	for i, t := range list {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			slots <- struct{}{}
+			defer func() { <-slots }()
+
+			override := *t
+			override.correlationID = correlationID
+			entries, ok := executeTask(&override)
+			r := smokeResult{TaskID: t.ID, Name: t.Name, Success: true}
+			for j, entry := range entries {
+				entry.Success = ok[j]
+				r.Success = r.Success && ok[j]
+				r.Targets = append(r.Targets, smokeTarget{URL: entry.URL, Success: ok[j], StatusText: entry.StatusText, DurationMs: entry.DurationMs})
+				if saveLogs {
+					entry.Trigger = triggerSmoke
+					entry.TimeoutSec = t.Timeout
+					entry.CorrelationID = correlationID
+					appendLog(entry)
+				}
+			}
+			results[i] = r
+		}()
+	}
+	wg.Wait()
+	return results
+}
+
+// registerSmokeTestRoutes 注册试运行全部任务的接口
+func registerSmokeTestRoutes(r gin.IRoutes) {
+	// 将当前用户可见的所有已启用 (且未过期) 的任务立即执行一次，等待全部完成后返回每个任务是否成功，
+	// 用于恢复备份或导入任务后确认任务都能正常工作。save_logs=true 时同时写入日志
+	r.POST("/api/tasks/smoke-test", func(ctx *gin.Context) {
+		var ids []int
+		readDB.Model(&Task{}).Scopes(ownedTasks(ctx)).Where("enabled = ?", true).Order("id").Pluck("id", &ids)
+		now := time.Now()
+		var list []*Task
+		taskMutex.Lock()
+		for _, id := range ids {
+			if t, ok := tasks[id]; ok && t.Enabled && !t.isExpired(now) {
+				list = append(list, t)
+			}
+		}
+		taskMutex.Unlock()
+
+		correlationID := newRequestID()
+		started := time.Now()
+		results := smokeTest(list, correlationID, ctx.Query("save_logs") == "true")
+		sort.SliceStable(results, func(i, j int) bool { return !results[i].Success && results[j].Success })
+		passed := 0
+		for _, r := range results {
+			if r.Success {
+				passed++
+			}
+		}
+		ctx.JSON(http.StatusOK, gin.H{
+			"total":          len(results),
+			"passed":         passed,
+			"failed":         len(results) - passed,
+			"duration_ms":    time.Since(started).Milliseconds(),
+			"correlation_id": correlationID,
+			"results":        results,
+		})
+	})
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"math"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// taskStorage 是一个任务的日志占用的存储空间
+type taskStorage struct {
+	TaskID        int    `json:"task_id,omitempty"`
+	Name          string `json:"name,omitempty"`
+	Runs          int64  `json:"runs"`
+	ReceivedBytes int64  `json:"received_bytes"` // 收到的响应体总大小
+	DBBytes       int64  `json:"db_bytes"`       // 保存在数据库中的响应体大小
+	ExternalBytes int64  `json:"external_bytes"` // 保存在外部存储中的响应体大小
+	StoredBytes   int64  `json:"stored_bytes"`   // 实际占用的存储空间 (数据库和外部存储之和)
+}
+
+// largeResponse 是一条响应体较大的日志
+type largeResponse struct {
+	LogID         int       `json:"log_id"`
+	TaskID        int       `json:"task_id"`
+	Name          string    `json:"name"`
+	Time          time.Time `json:"time"`
+	ResponseBytes int64     `json:"response_bytes"`
+}
+
+// runStats 是一个任务 (或所有任务) 的执行统计。成功率和平均耗时只计算实际执行的记录，不包括被跳过的执行
+type runStats struct {
+	TaskID        int       `json:"task_id,omitempty"`
+	Name          string    `json:"name,omitempty"`
+	Runs          int64     `json:"runs"`
+	Successes     int64     `json:"successes"`
+	Failures      int64     `json:"failures"`
+	Skipped       int64     `json:"skipped"`
+	SuccessRate   float64   `json:"success_rate"` // 0 到 1，没有实际执行时为0
+	AvgDurationMs float64   `json:"avg_duration_ms"`
+	LastRun       time.Time `json:"last_run"`
+
+	totalDurationMs int64
+}
+
+// finish 根据累计值计算失败数、成功率和平均耗时
+func (s *runStats) finish() {
+	s.Failures = s.Runs - s.Successes - s.Skipped
+	if executed := s.Successes + s.Failures; executed > 0 {
+		s.SuccessRate = math.Round(float64(s.Successes)/float64(executed)*10000) / 10000
+		s.AvgDurationMs = math.Round(float64(s.totalDurationMs)/float64(executed)*10) / 10
+	}
+}
+
+// storageSizeColumns 按日志计算各类存储占用的 SQL 表达式。
+// 去重后的哈希引用和失败采样省略的响应体不占用空间；早于记录响应体大小的日志按数据库中保存的内容计算。
+func storageSizeColumns() string {
+	// 响应体的字节数 (而不是字符数)
+	bodyBytes := "OCTET_LENGTH(logs.response_body)"
+	if usingSQLite() {
+		bodyBytes = "LENGTH(CAST(logs.response_body AS BLOB))"
+	}
+	return `
+	COUNT(*) AS runs,
+	SUM(CASE WHEN logs.response_bytes > 0 THEN logs.response_bytes
+		WHEN logs.response_body LIKE 'bodyref:%' AND logs.response_body NOT LIKE 'bodyref:inline:%' THEN 0
+		ELSE ` + bodyBytes + ` END) AS received_bytes,
+	SUM(CASE WHEN logs.response_body LIKE 'bodyref:%' AND logs.response_body NOT LIKE 'bodyref:inline:%' THEN 0
+		ELSE ` + bodyBytes + ` END) AS db_bytes,
+	SUM(CASE WHEN logs.response_body LIKE 'bodyref:%' AND logs.response_body NOT LIKE 'bodyref:hash:%'
+		AND logs.response_body NOT LIKE 'bodyref:inline:%'
+		THEN logs.response_bytes ELSE 0 END) AS external_bytes`
+}
+
+// registerStatsRoutes 注册执行统计和存储占用统计的接口
+func registerStatsRoutes(r gin.IRoutes) {
+	// 按任务和全局统计执行次数、成功率、平均耗时和最近一次执行时间，since 为可选的时间窗口 (例如 24h、7d)，
+	// 不指定时统计所有保留的日志。聚合查询按 (task_id, time) 索引过滤和分组
+	r.GET("/api/stats", func(ctx *gin.Context) {
+		q := readDB.Table("logs").
+			Select(`logs.task_id, tasks.name,
+				COUNT(*) AS runs,
+				SUM(CASE WHEN logs.success THEN 1 ELSE 0 END) AS successes,
+				SUM(CASE WHEN logs.skipped THEN 1 ELSE 0 END) AS skipped,
+				SUM(CASE WHEN logs.skipped THEN 0 ELSE logs.duration_ms END) AS total_duration_ms,
+				MAX(logs.id) AS last_log_id`).
+			Joins("JOIN tasks ON tasks.id = logs.task_id").
+			Scopes(ownedTasks(ctx)).
+			Group("logs.task_id, tasks.name").
+			Order("logs.task_id")
+		since := ctx.Query("since")
+		if since != "" {
+			window, err := parseWindow(since)
+			if err != nil {
+				ctx.JSON(http.StatusBadRequest, gin.H{"error": "since 参数无效: " + err.Error()})
+				return
+			}
+			q = q.Where("logs.time >= ?", time.Now().Add(-window))
+		}
+		var rows []struct {
+			TaskID          int
+			Name            string
+			Runs            int64
+			Successes       int64
+			Skipped         int64
+			TotalDurationMs int64
+			LastLogID       int
+		}
+		if err := q.Scan(&rows).Error; err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		// 最近一次执行的时间通过主键读取，MAX(time) 在 SQLite 中返回的是无法直接解析的文本
+		lastIDs := make([]int, len(rows))
+		for i, row := range rows {
+			lastIDs[i] = row.LastLogID
+		}
+		lastRuns := map[int]time.Time{}
+		if len(lastIDs) > 0 {
+			var last []Log
+			readDB.Select("id", "task_id", "time").Where("id IN ?", lastIDs).Find(&last)
+			for _, l := range last {
+				lastRuns[l.TaskID] = l.Time
+			}
+		}
+
+		perTask := make([]runStats, len(rows))
+		var total runStats
+		for i, row := range rows {
+			s := runStats{
+				TaskID:          row.TaskID,
+				Name:            row.Name,
+				Runs:            row.Runs,
+				Successes:       row.Successes,
+				Skipped:         row.Skipped,
+				LastRun:         lastRuns[row.TaskID],
+				totalDurationMs: row.TotalDurationMs,
+			}
+			s.finish()
+			perTask[i] = s
+			total.Runs += s.Runs
+			total.Successes += s.Successes
+			total.Skipped += s.Skipped
+			total.totalDurationMs += s.totalDurationMs
+			if s.LastRun.After(total.LastRun) {
+				total.LastRun = s.LastRun
+			}
+		}
+		total.finish()
+		ctx.JSON(http.StatusOK, gin.H{"since": since, "total": total, "tasks": perTask})
+	})
+
+	// 按任务统计日志占用的存储空间，并列出响应体最大的若干条日志，用于找出应当关闭或限制响应体保存的任务
+	r.GET("/api/stats/storage", func(ctx *gin.Context) {
+		limit, err := strconv.Atoi(ctx.DefaultQuery("limit", "10"))
+		if err != nil || limit <= 0 || limit > 100 {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "limit 参数必须是 1 到 100 之间的整数"})
+			return
+		}
+
+		perTask := []taskStorage{}
+		readDB.Table("logs").
+			Select("logs.task_id, tasks.name, " + storageSizeColumns()).
+			Joins("JOIN tasks ON tasks.id = logs.task_id").
+			Scopes(ownedTasks(ctx)).
+			Group("logs.task_id, tasks.name").
+			Order("logs.task_id").
+			Scan(&perTask)
+
+		var total taskStorage
+		for i := range perTask {
+			s := &perTask[i]
+			s.StoredBytes = s.DBBytes + s.ExternalBytes
+			total.Runs += s.Runs
+			total.ReceivedBytes += s.ReceivedBytes
+			total.DBBytes += s.DBBytes
+			total.ExternalBytes += s.ExternalBytes
+			total.StoredBytes += s.StoredBytes
+		}
+		// 按占用空间从大到小排序 (在内存中排序，不同数据库对 ORDER BY 中引用别名的支持不一致)
+		sort.SliceStable(perTask, func(i, j int) bool { return perTask[i].StoredBytes > perTask[j].StoredBytes })
+
+		largest := []largeResponse{}
+		readDB.Table("logs").
+			Select("logs.id AS log_id, logs.task_id, tasks.name, logs.time, logs.response_bytes").
+			Joins("JOIN tasks ON tasks.id = logs.task_id").
+			Scopes(ownedTasks(ctx)).
+			Where("logs.response_bytes > 0").
+			Order("logs.response_bytes DESC").
+			Limit(limit).
+			Scan(&largest)
+
+		result := gin.H{
+			"total":   total,
+			"tasks":   perTask,
+			"largest": largest,
+		}
+		// 数据库文件本身的大小包括任务、索引和未回收的空间，只对管理员展示
+		if isAdmin(ctx) && usingSQLite() {
+			var size int64
+			for _, path := range []string{dbPath, dbPath + "-wal"} {
+				if stat, err := os.Stat(path); err == nil {
+					size += stat.Size()
+				}
+			}
+			result["database_file_bytes"] = size
+		}
+		ctx.JSON(http.StatusOK, result)
+	})
+}
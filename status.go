@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// statusRange 是视为成功的一段响应状态码，包含两端
+type statusRange struct {
+	from, to int
+}
+
+// parseStatusRanges 解析形如 "200-299,304,418" 的状态码范围列表
+func parseStatusRanges(s string) ([]statusRange, error) {
+	var ranges []statusRange
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		lo, hi, isRange := strings.Cut(part, "-")
+		from, err := strconv.Atoi(strings.TrimSpace(lo))
+		if err != nil {
+			return nil, fmt.Errorf("状态码 %q 不是数字", part)
+		}
+		to := from
+		if isRange {
+			if to, err = strconv.Atoi(strings.TrimSpace(hi)); err != nil {
+				return nil, fmt.Errorf("状态码范围 %q 格式错误", part)
+			}
+		}
+		if from < 100 || to > 599 || from > to {
+			return nil, fmt.Errorf("状态码范围 %q 无效，状态码应在 100 到 599 之间", part)
+		}
+		ranges = append(ranges, statusRange{from: from, to: to})
+	}
+	return ranges, nil
+}
+
+// formatStatusRanges 将状态码范围列表格式化为规范的字符串
+func formatStatusRanges(ranges []statusRange) string {
+	parts := make([]string, len(ranges))
+	for i, r := range ranges {
+		if r.from == r.to {
+			parts[i] = strconv.Itoa(r.from)
+		} else {
+			parts[i] = fmt.Sprintf("%d-%d", r.from, r.to)
+		}
+	}
+	return strings.Join(parts, ",")
+}
+
+// validateStatusRanges 校验任务视为成功的状态码范围，并整理为规范的格式保存
+func validateStatusRanges(t *Task) error {
+	ranges, err := parseStatusRanges(t.SuccessStatusRanges)
+	if err != nil {
+		return fmt.Errorf("成功状态码范围无效: %v", err)
+	}
+	t.SuccessStatusRanges = formatStatusRanges(ranges)
+	return nil
+}
+
+// inStatusRanges 判断状态码是否落在任一范围内
+func inStatusRanges(ranges []statusRange, statusCode int) bool {
+	for _, r := range ranges {
+		if statusCode >= r.from && statusCode <= r.to {
+			return true
+		}
+	}
+	return false
+}
+
+// acceptsRedirect 判断任务是否把某个 3xx 状态码视为成功，此时请求不跟随重定向，以便按重定向本身判断结果
+func acceptsRedirect(t *Task) bool {
+	ranges, _ := parseStatusRanges(effectiveValidators(t)[0].Value)
+	for _, r := range ranges {
+		if r.from <= 399 && r.to >= 300 {
+			return true
+		}
+	}
+	return false
+}
+
+// noRedirect 让 http.Client 直接返回重定向响应而不跟随
+func noRedirect(*http.Request, []*http.Request) error {
+	return http.ErrUseLastResponse
+}
+
+// followsRedirects 判断任务是否跟随重定向，未设置时跟随
+func followsRedirects(t *Task) bool {
+	return t.FollowRedirects == nil || *t.FollowRedirects
+}
+
+// defaultMaxRedirects 是任务未设置 MaxRedirects 时最多跟随的重定向次数，与 http.Client 的默认值相同
+const defaultMaxRedirects = 10
+
+// redirectPolicy 返回任务请求使用的 CheckRedirect。任务关闭了跟随重定向或把 3xx 视为成功时不跟随，
+// 否则最多跟随 MaxRedirects 次
+func redirectPolicy(t *Task) func(*http.Request, []*http.Request) error {
+	if !followsRedirects(t) || acceptsRedirect(t) {
+		return noRedirect
+	}
+	limit := t.MaxRedirects
+	if limit <= 0 {
+		limit = defaultMaxRedirects
+	}
+	return func(req *http.Request, via []*http.Request) error {
+		if len(via) > limit {
+			return fmt.Errorf("重定向超过 %d 次", limit)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,444 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// bodyStore 是响应体的外部存储后端。超过阈值的响应体会写入后端，Log.ResponseBody 中只保留引用。
+type bodyStore interface {
+	// Put 保存响应体，返回可用于 Get 的键
+	Put(key string, body []byte) error
+	Get(key string) ([]byte, error)
+	Delete(key string) error
+	// Name 返回后端名称，写入引用中，用于读取时确认后端一致
+	Name() string
+}
+
+// bodyRefPrefix 是存储在 Log.ResponseBody 中的外部引用前缀，格式为 "bodyref:<后端>:<键>"
+const bodyRefPrefix = "bodyref:"
+
+// 目标服务返回的响应体本身以 bodyRefPrefix 开头时，保存为 "bodyref:inline:<原响应体>"，
+// 避免被当作引用去读取或删除外部存储中的文件
+const (
+	inlineRefName   = "inline"
+	inlineRefPrefix = bodyRefPrefix + inlineRefName + ":"
+)
+
+var (
+	// 外部存储后端，为 nil 表示响应体全部保存在数据库中 (默认)
+	bodyBackend = newBodyStore()
+	// 超过该字节数的响应体才会写入外部存储
+	bodyStoreThreshold = envInt("PIPIGO_BODY_STORE_THRESHOLD", 64*1024)
+)
+
+// bodyContentTypes 是默认保存响应体的 Content-Type 前缀，为空表示全部保存。任务可以通过 BodyContentTypes 单独设置
+var bodyContentTypes = parseContentTypes(os.Getenv("PIPIGO_BODY_CONTENT_TYPES"))
+
+// parseContentTypes 解析逗号分隔的 Content-Type 前缀列表，统一为小写
+func parseContentTypes(s string) []string {
+	var list []string
+	for _, part := range strings.Split(s, ",") {
+		if part = strings.ToLower(strings.TrimSpace(part)); part != "" {
+			list = append(list, part)
+		}
+	}
+	return list
+}
+
+// validateBodyContentTypes 校验并规范任务保存响应体的类型列表
+func validateBodyContentTypes(t *Task) error {
+	list := parseContentTypes(t.BodyContentTypes)
+	for _, prefix := range list {
+		if strings.ContainsAny(prefix, " ;") {
+			return fmt.Errorf("保存响应体的类型 %q 无效，应为 Content-Type 前缀，例如 application/json 或 text/", prefix)
+		}
+	}
+	t.BodyContentTypes = strings.Join(list, ",")
+	return nil
+}
+
+// storedContentType 返回响应的 Content-Type (没有时按内容推断)，以及该类型的响应体是否需要保存
+func storedContentType(t *Task, header http.Header, body []byte) (string, bool) {
+	allowed := bodyContentTypes
+	if t.BodyContentTypes != "" {
+		allowed = parseContentTypes(t.BodyContentTypes)
+	}
+	if len(allowed) == 0 || len(body) == 0 {
+		return "", true
+	}
+	contentType := header.Get("Content-Type")
+	if contentType == "" {
+		contentType = http.DetectContentType(body)
+	}
+	mediaType, _, _ := strings.Cut(contentType, ";")
+	mediaType = strings.ToLower(strings.TrimSpace(mediaType))
+	for _, prefix := range allowed {
+		if prefix == "*" || strings.HasPrefix(mediaType, prefix) {
+			return mediaType, true
+		}
+	}
+	return mediaType, false
+}
+
+// newBodyStore 根据 PIPIGO_BODY_STORE 环境变量创建存储后端: db (默认)、disk 或 s3
+func newBodyStore() bodyStore {
+	switch os.Getenv("PIPIGO_BODY_STORE") {
+	case "", "db":
+		return nil
+	case "disk":
+		dir := os.Getenv("PIPIGO_BODY_STORE_DIR")
+		if dir == "" {
+			dir = "db/bodies"
+		}
+		return &diskStore{dir: dir}
+	case "s3":
+		s := &s3Store{
+			bucket:    os.Getenv("PIPIGO_S3_BUCKET"),
+			region:    os.Getenv("PIPIGO_S3_REGION"),
+			endpoint:  strings.TrimSuffix(os.Getenv("PIPIGO_S3_ENDPOINT"), "/"),
+			accessKey: os.Getenv("PIPIGO_S3_ACCESS_KEY"),
+			secretKey: os.Getenv("PIPIGO_S3_SECRET_KEY"),
+		}
+		if s.region == "" {
+			s.region = "us-east-1"
+		}
+		if s.endpoint == "" {
+			s.endpoint = "https://s3." + s.region + ".amazonaws.com"
+		}
+		if s.bucket == "" {
+			fmt.Println("PIPIGO_BODY_STORE=s3 但未配置 PIPIGO_S3_BUCKET，响应体将继续保存在数据库中")
+			return nil
+		}
+		return s
+	default:
+		fmt.Printf("未知的响应体存储后端 %q，响应体将继续保存在数据库中\n", os.Getenv("PIPIGO_BODY_STORE"))
+		return nil
+	}
+}
+
+// envInt 从环境变量读取整数配置，未设置或格式错误时使用默认值
+func envInt(name string, def int) int {
+	v := os.Getenv(name)
+	if v == "" {
+		return def
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		fmt.Printf("环境变量 %s 格式错误，使用默认值 %d: %v\n", name, def, err)
+		return def
+	}
+	return n
+}
+
+// offloadBody 将超过阈值的响应体写入外部存储，并把 ResponseBody 替换为引用。写入失败时保留原响应体。
+func offloadBody(log *Log) {
+	if bodyBackend == nil || len(log.ResponseBody) <= bodyStoreThreshold {
+		return
+	}
+	key := fmt.Sprintf("%d/%s", log.TaskID, newRequestID())
+	if err := bodyBackend.Put(key, []byte(log.ResponseBody)); err != nil {
+		fmt.Printf("任务 #%d 写入响应体存储失败，改为保存在数据库中: %v\n", log.TaskID, err)
+		return
+	}
+	log.ResponseBody = bodyRefPrefix + bodyBackend.Name() + ":" + key
+}
+
+// isBodyRef 判断 ResponseBody 是否为外部存储的引用
+func isBodyRef(body string) bool {
+	return strings.HasPrefix(body, bodyRefPrefix)
+}
+
+// escapeBody 转义以引用前缀开头的真实响应体，在写入日志前调用
+func escapeBody(log *Log) {
+	if isBodyRef(log.ResponseBody) {
+		log.ResponseBody = inlineRefPrefix + log.ResponseBody
+	}
+}
+
+// inlineBody 返回保存在数据库中的响应体，外部存储或哈希引用的响应体返回 false
+func inlineBody(body string) (string, bool) {
+	if strings.HasPrefix(body, inlineRefPrefix) {
+		return strings.TrimPrefix(body, inlineRefPrefix), true
+	}
+	return body, !isBodyRef(body)
+}
+
+// loadBody 返回日志的完整响应体，必要时从外部存储或与之相同的日志中读取
+func loadBody(log *Log) ([]byte, error) {
+	if body, ok := inlineBody(log.ResponseBody); ok {
+		return []byte(body), nil
+	}
+	name, key, _ := strings.Cut(strings.TrimPrefix(log.ResponseBody, bodyRefPrefix), ":")
+	if name == hashRefName {
+		var original Log
+		err := readDB.Where("task_id = ? AND body_hash = ? AND response_body NOT LIKE ?", log.TaskID, key, hashRefPrefix+"%").
+			Order("id DESC").First(&original).Error
+		if err != nil {
+			return nil, errors.New("与该响应体相同的日志已不存在")
+		}
+		return loadBody(&original)
+	}
+	if bodyBackend == nil || bodyBackend.Name() != name {
+		return nil, fmt.Errorf("响应体保存在 %s 存储中，但当前未启用该存储后端", name)
+	}
+	return bodyBackend.Get(key)
+}
+
+// deleteBodies 删除一批日志在外部存储中的响应体，在删除任务时调用
+func deleteBodies(logs []Log) {
+	for _, l := range logs {
+		if !isBodyRef(l.ResponseBody) || bodyBackend == nil {
+			continue
+		}
+		name, key, _ := strings.Cut(strings.TrimPrefix(l.ResponseBody, bodyRefPrefix), ":")
+		if name != bodyBackend.Name() {
+			continue
+		}
+		if err := bodyBackend.Delete(key); err != nil {
+			fmt.Printf("删除响应体 %s 失败: %v\n", key, err)
+		}
+	}
+}
+
+// 响应体去重：与同一任务 (同一地址) 上一次的响应体完全相同时，日志中只保存 "bodyref:hash:<sha256>" 引用，
+// 读取时按哈希找到保存了完整响应体的日志
+const (
+	hashRefName   = "hash"
+	hashRefPrefix = bodyRefPrefix + hashRefName + ":"
+)
+
+// bodyHashKey 标识一个任务的一个请求地址
+type bodyHashKey struct {
+	taskID int
+	url    string
+}
+
+var (
+	lastBodyHashes = make(map[bodyHashKey]string)
+	bodyHashMutex  sync.Mutex
+)
+
+// dedupeBody 计算响应体的哈希，与上一次相同时把响应体替换为哈希引用
+func dedupeBody(log *Log) {
+	if log.ResponseBody == "" || isBodyRef(log.ResponseBody) {
+		return
+	}
+	log.BodyHash = sha256Hex([]byte(log.ResponseBody))
+	key := bodyHashKey{taskID: log.TaskID, url: log.URL}
+	bodyHashMutex.Lock()
+	prev := lastBodyHashes[key]
+	lastBodyHashes[key] = log.BodyHash
+	bodyHashMutex.Unlock()
+	if prev == log.BodyHash {
+		log.ResponseBody = hashRefPrefix + log.BodyHash
+	}
+}
+
+// forgetBodyHash 撤销日志在去重状态中记录的哈希，下一条相同的响应体将完整保存
+func forgetBodyHash(log *Log) {
+	if log.BodyHash == "" {
+		return
+	}
+	key := bodyHashKey{taskID: log.TaskID, url: log.URL}
+	bodyHashMutex.Lock()
+	if lastBodyHashes[key] == log.BodyHash {
+		delete(lastBodyHashes, key)
+	}
+	bodyHashMutex.Unlock()
+}
+
+// clearBodyHashes 清除任务的响应体去重状态，在任务被删除时调用
+func clearBodyHashes(id int) {
+	bodyHashMutex.Lock()
+	for key := range lastBodyHashes {
+		if key.taskID == id {
+			delete(lastBodyHashes, key)
+		}
+	}
+	bodyHashMutex.Unlock()
+}
+
+// failureSample 记录任务当前失败区间中完整保存了响应体的那条失败日志
+type failureSample struct {
+	url      string // 任务扇出到多个地址时，只与同一地址的失败比较
+	logID    int
+	status   string
+	bodyHash string
+}
+
+var (
+	failureSamples     = make(map[int]*failureSample)
+	failureSampleMutex sync.Mutex
+)
+
+// sampleFailure 对开启了失败采样的任务，如果本次失败与当前样本的状态和响应体都相同，则省略响应体并引用样本日志。
+// 成功或失败内容变化时重新开始采样，返回 true 表示本次日志将作为新的样本，写入后需调用 setFailureSample。
+func sampleFailure(t *Task, entry *Log, success bool) bool {
+	failureSampleMutex.Lock()
+	defer failureSampleMutex.Unlock()
+	if success || !t.SampleFailures {
+		delete(failureSamples, t.ID)
+		return false
+	}
+	hash := sha256Hex([]byte(entry.ResponseBody))
+	if s, ok := failureSamples[t.ID]; ok && s.logID != 0 && s.url == entry.URL && s.status == entry.StatusText && s.bodyHash == hash {
+		entry.ResponseBody = ""
+		entry.SampleOfID = s.logID
+		return false
+	}
+	failureSamples[t.ID] = &failureSample{url: entry.URL, status: entry.StatusText, bodyHash: hash}
+	return true
+}
+
+// setFailureSample 在样本日志写入数据库后记录其ID
+func setFailureSample(taskID, logID int) {
+	failureSampleMutex.Lock()
+	if s, ok := failureSamples[taskID]; ok {
+		s.logID = logID
+	}
+	failureSampleMutex.Unlock()
+}
+
+// replaceFailureSample 样本日志被清理、响应体转移到另一条日志后，让后续的失败改为引用新的日志
+func replaceFailureSample(taskID, oldID, newID int) {
+	failureSampleMutex.Lock()
+	if s, ok := failureSamples[taskID]; ok && s.logID == oldID {
+		s.logID = newID
+	}
+	failureSampleMutex.Unlock()
+}
+
+// clearFailureSample 清除任务的失败样本，在任务被删除时调用
+func clearFailureSample(id int) {
+	failureSampleMutex.Lock()
+	delete(failureSamples, id)
+	failureSampleMutex.Unlock()
+}
+
+// diskStore 将响应体保存为本地文件
+type diskStore struct {
+	dir string
+}
+
+func (d *diskStore) Name() string { return "disk" }
+
+// path 返回键对应的文件路径，拒绝指向存储目录之外的键
+func (d *diskStore) path(key string) (string, error) {
+	name := filepath.FromSlash(key)
+	if !filepath.IsLocal(name) {
+		return "", fmt.Errorf("无效的响应体存储键: %s", key)
+	}
+	return filepath.Join(d.dir, name), nil
+}
+
+func (d *diskStore) Put(key string, body []byte) error {
+	p, err := d.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(p, body, 0o644)
+}
+
+func (d *diskStore) Get(key string) ([]byte, error) {
+	p, err := d.path(key)
+	if err != nil {
+		return nil, err
+	}
+	return os.ReadFile(p)
+}
+
+func (d *diskStore) Delete(key string) error {
+	p, err := d.path(key)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(p)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// s3Store 将响应体保存到 S3 (或兼容 S3 的对象存储)，使用路径风格的地址和 SigV4 签名
+type s3Store struct {
+	bucket, region, endpoint string
+	accessKey, secretKey     string
+}
+
+var s3Client = &http.Client{Timeout: 30 * time.Second}
+
+func (s *s3Store) Name() string { return "s3" }
+
+func (s *s3Store) Put(key string, body []byte) error {
+	_, err := s.do("PUT", key, body)
+	return err
+}
+
+func (s *s3Store) Get(key string) ([]byte, error) {
+	return s.do("GET", key, nil)
+}
+
+func (s *s3Store) Delete(key string) error {
+	_, err := s.do("DELETE", key, nil)
+	return err
+}
+
+// do 发送一个签名的对象请求，非 2xx 响应视为失败
+func (s *s3Store) do(method, key string, body []byte) ([]byte, error) {
+	u, err := url.Parse(s.endpoint + "/" + s.bucket + "/" + key)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	s.sign(req, body, time.Now().UTC())
+
+	resp, err := s3Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("S3 返回状态: %d, %s", resp.StatusCode, strings.TrimSpace(string(data)))
+	}
+	return data, nil
+}
+
+// sign 按 AWS Signature Version 4 为请求签名
+func (s *s3Store) sign(req *http.Request, body []byte, now time.Time) {
+	signV4(req, body, s.accessKey, s.secretKey, s.region, "s3", now)
+}
+
+func sha256Hex(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
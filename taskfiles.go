@@ -0,0 +1,308 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gopkg.in/yaml.v3"
+)
+
+// 声明式任务配置。设置 PIPIGO_TASKS_DIR 后，从该目录中的 YAML/JSON 文件读取任务定义，
+// 每隔 PIPIGO_TASKS_DIR_INTERVAL 检查一次文件是否变化，变化时将任务调整为与文件一致。
+// 文件中的任务与通过接口创建的任务共存，但只能通过修改文件来变更
+var (
+	tasksDir         = envString("PIPIGO_TASKS_DIR", "")
+	tasksDirInterval = envDuration("PIPIGO_TASKS_DIR_INTERVAL", 10*time.Second)
+)
+
+// taskFileSync 记录最近一次同步任务配置文件的结果
+type taskFileSync struct {
+	Time    time.Time         `json:"time"`
+	Files   int               `json:"files"`
+	Created []string          `json:"created"`
+	Updated []string          `json:"updated"`
+	Deleted []string          `json:"deleted"`
+	Errors  map[string]string `json:"errors"` // 按文件 (或 文件#任务名称) 记录的错误，出错的部分保持上一次同步的状态
+}
+
+var (
+	taskFileMutex       sync.Mutex
+	taskFileFingerprint string
+	lastTaskFileSync    taskFileSync
+)
+
+// taskFileExtensions 是会被读取的任务配置文件扩展名
+var taskFileExtensions = []string{".yaml", ".yml", ".json"}
+
+// readTaskFiles 读取目录中的任务配置文件 (不包括子目录)，返回按文件名排列的文件路径和内容的指纹
+func readTaskFiles(dir string) ([]string, map[string][]byte, string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	var names []string
+	contents := map[string][]byte{}
+	sum := sha256.New()
+	for _, e := range entries {
+		ext := strings.ToLower(filepath.Ext(e.Name()))
+		if e.IsDir() || strings.HasPrefix(e.Name(), ".") || !slices.Contains(taskFileExtensions, ext) {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, e.Name()))
+		if err != nil {
+			return nil, nil, "", err
+		}
+		names = append(names, e.Name())
+		contents[e.Name()] = data
+		fmt.Fprintf(sum, "%s\x00%d\x00", e.Name(), len(data))
+		sum.Write(data)
+	}
+	sort.Strings(names)
+	return names, contents, hex.EncodeToString(sum.Sum(nil)), nil
+}
+
+// parseTaskFile 解析一个任务配置文件，文件内容可以是单个任务或任务列表，字段与创建任务的接口相同。
+// 未指定 enabled 的任务默认启用
+func parseTaskFile(name string, data []byte) ([]Task, error) {
+	var doc any
+	if strings.EqualFold(filepath.Ext(name), ".json") {
+		if err := json.Unmarshal(data, &doc); err != nil {
+			return nil, err
+		}
+	} else if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	var items []any
+	switch v := doc.(type) {
+	case nil:
+		return nil, nil
+	case []any:
+		items = v
+	case map[string]any:
+		items = []any{v}
+	default:
+		return nil, fmt.Errorf("文件内容需要是任务或任务列表")
+	}
+	list := make([]Task, 0, len(items))
+	for i, item := range items {
+		// 通过 JSON 转换，使 YAML 文件中的字段名与接口中的字段名一致
+		raw, err := json.Marshal(item)
+		if err != nil {
+			return nil, fmt.Errorf("第 %d 个任务: %v", i+1, err)
+		}
+		t := Task{Enabled: true}
+		if err := json.Unmarshal(raw, &t); err != nil {
+			return nil, fmt.Errorf("第 %d 个任务: %v", i+1, err)
+		}
+		if strings.TrimSpace(t.Name) == "" {
+			return nil, fmt.Errorf("第 %d 个任务缺少名称 (name)，名称用于识别文件中的任务", i+1)
+		}
+		t.ID = 0
+		t.OwnerID = 0
+		t.Source = name
+		list = append(list, t)
+	}
+	return list, nil
+}
+
+// syncTaskFiles 在任务配置文件发生变化 (或 force 为 true) 时，按文件内容创建、修改和删除任务。
+// 文件中的任务按名称识别，名称在整个目录中必须唯一；解析失败的文件和校验失败的任务保持原状，不会被删除
+func syncTaskFiles(force bool) (taskFileSync, error) {
+	taskFileMutex.Lock()
+	defer taskFileMutex.Unlock()
+
+	names, contents, fingerprint, err := readTaskFiles(tasksDir)
+	if err != nil {
+		return lastTaskFileSync, fmt.Errorf("读取任务配置目录失败: %v", err)
+	}
+	if !force && fingerprint == taskFileFingerprint {
+		return lastTaskFileSync, nil
+	}
+	result := taskFileSync{Time: time.Now(), Files: len(names), Created: []string{}, Updated: []string{}, Deleted: []string{}, Errors: map[string]string{}}
+
+	desired := map[string]Task{}
+	// 出错而保持原状的文件和任务 (按名称)
+	keepFiles := map[string]bool{}
+	keep := map[string]bool{}
+	for _, name := range names {
+		list, err := parseTaskFile(name, contents[name])
+		if err != nil {
+			result.Errors[name] = err.Error()
+			keepFiles[name] = true
+			continue
+		}
+		for _, t := range list {
+			if other, ok := desired[t.Name]; ok {
+				result.Errors[name+"#"+t.Name] = fmt.Sprintf("任务名称与 %s 中的任务重复", other.Source)
+				keep[t.Name] = true
+				continue
+			}
+			desired[t.Name] = t
+		}
+	}
+
+	var existing []Task
+	db.Where("source <> ''").Find(&existing)
+	current := map[string]Task{}
+	for _, t := range existing {
+		current[t.Name] = t
+	}
+
+	for _, name := range sortedKeys(desired) {
+		t := desired[name]
+		if keep[name] {
+			continue
+		}
+		old, ok := current[name]
+		if ok {
+			// 已有任务的 Cron 模板没有变化时沿用保存的表达式，不随每次同步重新计算
+			t.ID = old.ID
+			if err := keepCronTemplate(&t, old); err != nil {
+				result.Errors[t.Source+"#"+name] = err.Error()
+				keep[name] = true
+				continue
+			}
+		}
+		if err := validateTask(&t); err != nil {
+			result.Errors[t.Source+"#"+name] = err.Error()
+			keep[name] = true
+			continue
+		}
+		if !ok {
+			if err := createFileTask(&t); err != nil {
+				result.Errors[t.Source+"#"+name] = err.Error()
+				continue
+			}
+			result.Created = append(result.Created, name)
+			continue
+		}
+		t.OwnerID = old.OwnerID
+		t.Pinned = old.Pinned
+		t.CreatedAt = old.CreatedAt
+		if t.Source == old.Source && reflect.DeepEqual(taskDefinition(t), taskDefinition(old)) {
+			continue
+		}
+		if err := updateFileTask(&t, old); err != nil {
+			result.Errors[t.Source+"#"+name] = err.Error()
+			continue
+		}
+		result.Updated = append(result.Updated, name)
+	}
+
+	var removed []int
+	for _, t := range existing {
+		if _, ok := desired[t.Name]; !ok && !keep[t.Name] && !keepFiles[t.Source] {
+			removed = append(removed, t.ID)
+			result.Deleted = append(result.Deleted, t.Name)
+		}
+	}
+	if len(removed) > 0 {
+		deleteTasks(removed)
+	}
+
+	// 出错的文件修改后才会重新同步，避免每次检查都重复输出同样的错误；也可以通过接口立即重试
+	taskFileFingerprint = fingerprint
+	lastTaskFileSync = result
+	fmt.Printf("同步任务配置文件: 新增 %d 个，修改 %d 个，删除 %d 个，错误 %d 个\n",
+		len(result.Created), len(result.Updated), len(result.Deleted), len(result.Errors))
+	for key, msg := range result.Errors {
+		fmt.Printf("任务配置文件 %s 有误，保持原状: %s\n", key, msg)
+	}
+	return result, nil
+}
+
+// sortedKeys 返回按名称排列的任务名称，使同步结果的顺序稳定
+func sortedKeys(m map[string]Task) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// createFileTask 保存并调度配置文件中新增的任务
+func createFileTask(t *Task) error {
+	if err := insertTask(db, t); err != nil {
+		return err
+	}
+	if err := finalizeCronTemplate(t); err != nil {
+		db.Delete(t)
+		return err
+	}
+	registerTask(t)
+	return nil
+}
+
+// updateFileTask 保存配置文件中修改的任务并重新调度，调度失败时恢复原来的定义
+func updateFileTask(t *Task, old Task) error {
+	if err := db.Save(t).Error; err != nil {
+		return err
+	}
+	if err := rescheduleTask(t); err != nil {
+		db.Save(&old)
+		return err
+	}
+	clearFailureSample(t.ID)
+	clearBodyHashes(t.ID)
+	clearOAuthToken(t.ID)
+	return nil
+}
+
+// scheduledTaskFileSync 是定期检查任务配置文件的系统作业
+func scheduledTaskFileSync() {
+	if _, err := syncTaskFiles(false); err != nil {
+		fmt.Println(err)
+	}
+}
+
+// rejectFileTask 拒绝通过接口修改由配置文件管理的任务，返回 true 表示已拒绝
+func rejectFileTask(ctx *gin.Context, t *Task) bool {
+	if t.Source == "" {
+		return false
+	}
+	ctx.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("任务 %s 由配置文件 %s 管理，请修改配置文件", t.Name, t.Source)})
+	return true
+}
+
+// registerTaskFileRoutes 注册查看和立即同步任务配置文件的接口
+func registerTaskFileRoutes(r gin.IRoutes) {
+	// 查看任务配置目录和最近一次同步的结果
+	r.GET("/api/admin/task-files", requireAdmin, func(ctx *gin.Context) {
+		taskFileMutex.Lock()
+		last := lastTaskFileSync
+		taskFileMutex.Unlock()
+		ctx.JSON(http.StatusOK, gin.H{
+			"enabled":   tasksDir != "",
+			"dir":       tasksDir,
+			"interval":  tasksDirInterval.String(),
+			"last_sync": last,
+		})
+	})
+
+	// 立即同步任务配置文件，例如在 git pull 之后调用，不必等待下一次定期检查
+	r.POST("/api/admin/task-files/sync", requireAdmin, func(ctx *gin.Context) {
+		if tasksDir == "" {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "未配置任务配置目录 (PIPIGO_TASKS_DIR)"})
+			return
+		}
+		result, err := syncTaskFiles(true)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusOK, result)
+	})
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	_ "time/tzdata" // 内置时区数据库，精简的容器镜像中没有系统时区数据时也能加载任务的时区
+)
+
+// validateTimezone 校验任务的时区名称。时区只对 Cron 表达式生效，间隔模式的任务不需要时区
+func validateTimezone(t *Task) error {
+	t.Timezone = strings.TrimSpace(t.Timezone)
+	if t.Timezone == "" {
+		return nil
+	}
+	if _, err := time.LoadLocation(t.Timezone); err != nil {
+		return fmt.Errorf("时区 %q 无效，请使用 IANA 时区名称，例如 Asia/Shanghai 或 UTC", t.Timezone)
+	}
+	if expr := strings.TrimSpace(t.CronExpr); strings.HasPrefix(expr, "CRON_TZ=") || strings.HasPrefix(expr, "TZ=") {
+		return fmt.Errorf("已设置时区 %s，Cron 表达式中不能再用 CRON_TZ= 指定时区", t.Timezone)
+	}
+	return nil
+}
+
+// taskLocation 返回任务的时区，未设置 (或无法加载) 时为服务器的本地时区
+func taskLocation(t *Task) *time.Location {
+	if t.Timezone != "" {
+		if loc, err := time.LoadLocation(t.Timezone); err == nil {
+			return loc
+		}
+	}
+	return time.Local
+}
+
+// cronSpec 返回注册到调度器的表达式：设置了时区时加上 CRON_TZ 前缀，由调度器按该时区计算执行时间
+func cronSpec(t *Task) string {
+	if t.Timezone == "" {
+		return t.CronExpr
+	}
+	return "CRON_TZ=" + t.Timezone + " " + t.CronExpr
+}
+
+// inTaskZone 将时间转换到任务的时区，用于接口返回，零值保持不变
+func inTaskZone(t *Task, at time.Time) time.Time {
+	if at.IsZero() {
+		return at
+	}
+	return at.In(taskLocation(t))
+}
@@ -0,0 +1,307 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	qrcode "github.com/skip2/go-qrcode"
+)
+
+// 两步验证 (TOTP，RFC 6238) 的参数，与常见的验证器应用 (Google Authenticator、1Password 等) 的默认值一致
+const (
+	totpPeriod = 30 // 每个验证码的有效时长 (秒)
+	totpDigits = 6
+	totpSkew   = 1 // 允许前后各偏差一个周期，容忍手机和服务器的时钟误差
+	totpIssuer = "pipiGo"
+)
+
+// 验证码连续错误 PIPIGO_TOTP_MAX_FAILURES 次后，该用户在 PIPIGO_TOTP_LOCKOUT 内不能再提交验证码，防止穷举
+var (
+	totpMaxFailures = envInt("PIPIGO_TOTP_MAX_FAILURES", 5)
+	totpLockout     = envDuration("PIPIGO_TOTP_LOCKOUT", 5*time.Minute)
+)
+
+// errTOTPLocked 表示验证码错误次数过多，暂时不能提交验证码
+var errTOTPLocked = errors.New("两步验证码错误次数过多")
+
+// totpFailure 记录用户连续提交错误验证码的次数和锁定的截止时间
+type totpFailure struct {
+	count       int
+	lockedUntil time.Time
+}
+
+var (
+	totpFailures     = make(map[int]*totpFailure)
+	totpFailureMutex sync.Mutex
+)
+
+// totpKey 是加密保存用户两步验证密钥的密钥，由 PIPIGO_TOTP_KEY 派生，未配置时使用 PIPIGO_JWT_SECRET。
+// 两者都未配置时为 nil，不能开启两步验证 (随机生成的密钥重启后无法解密已保存的密钥)
+var totpKey = loadTOTPKey()
+
+// loadTOTPKey 读取并派生两步验证密钥的加密密钥
+func loadTOTPKey() []byte {
+	secret := os.Getenv("PIPIGO_TOTP_KEY")
+	if secret == "" {
+		secret = os.Getenv("PIPIGO_JWT_SECRET")
+	}
+	if secret == "" {
+		return nil
+	}
+	sum := sha256.Sum256([]byte("pipigo-totp:" + secret))
+	return sum[:]
+}
+
+// encryptTOTPSecret 用 AES-GCM 加密两步验证密钥，返回 base64 编码的 nonce 和密文
+func encryptTOTPSecret(secret []byte) (string, error) {
+	if totpKey == nil {
+		return "", errors.New("服务端未配置 PIPIGO_TOTP_KEY (或 PIPIGO_JWT_SECRET)，无法开启两步验证")
+	}
+	block, err := aes.NewCipher(totpKey)
+	if err != nil {
+		return "", err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(gcm.Seal(nonce, nonce, secret, nil)), nil
+}
+
+// decryptTOTPSecret 解密 encryptTOTPSecret 保存的两步验证密钥
+func decryptTOTPSecret(encrypted string) ([]byte, error) {
+	if totpKey == nil {
+		return nil, errors.New("服务端未配置 PIPIGO_TOTP_KEY (或 PIPIGO_JWT_SECRET)，无法校验两步验证码")
+	}
+	data, err := base64.StdEncoding.DecodeString(encrypted)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(totpKey)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < gcm.NonceSize() {
+		return nil, errors.New("两步验证密钥已损坏")
+	}
+	secret, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], nil)
+	if err != nil {
+		return nil, errors.New("无法解密两步验证密钥，PIPIGO_TOTP_KEY 可能已被修改")
+	}
+	return secret, nil
+}
+
+// totpCode 计算某个时间周期的验证码 (RFC 4226 的 HOTP，计数器为周期序号)
+func totpCode(secret []byte, step int64) string {
+	var counter [8]byte
+	binary.BigEndian.PutUint64(counter[:], uint64(step))
+	mac := hmac.New(sha1.New, secret)
+	mac.Write(counter[:])
+	sum := mac.Sum(nil)
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", totpDigits, value%1000000)
+}
+
+// verifyTOTP 校验验证码，返回匹配的周期序号。lastStep 是该用户上一次使用的周期，
+// 同一周期 (及更早) 的验证码不能重复使用，防止验证码被截获后重放
+func verifyTOTP(secret []byte, code string, lastStep int64, now time.Time) (int64, bool) {
+	code = strings.ReplaceAll(strings.TrimSpace(code), " ", "")
+	if len(code) != totpDigits {
+		return 0, false
+	}
+	current := now.Unix() / totpPeriod
+	for step := current - totpSkew; step <= current+totpSkew; step++ {
+		if step > lastStep && hmac.Equal([]byte(totpCode(secret, step)), []byte(code)) {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+// checkUserTOTP 校验已开启两步验证的用户提交的验证码，通过后记录已使用的周期。
+// 记录周期时以数据库中的值为准做条件更新，同一验证码的并发请求 (包括其他实例) 只有一个能通过。
+// 连续错误次数过多时锁定一段时间，锁定期间直接返回 errTOTPLocked
+func checkUserTOTP(user *User, code string) error {
+	totpFailureMutex.Lock()
+	defer totpFailureMutex.Unlock()
+	f := totpFailures[user.ID]
+	if f != nil && time.Now().Before(f.lockedUntil) {
+		return fmt.Errorf("%w，请在 %s 后重试", errTOTPLocked, time.Until(f.lockedUntil).Round(time.Second))
+	}
+	secret, err := decryptTOTPSecret(user.TOTPSecret)
+	if err != nil {
+		return err
+	}
+	step, ok := verifyTOTP(secret, code, user.TOTPLastStep, time.Now())
+	if ok {
+		res := db.Model(&User{}).Where("id = ? AND totp_last_step < ?", user.ID, step).Update("totp_last_step", step)
+		ok = res.Error == nil && res.RowsAffected == 1
+	}
+	if !ok {
+		if f == nil {
+			f = &totpFailure{}
+			totpFailures[user.ID] = f
+		}
+		f.count++
+		if totpMaxFailures > 0 && f.count >= totpMaxFailures {
+			f.count = 0
+			f.lockedUntil = time.Now().Add(totpLockout)
+			fmt.Printf("用户 %s 两步验证码连续错误 %d 次，锁定 %s\n", user.Username, totpMaxFailures, totpLockout)
+		}
+		return errors.New("两步验证码错误或已使用")
+	}
+	delete(totpFailures, user.ID)
+	user.TOTPLastStep = step
+	return nil
+}
+
+// totpErrorStatus 返回验证码校验失败时的状态码，锁定期间为 429
+func totpErrorStatus(err error, status int) int {
+	if errors.Is(err, errTOTPLocked) {
+		return http.StatusTooManyRequests
+	}
+	return status
+}
+
+// clearTOTPFailures 清除用户的验证码错误记录，在重置两步验证时调用
+func clearTOTPFailures(id int) {
+	totpFailureMutex.Lock()
+	delete(totpFailures, id)
+	totpFailureMutex.Unlock()
+}
+
+// registerTOTPRoutes 注册当前用户开启和关闭两步验证的接口，以及管理员重置用户两步验证的接口
+func registerTOTPRoutes(r gin.IRoutes) {
+	// 生成新的两步验证密钥，返回密钥和二维码，用验证器应用扫描后需要提交一次验证码确认才会生效
+	r.POST("/api/me/totp/enroll", func(ctx *gin.Context) {
+		user := currentUser(ctx)
+		if user == nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "未启用登录认证"})
+			return
+		}
+		if user.TOTPEnabled {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "已开启两步验证，需要先关闭才能重新绑定"})
+			return
+		}
+		secret := make([]byte, 20)
+		if _, err := rand.Read(secret); err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		encrypted, err := encryptTOTPSecret(secret)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		db.Model(user).Updates(map[string]any{"totp_secret": encrypted, "totp_last_step": 0})
+
+		encoded := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(secret)
+		label := url.PathEscape(totpIssuer + ":" + user.Username)
+		uri := fmt.Sprintf("otpauth://totp/%s?secret=%s&issuer=%s&digits=%d&period=%d", label, encoded, totpIssuer, totpDigits, totpPeriod)
+		png, err := qrcode.Encode(uri, qrcode.Medium, 256)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "生成二维码失败: " + err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusOK, gin.H{
+			"secret":      encoded,
+			"otpauth_url": uri,
+			"qr":          "data:image/png;base64," + base64.StdEncoding.EncodeToString(png),
+		})
+	})
+
+	// 提交验证器应用显示的验证码，确认绑定成功后开启两步验证
+	r.POST("/api/me/totp/activate", func(ctx *gin.Context) {
+		user := currentUser(ctx)
+		if user == nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "未启用登录认证"})
+			return
+		}
+		var req struct {
+			Code string `json:"code"`
+		}
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if user.TOTPSecret == "" {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "请先生成两步验证密钥"})
+			return
+		}
+		if err := checkUserTOTP(user, req.Code); err != nil {
+			ctx.JSON(totpErrorStatus(err, http.StatusBadRequest), gin.H{"error": err.Error()})
+			return
+		}
+		db.Model(user).Update("totp_enabled", true)
+		ctx.JSON(http.StatusOK, gin.H{"message": "两步验证已开启，之后登录需要输入验证码"})
+	})
+
+	// 关闭两步验证，需要提交密码和当前的验证码
+	r.POST("/api/me/totp/disable", func(ctx *gin.Context) {
+		user := currentUser(ctx)
+		if user == nil || !user.TOTPEnabled {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "未开启两步验证"})
+			return
+		}
+		var req struct {
+			Password string `json:"password"`
+			Code     string `json:"code"`
+		}
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if !checkPassword(user.Username, req.Password) {
+			ctx.JSON(http.StatusUnauthorized, gin.H{"error": "密码错误"})
+			return
+		}
+		if err := checkUserTOTP(user, req.Code); err != nil {
+			ctx.JSON(totpErrorStatus(err, http.StatusUnauthorized), gin.H{"error": err.Error()})
+			return
+		}
+		resetTOTP(user)
+		ctx.JSON(http.StatusOK, gin.H{"message": "两步验证已关闭"})
+	})
+
+	// 管理员重置用户的两步验证，用于用户丢失验证器的情况
+	r.DELETE("/api/users/:id/totp", requireAdmin, func(ctx *gin.Context) {
+		var user User
+		if err := db.First(&user, ctx.Param("id")).Error; err != nil {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "用户不存在"})
+			return
+		}
+		resetTOTP(&user)
+		ctx.JSON(http.StatusOK, gin.H{"message": "已重置用户的两步验证"})
+	})
+}
+
+// resetTOTP 关闭用户的两步验证并删除密钥
+func resetTOTP(user *User) {
+	clearTOTPFailures(user.ID)
+	db.Model(user).Updates(map[string]any{"totp_enabled": false, "totp_secret": "", "totp_last_step": 0})
+}
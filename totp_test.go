@@ -0,0 +1,48 @@
+package main
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCheckUserTOTPRejectsConcurrentReplay(t *testing.T) {
+	setupTestDB(t)
+	oldKey := totpKey
+	totpKey = make([]byte, 32)
+	defer func() { totpKey = oldKey }()
+
+	secret := []byte("12345678901234567890")
+	encrypted, err := encryptTOTPSecret(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	user := User{Username: "alice", TOTPEnabled: true, TOTPSecret: encrypted}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	defer clearTOTPFailures(user.ID)
+	code := totpCode(secret, time.Now().Unix()/totpPeriod)
+
+	// 两个请求各自读取了用户记录 (上一次使用的周期相同)，同时提交同一个验证码
+	const logins = 8
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	passed := 0
+	for i := 0; i < logins; i++ {
+		loaded := user
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if checkUserTOTP(&loaded, code) == nil {
+				mu.Lock()
+				passed++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if passed != 1 {
+		t.Fatalf("同一个验证码通过了 %d 次，期望只通过 1 次", passed)
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 请求超时的类型，记录在日志中便于区分服务端在哪个阶段没有响应
+const (
+	timeoutConnect        = "connect"         // 建立 TCP 连接超时
+	timeoutTLSHandshake   = "tls_handshake"   // TLS 握手超时
+	timeoutResponseHeader = "response_header" // 连接已建立，等待响应头超过任务的 ResponseHeaderTimeout
+	timeoutTotal          = "total"           // 超过任务的总超时时间 (Timeout)，包括读取响应体
+)
+
+// timeoutLabels 是超时类型在状态文本中的说明
+var timeoutLabels = map[string]string{
+	timeoutConnect:        "建立连接超时",
+	timeoutTLSHandshake:   "TLS 握手超时",
+	timeoutResponseHeader: "等待响应头超时",
+	timeoutTotal:          "超过总超时时间",
+}
+
+// transportKey 是连接级超时和证书校验设置的组合，设置相同的任务共用一个 Transport，空闲连接可以在它们之间复用
+type transportKey struct {
+	idle, header time.Duration
+	insecure     bool // 跳过 TLS 证书校验
+}
+
+var (
+	transports     = make(map[transportKey]*http.Transport)
+	transportMutex sync.Mutex
+)
+
+// taskTransport 返回任务请求使用的 Transport。未设置连接级超时且校验证书时返回 nil，使用默认的 Transport
+func taskTransport(t *Task) http.RoundTripper {
+	if t.IdleConnTimeout <= 0 && t.ResponseHeaderTimeout <= 0 && !t.InsecureSkipVerify {
+		return nil
+	}
+	key := transportKey{
+		idle:     time.Duration(t.IdleConnTimeout) * time.Second,
+		header:   time.Duration(t.ResponseHeaderTimeout) * time.Second,
+		insecure: t.InsecureSkipVerify,
+	}
+	transportMutex.Lock()
+	defer transportMutex.Unlock()
+	if tr, ok := transports[key]; ok {
+		return tr
+	}
+	tr := http.DefaultTransport.(*http.Transport).Clone()
+	if key.idle > 0 {
+		tr.IdleConnTimeout = key.idle
+	}
+	tr.ResponseHeaderTimeout = key.header
+	if key.insecure {
+		tr.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+	transports[key] = tr
+	return tr
+}
+
+// timeoutKind 判断请求错误是哪一种超时，不是超时返回空字符串
+func timeoutKind(err error) string {
+	var netErr net.Error
+	if !errors.As(err, &netErr) || !netErr.Timeout() {
+		return ""
+	}
+	msg := err.Error()
+	var opErr *net.OpError
+	switch {
+	case strings.Contains(msg, "timeout awaiting response headers"):
+		return timeoutResponseHeader
+	case strings.Contains(msg, "TLS handshake timeout"):
+		return timeoutTLSHandshake
+	case errors.As(err, &opErr) && opErr.Op == "dial":
+		return timeoutConnect
+	default:
+		return timeoutTotal
+	}
+}
+
+// failureText 返回请求失败时的状态文本，超时时注明超时的类型
+func failureText(prefix string, err error, kind string) string {
+	if kind != "" {
+		prefix += " (" + timeoutLabels[kind] + ")"
+	}
+	return prefix + ": " + err.Error()
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// runPoint 是一次请求的执行指标，写入外部时序数据库用于长期趋势分析
+type runPoint struct {
+	TaskID     int
+	Task       string
+	URL        string
+	Success    bool
+	DurationMs int64
+	Status     int // 没有收到响应时为0
+	Extracted  map[string]any
+	Time       time.Time
+}
+
+// metricsExporter 是执行指标的导出后端
+type metricsExporter interface {
+	// Write 写入一批数据点，失败时这批数据点会在下次导出时重试
+	Write(points []runPoint) error
+	// Name 返回后端名称，用于输出日志
+	Name() string
+}
+
+// 指标导出配置。PIPIGO_METRICS_EXPORT 为导出后端，目前支持 influx (InfluxDB 行协议)，不设置时不导出。
+// 数据点先缓存在内存中，攒够 PIPIGO_METRICS_BATCH 个或每隔 PIPIGO_METRICS_FLUSH 批量写入一次。
+var (
+	metricsBackend       = newMetricsExporter()
+	metricsBatchSize     = envInt("PIPIGO_METRICS_BATCH", 100)
+	metricsFlushInterval = envDuration("PIPIGO_METRICS_FLUSH", 10*time.Second)
+)
+
+// maxBufferedBatches 是导出持续失败时内存中最多缓存的批数，超出后丢弃最早的数据点
+const maxBufferedBatches = 10
+
+var (
+	metricsBuffer []runPoint
+	metricsMutex  sync.Mutex
+	// flushMutex 保证同一时间只有一个批次在写入，避免数据点乱序
+	flushMutex sync.Mutex
+)
+
+// newMetricsExporter 根据 PIPIGO_METRICS_EXPORT 环境变量创建导出后端
+func newMetricsExporter() metricsExporter {
+	switch os.Getenv("PIPIGO_METRICS_EXPORT") {
+	case "":
+		return nil
+	case "influx":
+		e := &influxExporter{
+			url:         os.Getenv("PIPIGO_INFLUX_URL"),
+			token:       os.Getenv("PIPIGO_INFLUX_TOKEN"),
+			measurement: envString("PIPIGO_INFLUX_MEASUREMENT", "pipigo_run"),
+			client:      &http.Client{Timeout: 10 * time.Second},
+		}
+		if e.url == "" {
+			fmt.Println("PIPIGO_METRICS_EXPORT=influx 但未配置 PIPIGO_INFLUX_URL，不导出执行指标")
+			return nil
+		}
+		return e
+	default:
+		fmt.Printf("未知的指标导出后端 %q，不导出执行指标\n", os.Getenv("PIPIGO_METRICS_EXPORT"))
+		return nil
+	}
+}
+
+// exportRun 将一次请求的结果加入导出缓冲，攒够一批时在后台写入
+func exportRun(t *Task, entry *Log) {
+	if metricsBackend == nil {
+		return
+	}
+	p := runPoint{
+		TaskID:     t.ID,
+		Task:       t.Name,
+		URL:        entry.URL,
+		Success:    entry.Success,
+		DurationMs: entry.DurationMs,
+		Status:     entry.statusCode,
+		Extracted:  entry.Extracted,
+		Time:       entry.Time,
+	}
+	metricsMutex.Lock()
+	metricsBuffer = append(metricsBuffer, p)
+	full := len(metricsBuffer) >= metricsBatchSize
+	metricsMutex.Unlock()
+	if full {
+		go flushMetrics()
+	}
+}
+
+// flushMetrics 将缓冲中的数据点批量写入导出后端，写入失败时放回缓冲等待下次重试
+func flushMetrics() {
+	if metricsBackend == nil {
+		return
+	}
+	flushMutex.Lock()
+	defer flushMutex.Unlock()
+
+	metricsMutex.Lock()
+	points := metricsBuffer
+	metricsBuffer = nil
+	metricsMutex.Unlock()
+	if len(points) == 0 {
+		return
+	}
+
+	for start := 0; start < len(points); start += metricsBatchSize {
+		end := min(start+metricsBatchSize, len(points))
+		if err := metricsBackend.Write(points[start:end]); err != nil {
+			fmt.Printf("写入 %s 指标失败，%d 个数据点稍后重试: %v\n", metricsBackend.Name(), len(points)-start, err)
+			requeueMetrics(points[start:])
+			return
+		}
+	}
+}
+
+// requeueMetrics 将写入失败的数据点放回缓冲的最前面，超出缓存上限时丢弃最早的数据点
+func requeueMetrics(points []runPoint) {
+	metricsMutex.Lock()
+	defer metricsMutex.Unlock()
+	metricsBuffer = append(points, metricsBuffer...)
+	if limit := metricsBatchSize * maxBufferedBatches; len(metricsBuffer) > limit {
+		dropped := len(metricsBuffer) - limit
+		metricsBuffer = metricsBuffer[dropped:]
+		fmt.Printf("指标导出积压过多，丢弃最早的 %d 个数据点\n", dropped)
+	}
+}
+
+// influxExporter 通过 HTTP 以行协议写入 InfluxDB (或兼容行协议的数据库，例如 VictoriaMetrics)。
+// url 为完整的写入地址，例如 http://localhost:8086/api/v2/write?org=my-org&bucket=pipigo&precision=ms，
+// 地址中的 precision 必须为 ms。
+type influxExporter struct {
+	url         string
+	token       string
+	measurement string
+	client      *http.Client
+}
+
+func (e *influxExporter) Name() string { return "influx" }
+
+// Write 将数据点编码为行协议，一次请求写入
+func (e *influxExporter) Write(points []runPoint) error {
+	var b bytes.Buffer
+	for _, p := range points {
+		writeLine(&b, e.measurement, p)
+	}
+	req, err := http.NewRequest(http.MethodPost, e.url, &b)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if e.token != "" {
+		req.Header.Set("Authorization", "Token "+e.token)
+	}
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("状态 %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
+
+// writeLine 写入一行行协议，例如
+// pipigo_run,task_id=1,task=health,url=http://a/b success=true,duration_ms=12i,status=200i,latency=0.5 1700000000000
+// 提取的字段作为额外的字段写入，与内置字段同名的会被忽略
+func writeLine(b *bytes.Buffer, measurement string, p runPoint) {
+	b.WriteString(escapeLineKey(measurement))
+	fmt.Fprintf(b, ",task_id=%d", p.TaskID)
+	if p.Task != "" {
+		b.WriteString(",task=" + escapeLineKey(p.Task))
+	}
+	if p.URL != "" {
+		b.WriteString(",url=" + escapeLineKey(p.URL))
+	}
+	fmt.Fprintf(b, " success=%t,duration_ms=%di,status=%di", p.Success, p.DurationMs, p.Status)
+
+	names := make([]string, 0, len(p.Extracted))
+	for name := range p.Extracted {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if name == "success" || name == "duration_ms" || name == "status" {
+			continue
+		}
+		if value, ok := lineFieldValue(p.Extracted[name]); ok {
+			b.WriteString("," + escapeLineKey(name) + "=" + value)
+		}
+	}
+	fmt.Fprintf(b, " %d\n", p.Time.UnixMilli())
+}
+
+// lineFieldValue 将提取的值编码为行协议的字段值：数字为浮点数，布尔值原样写入，
+// 字符串加引号，对象和数组写为 JSON 字符串。提取失败 (nil) 时不写入该字段。
+func lineFieldValue(v any) (string, bool) {
+	switch v := v.(type) {
+	case nil:
+		return "", false
+	case bool:
+		return strconv.FormatBool(v), true
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), true
+	case string:
+		return quoteLineString(v), true
+	default:
+		raw, err := json.Marshal(v)
+		if err != nil {
+			return "", false
+		}
+		return quoteLineString(string(raw)), true
+	}
+}
+
+// 行协议的转义规则：度量名、标签和字段名中的逗号、等号和空格需要转义，字符串字段值中的引号和反斜杠需要转义
+var (
+	lineKeyEscaper    = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `, "\n", `\n`)
+	lineStringEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+)
+
+// escapeLineKey 转义度量名、标签或字段名
+func escapeLineKey(s string) string {
+	return lineKeyEscaper.Replace(s)
+}
+
+// quoteLineString 将字符串编码为行协议的字符串字段值
+func quoteLineString(s string) string {
+	return `"` + lineStringEscaper.Replace(s) + `"`
+}
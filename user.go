@@ -0,0 +1,231 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// User 定义了一个登录用户，普通用户只能查看和管理自己的任务，管理员可以管理所有任务和用户
+type User struct {
+	ID           int       `json:"id" gorm:"primaryKey"`
+	Username     string    `json:"username" gorm:"uniqueIndex;size:191"`
+	PasswordHash string    `json:"-"`
+	IsAdmin      bool      `json:"is_admin"`
+	CreatedAt    time.Time `json:"created_at"`
+	// 两步验证：TOTPSecret 是加密保存的密钥 (绑定中或已开启)，开启后登录需要验证码；TOTPLastStep 是最近一次使用的验证码周期
+	TOTPEnabled  bool   `json:"totp_enabled"`
+	TOTPSecret   string `json:"-"`
+	TOTPLastStep int64  `json:"-"`
+}
+
+// authOn 表示是否启用了登录认证，数据库中存在用户时启用
+var authOn bool
+
+// seedUsers 根据 PIPIGO_USERS 创建尚不存在的用户 (已存在的用户不会被修改)，并确定是否启用认证。
+// 格式为 "用户名:密码[:admin],..."，带 admin 标记的为管理员；没有任何管理员时第一个用户成为管理员。
+func seedUsers() {
+	for _, item := range strings.Split(os.Getenv("PIPIGO_USERS"), ",") {
+		parts := strings.Split(strings.TrimSpace(item), ":")
+		if len(parts) < 2 || parts[0] == "" {
+			continue
+		}
+		var count int64
+		db.Model(&User{}).Where("username = ?", parts[0]).Count(&count)
+		if count > 0 {
+			continue
+		}
+		user := User{Username: parts[0], IsAdmin: len(parts) > 2 && parts[2] == "admin"}
+		if err := user.setPassword(parts[1]); err != nil {
+			fmt.Printf("创建用户 %s 失败: %v\n", user.Username, err)
+			continue
+		}
+		db.Create(&user)
+		fmt.Printf("已创建用户 %s\n", user.Username)
+	}
+
+	var users, admins int64
+	db.Model(&User{}).Count(&users)
+	db.Model(&User{}).Where("is_admin = ?", true).Count(&admins)
+	if users > 0 && admins == 0 {
+		var first User
+		db.Order("id").First(&first)
+		db.Model(&first).Update("is_admin", true)
+		fmt.Printf("没有管理员，已将用户 %s 设为管理员\n", first.Username)
+	}
+	authOn = users > 0
+}
+
+// setPassword 以 bcrypt 哈希保存密码
+func (u *User) setPassword(password string) error {
+	if password == "" {
+		return errors.New("密码不能为空")
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	u.PasswordHash = string(hash)
+	return nil
+}
+
+// findUser 按用户名查找用户
+func findUser(username string) (*User, bool) {
+	var user User
+	if err := db.Where("username = ?", username).First(&user).Error; err != nil {
+		return nil, false
+	}
+	return &user, true
+}
+
+// currentUser 返回当前登录的用户，未启用认证时返回 nil
+func currentUser(ctx *gin.Context) *User {
+	if v, ok := ctx.Get("user"); ok {
+		return v.(*User)
+	}
+	return nil
+}
+
+// isAdmin 判断当前请求是否有管理员权限，未启用认证时视为管理员
+func isAdmin(ctx *gin.Context) bool {
+	user := currentUser(ctx)
+	return user == nil || user.IsAdmin
+}
+
+// requireAdmin 是只允许管理员访问的中间件
+func requireAdmin(ctx *gin.Context) {
+	if !isAdmin(ctx) {
+		ctx.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "需要管理员权限"})
+		return
+	}
+	ctx.Next()
+}
+
+// canAccess 判断当前用户能否查看和管理该任务：管理员可以管理所有任务，普通用户只能管理自己的任务
+func canAccess(ctx *gin.Context, t *Task) bool {
+	user := currentUser(ctx)
+	return user == nil || user.IsAdmin || t.OwnerID == user.ID
+}
+
+// findTask 按路由参数中的ID查找当前用户可以访问的任务，找不到或无权访问时直接返回 404
+func findTask(ctx *gin.Context) (Task, bool) {
+	var task Task
+	if err := db.First(&task, ctx.Param("id")).Error; err != nil || !canAccess(ctx, &task) {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "任务不存在"})
+		return task, false
+	}
+	return task, true
+}
+
+// ownedTasks 限制任务查询只返回当前用户自己的任务，管理员不受限制
+func ownedTasks(ctx *gin.Context) func(*gorm.DB) *gorm.DB {
+	return func(q *gorm.DB) *gorm.DB {
+		if isAdmin(ctx) {
+			return q
+		}
+		return q.Where("owner_id = ?", currentUser(ctx).ID)
+	}
+}
+
+// registerUserRoutes 注册当前用户信息、用户管理以及任务归属的接口
+func registerUserRoutes(r gin.IRoutes) {
+	// 当前登录的用户
+	r.GET("/api/me", func(ctx *gin.Context) {
+		user := currentUser(ctx)
+		if user == nil {
+			ctx.JSON(http.StatusOK, gin.H{"username": "", "is_admin": true})
+			return
+		}
+		ctx.JSON(http.StatusOK, user)
+	})
+
+	// 获取所有用户
+	r.GET("/api/users", requireAdmin, func(ctx *gin.Context) {
+		var list []User
+		db.Order("id").Find(&list)
+		ctx.JSON(http.StatusOK, list)
+	})
+
+	// 添加用户
+	r.POST("/api/users", requireAdmin, func(ctx *gin.Context) {
+		var req struct {
+			Username string `json:"username"`
+			Password string `json:"password"`
+			IsAdmin  bool   `json:"is_admin"`
+		}
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		user := User{Username: strings.TrimSpace(req.Username), IsAdmin: req.IsAdmin}
+		if user.Username == "" || strings.ContainsAny(user.Username, ":,") {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "用户名不能为空，且不能包含冒号和逗号"})
+			return
+		}
+		if err := user.setPassword(req.Password); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err := db.Create(&user).Error; err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "保存用户失败，用户名可能已存在: " + err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusOK, user)
+	})
+
+	// 删除用户，仍拥有任务的用户需要先转移任务
+	r.DELETE("/api/users/:id", requireAdmin, func(ctx *gin.Context) {
+		var user User
+		if err := db.First(&user, ctx.Param("id")).Error; err != nil {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "用户不存在"})
+			return
+		}
+		if me := currentUser(ctx); me != nil && me.ID == user.ID {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "不能删除当前登录的用户"})
+			return
+		}
+		var owned int64
+		db.Model(&Task{}).Where("owner_id = ?", user.ID).Count(&owned)
+		if owned > 0 {
+			ctx.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("用户还拥有 %d 个任务，请先将任务转移给其他用户", owned)})
+			return
+		}
+		db.Delete(&user)
+		ctx.JSON(http.StatusOK, gin.H{"message": "用户已删除"})
+	})
+
+	// 将任务转移给其他用户
+	r.PUT("/api/tasks/:id/owner", requireAdmin, func(ctx *gin.Context) {
+		task, ok := findTask(ctx)
+		if !ok {
+			return
+		}
+		var req struct {
+			OwnerID int `json:"owner_id"`
+		}
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		var owner User
+		if err := db.First(&owner, req.OwnerID).Error; err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "用户不存在"})
+			return
+		}
+		db.Model(&task).Update("owner_id", owner.ID)
+
+		taskMutex.Lock()
+		if t, ok := tasks[task.ID]; ok {
+			t.OwnerID = owner.ID
+		}
+		taskMutex.Unlock()
+		ctx.JSON(http.StatusOK, gin.H{"owner_id": owner.ID})
+	})
+}
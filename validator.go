@@ -0,0 +1,214 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// 响应校验规则的类型
+const (
+	validatorStatus       = "status"        // 状态码在 Value 给出的范围内，例如 "200-299,304"
+	validatorHeader       = "header"        // 响应头 Target 存在，Value 不为空时还要求值相同或匹配 /正则/
+	validatorBodyContains = "body_contains" // 响应体包含 Value
+	validatorBodyRegex    = "body_regex"    // 响应体匹配正则表达式 Value
+	validatorJSONPath     = "json_path"     // JSON 响应中的字段 Target 存在，Value 不为空时还要求值相同或匹配 /正则/
+)
+
+// Validator 是一条响应校验规则
+type Validator struct {
+	Type   string `json:"type"`
+	Target string `json:"target,omitempty"` // 响应头名称或字段路径
+	Value  string `json:"value,omitempty"`
+
+	assertion bool // 由任务的响应断言 (ExpectStatus、ExpectBodyContains) 生成的规则
+}
+
+// ValidationResult 是一条校验规则在一次执行中的结果
+type ValidationResult struct {
+	Type    string `json:"type"`
+	Target  string `json:"target,omitempty"`
+	Passed  bool   `json:"passed"`
+	Message string `json:"message,omitempty"` // 未通过的原因
+
+	assertion bool
+}
+
+// validateValidators 校验任务的响应校验规则，并整理为规范的格式保存
+func validateValidators(t *Task) error {
+	hasStatus := false
+	for i := range t.Validators {
+		v := &t.Validators[i]
+		v.Type = strings.TrimSpace(v.Type)
+		v.Target = strings.TrimSpace(v.Target)
+		if err := validateValidator(v); err != nil {
+			return fmt.Errorf("第 %d 条校验规则: %v", i+1, err)
+		}
+		if v.Type == validatorStatus {
+			if hasStatus {
+				return fmt.Errorf("第 %d 条校验规则: 只能有一条 status 规则", i+1)
+			}
+			hasStatus = true
+		}
+	}
+	return nil
+}
+
+// validateValidator 校验单条规则
+func validateValidator(v *Validator) error {
+	switch v.Type {
+	case validatorStatus:
+		ranges, err := parseStatusRanges(v.Value)
+		if err != nil {
+			return err
+		}
+		if len(ranges) == 0 {
+			return errors.New("status 规则需要填写状态码范围")
+		}
+		v.Target, v.Value = "", formatStatusRanges(ranges)
+	case validatorHeader:
+		if v.Target == "" {
+			return errors.New("header 规则需要填写响应头名称")
+		}
+		return validateExpected(v.Value)
+	case validatorBodyContains:
+		if v.Value == "" {
+			return errors.New("body_contains 规则需要填写要包含的内容")
+		}
+		v.Target = ""
+	case validatorBodyRegex:
+		if _, err := regexp.Compile(v.Value); err != nil || v.Value == "" {
+			return fmt.Errorf("body_regex 规则的正则表达式无效: %v", err)
+		}
+		v.Target = ""
+	case validatorJSONPath:
+		if _, err := parseJSONPath(v.Target); err != nil {
+			return fmt.Errorf("json_path 规则的字段路径无效: %v", err)
+		}
+		return validateExpected(v.Value)
+	default:
+		return fmt.Errorf("类型 %q 无效，支持 status、header、body_contains、body_regex 和 json_path", v.Type)
+	}
+	return nil
+}
+
+// validateExpected 校验期望值，写成 /正则表达式/ 时正则必须有效
+func validateExpected(expected string) error {
+	if pattern, ok := expectedPattern(expected); ok {
+		if _, err := regexp.Compile(pattern); err != nil {
+			return fmt.Errorf("期望值的正则表达式无效: %v", err)
+		}
+	}
+	return nil
+}
+
+// effectiveValidators 返回一次执行实际检查的规则：状态码规则在最前 (没有时按 ExpectStatus 或 SuccessStatusRanges 生成)，
+// 然后是 ExpectHeader 对应的响应头规则和 ExpectBodyContains 对应的断言，最后是任务配置的其他规则
+func effectiveValidators(t *Task) []Validator {
+	status := Validator{Type: validatorStatus, Value: t.SuccessStatusRanges}
+	if t.ExpectStatus != 0 {
+		status = Validator{Type: validatorStatus, Value: strconv.Itoa(t.ExpectStatus), assertion: true}
+	} else if status.Value == "" {
+		status.Value = "200-299"
+	}
+	var rest []Validator
+	for _, v := range t.Validators {
+		if v.Type == validatorStatus {
+			status = v
+		} else {
+			rest = append(rest, v)
+		}
+	}
+	rules := []Validator{status}
+	if t.ExpectHeader != "" {
+		rules = append(rules, Validator{Type: validatorHeader, Target: t.ExpectHeader, Value: t.ExpectHeaderValue})
+	}
+	if t.ExpectBodyContains != "" {
+		rules = append(rules, Validator{Type: validatorBodyContains, Value: t.ExpectBodyContains, assertion: true})
+	}
+	return append(rules, rest...)
+}
+
+// runValidators 按顺序检查所有规则，返回每条规则的结果
+func runValidators(t *Task, statusCode int, header http.Header, body []byte) []ValidationResult {
+	var doc any
+	var docErr error
+	parsed := false
+	results := make([]ValidationResult, 0, len(t.Validators)+2)
+	for _, v := range effectiveValidators(t) {
+		r := ValidationResult{Type: v.Type, Target: v.Target, Passed: true, assertion: v.assertion}
+		switch v.Type {
+		case validatorStatus:
+			ranges, _ := parseStatusRanges(v.Value)
+			if !inStatusRanges(ranges, statusCode) {
+				r.Passed, r.Message = false, fmt.Sprintf("状态码 %d 不在 %s 中", statusCode, v.Value)
+			}
+		case validatorHeader:
+			actual, present := header.Get(v.Target), len(header.Values(v.Target)) > 0
+			if !present {
+				r.Passed, r.Message = false, fmt.Sprintf("缺少响应头 %s", v.Target)
+			} else if v.Value != "" && !matchExpected(v.Value, actual) {
+				r.Passed, r.Message = false, fmt.Sprintf("响应头 %s 为 %q，期望 %s", v.Target, actual, v.Value)
+			}
+		case validatorBodyContains:
+			if !strings.Contains(string(body), v.Value) {
+				r.Passed, r.Message = false, fmt.Sprintf("响应体不包含 %q", v.Value)
+			}
+		case validatorBodyRegex:
+			re, err := regexp.Compile(v.Value)
+			if err != nil || !re.Match(body) {
+				r.Passed, r.Message = false, fmt.Sprintf("响应体不匹配 /%s/", v.Value)
+			}
+		case validatorJSONPath:
+			if !parsed {
+				docErr = json.Unmarshal(body, &doc)
+				parsed = true
+			}
+			r.Passed, r.Message = checkJSONPath(doc, docErr, v)
+		}
+		if v.assertion && !r.Passed {
+			r.Message = assertionMessage(v, statusCode)
+		}
+		results = append(results, r)
+	}
+	return results
+}
+
+// checkJSONPath 检查 JSON 响应中的字段，字符串按原值比较，其他类型按 JSON 文本比较 (例如 true、0、null)
+func checkJSONPath(doc any, docErr error, v Validator) (bool, string) {
+	if docErr != nil {
+		return false, "响应体不是 JSON"
+	}
+	segs, err := parseJSONPath(v.Target)
+	if err != nil {
+		return false, err.Error()
+	}
+	val, ok := lookupJSONPath(doc, segs)
+	if !ok {
+		return false, fmt.Sprintf("字段 %s 不存在", v.Target)
+	}
+	if v.Value == "" {
+		return true, ""
+	}
+	actual, isString := val.(string)
+	if !isString {
+		raw, _ := json.Marshal(val)
+		actual = string(raw)
+	}
+	if !matchExpected(v.Value, actual) {
+		return false, fmt.Sprintf("字段 %s 为 %s，期望 %s", v.Target, actual, v.Value)
+	}
+	return true, ""
+}
+
+// assertionMessage 返回响应断言未通过时的说明
+func assertionMessage(v Validator, statusCode int) string {
+	if v.Type == validatorStatus {
+		return fmt.Sprintf("断言失败: 状态码为 %d，期望 %s", statusCode, v.Value)
+	}
+	return fmt.Sprintf("断言失败: 响应不包含预期内容 %q", v.Value)
+}